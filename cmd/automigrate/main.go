@@ -4,11 +4,15 @@ import (
 	"dryve/internal/config"
 	"dryve/internal/datastruct"
 	"dryve/internal/repository"
+	"flag"
 	"fmt"
+	"os"
 )
 
 func main() {
 	f := "config.json"
+	orphansOwner := flag.String("orphans-owner", "", "email of the user given the files uploaded before they recorded their owner")
+	flag.Parse()
 
 	config := config.NewConfig(f)
 
@@ -20,10 +24,52 @@ func main() {
 	tables := []any{
 		&datastruct.File{},
 		&datastruct.User{},
+		&datastruct.PendingDeletion{},
+		&datastruct.AuditEntry{},
+		&datastruct.Webhook{},
+		&datastruct.WebhookDelivery{},
+		&datastruct.Folder{},
+		&datastruct.AppToken{},
+		&datastruct.AccessKey{},
+		&datastruct.MultipartUpload{},
+		&datastruct.Replica{},
+		&datastruct.ImportJob{},
+		&datastruct.Change{},
+		&datastruct.ExportJob{},
+		&datastruct.RefreshToken{},
+		&datastruct.RevokedToken{},
 	}
 
 	err = repository.Automigrate(db, tables)
 	if err != nil {
 		fmt.Printf("automigration failed with err %v\n", err)
+		os.Exit(1)
 	}
+
+	// The files uploaded before they recorded their owner belong to no user,
+	// so they cannot be reached nor deleted along with an account until assigned
+	dao := repository.NewDAO(db)
+	if *orphansOwner == "" {
+		orphans, err := dao.NewFileQuery().CountOrphans()
+		if err != nil {
+			fmt.Printf("cannot count the files without owner, err %v\n", err)
+			os.Exit(1)
+		}
+		if orphans > 0 {
+			fmt.Printf("%d files have no owner, assign them with -orphans-owner <email>\n", orphans)
+		}
+		return
+	}
+
+	owner, err := dao.NewUserQuery().GetUserByEmail(*orphansOwner)
+	if err != nil {
+		fmt.Printf("cannot find the user %s, err %v\n", *orphansOwner, err)
+		os.Exit(1)
+	}
+	assigned, err := dao.NewFileQuery().AssignOrphans(owner.ID)
+	if err != nil {
+		fmt.Printf("cannot assign the files without owner, err %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("assigned %d files without owner to %s\n", assigned, owner.Email)
 }
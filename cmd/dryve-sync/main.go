@@ -0,0 +1,133 @@
+// Command dryve-sync mirrors a local directory to a folder of a Dryve user, uploading the
+// new and changed files and propagating their deletions as they happen.
+package main
+
+import (
+	"context"
+	"dryve/pkg/client"
+	"dryve/pkg/dto"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: dryve-sync [flags] DIR\n\n"+
+			"Mirrors DIR to a remote folder. Authenticates with -email and $DRYVE_PASSWORD, or else\n"+
+			"$DRYVE_REFRESH_TOKEN, rotated in the state file, or else $DRYVE_TOKEN.\n\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	server := flag.String("server", envOr("DRYVE_SERVER", "http://localhost:8666"), "URL of the server, $DRYVE_SERVER")
+	email := flag.String("email", os.Getenv("DRYVE_EMAIL"), "email of the user, $DRYVE_EMAIL")
+	remote := flag.String("remote", "", "path of the remote folder, /<name of DIR> if empty")
+	statePath := flag.String("state", "", "path of the state file, in the user config directory if empty")
+	once := flag.Bool("once", false, "sync the directory once and exit")
+	settle := flag.Duration("settle", 2*time.Second, "delay without changes before syncing a changed path")
+	poll := flag.Duration("poll", 30*time.Second, "interval between two polls of the remote changes")
+	rescan := flag.Duration("rescan", 10*time.Minute, "interval between two scans of the whole directory")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), *server, *email, *remote, *statePath, *once, *settle, *poll, *rescan); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+func run(dir, server, email, remote, statePath string, once bool, settle, poll, rescan time.Duration) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if remote == "" {
+		remote = "/" + filepath.Base(dir)
+	}
+	remote = path.Clean("/" + remote)
+	if statePath == "" {
+		if statePath, err = defaultStatePath(dir); err != nil {
+			return err
+		}
+	}
+
+	state, err := loadState(statePath, remote)
+	if err != nil {
+		return err
+	}
+
+	// The refresh token of the state was rotated from the one of the environment, if any
+	refreshToken := state.RefreshToken
+	if refreshToken == "" {
+		refreshToken = os.Getenv("DRYVE_REFRESH_TOKEN")
+	}
+	var opts []client.Option
+	switch {
+	case email != "" && os.Getenv("DRYVE_PASSWORD") != "":
+		opts = append(opts, client.WithCredentials(email, os.Getenv("DRYVE_PASSWORD")))
+	case refreshToken != "":
+		opts = append(opts, client.WithRefreshToken(refreshToken))
+	case os.Getenv("DRYVE_TOKEN") != "":
+		opts = append(opts, client.WithToken(os.Getenv("DRYVE_TOKEN")))
+	default:
+		return fmt.Errorf("missing credentials, set -email and $DRYVE_PASSWORD, $DRYVE_REFRESH_TOKEN or $DRYVE_TOKEN")
+	}
+	opts = append(opts, client.WithSessionHook(func(res dto.LoginResponse) {
+		state.RefreshToken = res.RefreshToken
+		if err := state.save(statePath); err != nil {
+			logrus.Errorf("cannot save the refreshed token: %v", err)
+		}
+	}))
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "local"
+	}
+	s := &syncer{
+		client:    client.New(server, opts...),
+		dir:       dir,
+		remote:    remote,
+		state:     state,
+		statePath: statePath,
+		host:      host,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if once {
+		return s.syncAll(ctx)
+	}
+
+	// Watching first, so the changes made during the initial sync are not missed
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if err := s.watchTree(w, dir); err != nil {
+		return err
+	}
+
+	logrus.Infof("syncing %s to %s on %s", dir, remote, server)
+	logError(s.syncAll(ctx))
+	return s.run(ctx, w, settle, poll, rescan)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State is the local record of the synced files, persisted as JSON between runs.
+type State struct {
+	// Remote folder the directory is synced to
+	Remote string `json:"remote"`
+	// Cursor of the change journal following the last change processed
+	Cursor string `json:"cursor"`
+	// Synced files by path relative to the directory, with slashes
+	Files map[string]*FileState `json:"files"`
+	// IDs of the files uploaded by the agent, until their creation is seen in the change journal
+	Uploaded map[string]bool `json:"uploaded"`
+	// Last refresh token of the agent, rotated on each refresh
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// FileState is the last synced version of a local file.
+type FileState struct {
+	// ID of the remote file, empty if the server refused the file
+	ID string `json:"id,omitempty"`
+	// Path of the remote file
+	RemotePath string    `json:"remotePath"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+	MD5        string    `json:"md5"`
+	// Whether the remote file was moved, deleted or superseded by someone else since the last sync
+	RemoteChanged bool `json:"remoteChanged,omitempty"`
+}
+
+// defaultStatePath returns the path of the state of the directory in the user config directory,
+// outside of the synced directory.
+func defaultStatePath(dir string) (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(config, "dryve-sync", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// loadState reads the state at path, an empty state of the remote folder if it does not exist yet.
+func loadState(path, remote string) (*State, error) {
+	s := &State{
+		Remote:   remote,
+		Files:    make(map[string]*FileState),
+		Uploaded: make(map[string]bool),
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the state: %w", err)
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("invalid state %s: %w", path, err)
+	}
+	if s.Remote != remote {
+		return nil, fmt.Errorf("state %s syncs to %s, not %s", path, s.Remote, remote)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]*FileState)
+	}
+	if s.Uploaded == nil {
+		s.Uploaded = make(map[string]bool)
+	}
+	return s, nil
+}
+
+// save writes the state to path, replacing it at once so a crash never leaves it truncated.
+func (s *State) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("cannot create the state directory: %w", err)
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("cannot write the state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot write the state: %w", err)
+	}
+	return nil
+}
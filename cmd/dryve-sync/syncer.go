@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"dryve/pkg/client"
+	"dryve/pkg/dto"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Kinds and operations of the changes of the journal considered by the agent.
+const (
+	changeFile   = "file"
+	changeCreate = "create"
+	changeMove   = "move"
+	changeDelete = "delete"
+)
+
+// Suffixes of the temporary files of editors and browsers, which are not synced.
+var ignoredSuffixes = []string{"~", ".swp", ".tmp", ".part", ".crdownload"}
+
+// syncer mirrors a local directory to a remote folder. It is not safe for concurrent use.
+type syncer struct {
+	client *client.Client
+	// Absolute path of the local directory
+	dir string
+	// Path of the remote folder
+	remote    string
+	state     *State
+	statePath string
+	// Name of the machine, in the name of the conflict copies
+	host string
+}
+
+// syncAll catches up with the remote changes, then syncs the whole directory.
+func (s *syncer) syncAll(ctx context.Context) error {
+	if err := s.pollChanges(ctx); err != nil {
+		return err
+	}
+	return s.scan(ctx, "")
+}
+
+// scan syncs the files within the directory at rel, "" for the whole directory,
+// and propagates the deletion of the synced files no longer found there.
+func (s *syncer) scan(ctx context.Context, rel string) error {
+	seen := make(map[string]bool)
+	root := filepath.Join(s.dir, filepath.FromSlash(rel))
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil && p == root {
+			return err
+		}
+		if err != nil {
+			// Unreadable entries are skipped, but never considered deleted
+			logrus.Warnf("cannot read %s: %v", p, err)
+			if r, ok := s.rel(p); ok {
+				seen[r] = true
+			}
+			return nil
+		}
+		r, ok := s.rel(p)
+		if !ok || ignored(r) {
+			if d.IsDir() && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		seen[r] = true
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		return s.syncFile(ctx, r, info)
+	})
+	if err != nil {
+		return err
+	}
+
+	for r := range s.state.Files {
+		if !seen[r] && !seenParent(seen, r) && within(r, rel) {
+			if err := s.removeFile(ctx, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncPath syncs the file or directory at rel after an event, which may be gone since.
+func (s *syncer) syncPath(ctx context.Context, rel string, watch func(dir string) error) error {
+	info, err := os.Lstat(filepath.Join(s.dir, filepath.FromSlash(rel)))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Removed or renamed, along with the files within if a directory
+		for r := range s.state.Files {
+			if within(r, rel) {
+				if err := s.removeFile(ctx, r); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		if err := watch(filepath.Join(s.dir, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+		return s.scan(ctx, rel)
+	}
+	if info.Mode().IsRegular() {
+		return s.syncFile(ctx, rel, info)
+	}
+	return nil
+}
+
+// syncFile uploads the file if new or changed since its last sync, replacing its previous version.
+// If the previous version was changed remotely in the meantime, both are kept, the file being
+// uploaded as a conflict copy next to it.
+func (s *syncer) syncFile(ctx context.Context, rel string, info fs.FileInfo) error {
+	entry := s.state.Files[rel]
+	if entry != nil && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		return nil
+	}
+
+	abs := filepath.Join(s.dir, filepath.FromSlash(rel))
+	sum, err := fileMD5(abs)
+	if err != nil {
+		logrus.Warnf("cannot read %s: %v", abs, err)
+		return nil
+	}
+	if entry != nil && entry.MD5 == sum {
+		// Touched but unchanged
+		entry.Size = info.Size()
+		entry.ModTime = info.ModTime()
+		return s.state.save(s.statePath)
+	}
+
+	folder, name := path.Split(path.Join(s.remote, rel))
+	folder = path.Clean(folder)
+	conflict := entry != nil && entry.ID != "" && entry.RemoteChanged
+	if conflict {
+		name = conflictName(name, s.host, time.Now())
+		logrus.Warnf("%s was changed remotely, uploading it as %s", rel, name)
+	}
+
+	f, err := os.Open(abs)
+	if err != nil {
+		logrus.Warnf("cannot read %s: %v", abs, err)
+		return nil
+	}
+	defer f.Close()
+	res, err := s.client.Upload(ctx, name, f, &client.UploadOptions{Folder: folder})
+	if errors.Is(err, client.ErrBadRequest) || errors.Is(err, client.ErrQuarantined) {
+		// Refused for good, it is not sent again until it changes
+		logrus.Errorf("%s refused by the server: %v", rel, err)
+		if entry == nil {
+			entry = &FileState{}
+			s.state.Files[rel] = entry
+		}
+		entry.Size, entry.ModTime, entry.MD5 = info.Size(), info.ModTime(), sum
+		return s.state.save(s.statePath)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot upload %s: %w", rel, err)
+	}
+	s.state.Uploaded[res.ID] = true
+	logrus.Infof("uploaded %s as %s", rel, res.ID)
+
+	if entry != nil && entry.ID != "" && !conflict {
+		if err := s.deleteRemote(ctx, rel, entry.ID); err != nil {
+			logrus.Warnf("%v, keeping the previous version", err)
+		}
+	}
+	s.state.Files[rel] = &FileState{
+		ID:         res.ID,
+		RemotePath: path.Join(folder, name),
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		MD5:        sum,
+	}
+	return s.state.save(s.statePath)
+}
+
+// removeFile propagates the deletion of the synced file, unless its remote version was changed since.
+func (s *syncer) removeFile(ctx context.Context, rel string) error {
+	entry := s.state.Files[rel]
+	if entry.ID != "" {
+		if entry.RemoteChanged {
+			logrus.Warnf("%s was changed remotely, keeping the remote file", rel)
+		} else if err := s.deleteRemote(ctx, rel, entry.ID); err != nil {
+			return err
+		}
+	}
+
+	delete(s.state.Files, rel)
+	return s.state.save(s.statePath)
+}
+
+// deleteRemote deletes the remote version of a file. Files deleted already or which cannot
+// be deleted, as retained or held, are left to the server.
+func (s *syncer) deleteRemote(ctx context.Context, rel, id string) error {
+	err := s.client.DeleteFile(ctx, id)
+	switch {
+	case err == nil:
+		logrus.Infof("deleted %s (%s)", rel, id)
+	case errors.Is(err, client.ErrNotFound):
+	case errors.Is(err, client.ErrForbidden):
+		logrus.Warnf("cannot delete %s (%s): %v", rel, id, err)
+	default:
+		return fmt.Errorf("cannot delete %s: %w", rel, err)
+	}
+	return nil
+}
+
+// pollChanges reads the remote changes since the last poll, flagging the synced files changed
+// by someone else. Files are never updated in place: a new version is a new file, so only their
+// moves and deletions, or the creation of another file at their path, are changes.
+func (s *syncer) pollChanges(ctx context.Context) error {
+	for {
+		res, err := s.client.ListChanges(ctx, s.state.Cursor, 0)
+		if errors.Is(err, client.ErrGone) {
+			return s.resetChanges(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot list the remote changes: %w", err)
+		}
+
+		// The first poll only returns the current position
+		if s.state.Cursor != "" {
+			for _, change := range res.Changes {
+				s.applyChange(change)
+			}
+		}
+		s.state.Cursor = res.Cursor
+		if err := s.state.save(s.statePath); err != nil {
+			return err
+		}
+		if !res.HasMore {
+			return nil
+		}
+	}
+}
+
+func (s *syncer) applyChange(change dto.ChangeResponse) {
+	if change.Kind != changeFile {
+		// The files of a moved or deleted folder go along without changes of their own
+		if change.Op == changeMove || change.Op == changeDelete {
+			for _, entry := range s.state.Files {
+				if strings.HasPrefix(entry.RemotePath, change.Path+"/") {
+					entry.RemoteChanged = true
+				}
+			}
+		}
+		return
+	}
+
+	if change.Op == changeCreate && s.state.Uploaded[change.FileID] {
+		// Uploaded by the agent, under the name normalized by the server
+		delete(s.state.Uploaded, change.FileID)
+		for _, entry := range s.state.Files {
+			if entry.ID == change.FileID {
+				entry.RemotePath = change.Path
+			}
+		}
+		return
+	}
+
+	for _, entry := range s.state.Files {
+		if entry.ID == "" {
+			continue
+		}
+		switch change.Op {
+		case changeMove, changeDelete:
+			if entry.ID == change.FileID {
+				entry.RemoteChanged = true
+			}
+		case changeCreate:
+			if entry.RemotePath == change.Path {
+				entry.RemoteChanged = true
+			}
+		}
+	}
+}
+
+// resetChanges restarts from the current position of the journal once the changes since the last
+// poll are lost, flagging the synced files no longer found.
+func (s *syncer) resetChanges(ctx context.Context) error {
+	logrus.Warnf("remote changes since the last sync expired, checking the synced files")
+	for rel, entry := range s.state.Files {
+		if entry.ID == "" || entry.RemoteChanged {
+			continue
+		}
+		_, err := s.client.GetFile(ctx, entry.ID)
+		if errors.Is(err, client.ErrNotFound) || errors.Is(err, client.ErrGone) {
+			entry.RemoteChanged = true
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot check %s: %w", rel, err)
+		}
+	}
+
+	s.state.Cursor = ""
+	s.state.Uploaded = make(map[string]bool)
+	return s.pollChanges(ctx)
+}
+
+// rel returns the slash separated path of p relative to the directory.
+func (s *syncer) rel(p string) (string, bool) {
+	r, err := filepath.Rel(s.dir, p)
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if r == "." {
+		return "", true
+	}
+	return filepath.ToSlash(r), true
+}
+
+// ignored returns whether the path is hidden or a temporary file, within a hidden directory included.
+func ignored(rel string) bool {
+	if rel == "" {
+		return false
+	}
+	for _, name := range strings.Split(rel, "/") {
+		if strings.HasPrefix(name, ".") {
+			return true
+		}
+	}
+	for _, suffix := range ignoredSuffixes {
+		if strings.HasSuffix(rel, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// within returns whether the path is dir or within it, everything being within "".
+func within(rel, dir string) bool {
+	return dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/")
+}
+
+// seenParent returns whether a parent directory of the path was seen, as unreadable.
+func seenParent(seen map[string]bool, rel string) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if seen[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictName returns the name of the conflict copy of a file, e.g. "report (conflict laptop 2006-01-02 150405).pdf".
+func conflictName(name, host string, t time.Time) string {
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s (conflict %s %s)%s", strings.TrimSuffix(name, ext), host, t.Format("2006-01-02 150405"), ext)
+}
+
+func fileMD5(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
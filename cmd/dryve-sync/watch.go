@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// watchTree watches the directory at root and its subdirectories, except the ignored ones.
+// fsnotify does not watch recursively, so the directories created later are added as they are synced.
+func (s *syncer) watchTree(w *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if r, ok := s.rel(p); !ok || ignored(r) {
+			return filepath.SkipDir
+		}
+		return w.Add(p)
+	})
+}
+
+// run syncs the paths changed on disk once quiet for the settle delay, polls the remote
+// changes every poll interval and rescans the whole directory every rescan interval,
+// catching up with the events missed, until the context is done.
+func (s *syncer) run(ctx context.Context, w *fsnotify.Watcher, settle, poll, rescan time.Duration) error {
+	dirty := make(map[string]bool)
+	settleTimer := time.NewTimer(settle)
+	settleTimer.Stop()
+	pollTicker := time.NewTicker(poll)
+	defer pollTicker.Stop()
+	rescanTicker := time.NewTicker(rescan)
+	defer rescanTicker.Stop()
+
+	watch := func(dir string) error {
+		return s.watchTree(w, dir)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			// Chmod events come with every touch, without changing the content
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if r, ok := s.rel(event.Name); ok && r != "" && !ignored(r) {
+				dirty[r] = true
+				settleTimer.Reset(settle)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			// Events may have been dropped, the next rescan catches up
+			logrus.Warnf("watch error: %v", err)
+		case <-settleTimer.C:
+			logError(s.pollChanges(ctx))
+			for r := range dirty {
+				logError(s.syncPath(ctx, r, watch))
+			}
+			dirty = make(map[string]bool)
+		case <-pollTicker.C:
+			logError(s.pollChanges(ctx))
+		case <-rescanTicker.C:
+			logError(s.syncAll(ctx))
+		}
+	}
+}
+
+// logError logs the error of a sync, retried on the next rescan.
+func logError(err error) {
+	if err != nil && err != context.Canceled {
+		logrus.Errorf("%v, retrying on the next rescan", err)
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"dryve/pkg/client"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Format of the dates of the ranges, as accepted by the server.
+const dateFormat = "2006-01-02"
+
+func runLogin(ctx context.Context, cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	email := flags.String("email", cli.config.Email, "email of the user, prompted if empty")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin, DRYVE_PASSWORD is used otherwise if set")
+	if err := parseFlags(flags, args, exactly(0)); err != nil {
+		return err
+	}
+
+	var err error
+	if *email == "" {
+		fmt.Fprint(cli.stderr, "Email: ")
+		if *email, err = cli.readLine(); err != nil {
+			return err
+		}
+	}
+
+	var password string
+	switch {
+	case *passwordStdin:
+		password, err = cli.readLine()
+	case os.Getenv("DRYVE_PASSWORD") != "":
+		password = os.Getenv("DRYVE_PASSWORD")
+	default:
+		password, err = cli.readPassword("Password: ")
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := cli.client.Login(ctx, *email, password)
+	if err != nil {
+		return err
+	}
+
+	cli.config.Email = *email
+	cli.config.Token = res.Token
+	cli.config.RefreshToken = res.RefreshToken
+	if err := saveConfig(cli.configPath, cli.config); err != nil {
+		return err
+	}
+
+	if cli.json {
+		return cli.printJSON(map[string]string{"server": cli.config.Server, "email": *email})
+	}
+	fmt.Fprintf(cli.stdout, "Logged in to %s as %s\n", cli.config.Server, *email)
+	return nil
+}
+
+func runLogout(ctx context.Context, cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	all := flags.Bool("all", false, "revoke all the sessions of the user, on every device")
+	if err := parseFlags(flags, args, exactly(0)); err != nil {
+		return err
+	}
+
+	// Tokens already rejected by the server are removed all the same
+	err := cli.client.Logout(ctx, *all)
+	if err != nil && !errors.Is(err, client.ErrUnauthorized) {
+		return err
+	}
+
+	cli.config.Token = ""
+	cli.config.RefreshToken = ""
+	if err := saveConfig(cli.configPath, cli.config); err != nil {
+		return err
+	}
+
+	if cli.json {
+		return cli.printJSON(map[string]any{"server": cli.config.Server, "all": *all})
+	}
+	fmt.Fprintf(cli.stdout, "Logged out of %s\n", cli.config.Server)
+	return nil
+}
+
+// uploadResult is the outcome of the upload of a local file.
+type uploadResult struct {
+	Path       string `json:"path"`
+	ID         string `json:"id,omitempty"`
+	ScanStatus string `json:"scanStatus,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func runUpload(ctx context.Context, cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	expiresIn := flags.Duration("expires-in", 0, "expiration of the files, e.g. 24h, none if zero")
+	if err := parseFlags(flags, args, atLeast(1)); err != nil {
+		return err
+	}
+
+	paths, err := expandPaths(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	// Files are uploaded one at a time, the failures do not stop the others
+	results := make([]uploadResult, 0, len(paths))
+	failed := 0
+	for _, p := range paths {
+		res := uploadResult{Path: p}
+		uploaded, err := cli.uploadFile(ctx, p, *expiresIn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			res.Error = err.Error()
+			failed++
+			if !cli.json {
+				fmt.Fprintf(cli.stderr, "%s: %v\n", p, err)
+			}
+		} else {
+			res.ID = uploaded.ID
+			res.ScanStatus = uploaded.ScanStatus
+			if !cli.json {
+				fmt.Fprintf(cli.stdout, "%s\t%s\n", uploaded.ID, p)
+			}
+		}
+		results = append(results, res)
+	}
+
+	if cli.json {
+		if err := cli.printJSON(results); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed", failed, len(paths))
+	}
+	return nil
+}
+
+func (cli *cli) uploadFile(ctx context.Context, p string, expiresIn time.Duration) (uploadResult, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return uploadResult{}, err
+	}
+
+	bar := cli.newProgressBar(filepath.Base(p), info.Size())
+	res, err := cli.client.Upload(ctx, filepath.Base(p), bar.Reader(f), &client.UploadOptions{ExpiresIn: expiresIn})
+	bar.Finish()
+	if err != nil {
+		return uploadResult{}, err
+	}
+	return uploadResult{ID: res.ID, ScanStatus: res.ScanStatus}, nil
+}
+
+// expandPaths expands the glob patterns and walks the directories, returning the regular files found.
+// Files are uploaded by name, the directories they are found in are not kept.
+func expandPaths(args []string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no such file", arg)
+		}
+
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					add(p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return paths, nil
+}
+
+func runDownload(ctx context.Context, cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	output := flags.String("o", "", "path of the downloaded file, - for stdout, the name of the file if empty")
+	force := flags.Bool("f", false, "overwrite the file if it exists")
+	if err := parseFlags(flags, args, exactly(1)); err != nil {
+		return err
+	}
+	id := flags.Arg(0)
+
+	f, err := cli.client.OpenFile(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dest := *output
+	if dest == "" {
+		dest = downloadName(f.Name, id)
+	}
+
+	bar := cli.newProgressBar(filepath.Base(dest), f.Size)
+	body := bar.Reader(f)
+	var n int64
+	if dest == "-" {
+		n, err = io.Copy(cli.stdout, body)
+	} else {
+		n, err = writeFile(dest, body, *force)
+	}
+	bar.Finish()
+	if err != nil {
+		return err
+	}
+
+	// The content itself was written to stdout
+	if dest == "-" {
+		return nil
+	}
+	if cli.json {
+		return cli.printJSON(map[string]any{"id": id, "path": dest, "size": n})
+	}
+	fmt.Fprintf(cli.stdout, "%s\t%s\n", id, dest)
+	return nil
+}
+
+// downloadName returns the base name of the file sent by the server, or else its ID.
+func downloadName(name, id string) string {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "." || name == string(filepath.Separator) {
+		return id
+	}
+	return name
+}
+
+// writeFile writes the content to a temporary file renamed to path once complete,
+// so an interrupted download does not leave a truncated file behind.
+func writeFile(path string, r io.Reader, force bool) (int64, error) {
+	if _, err := os.Stat(path); err == nil && !force {
+		return 0, fmt.Errorf("%s already exists, use -f to overwrite it", path)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return n, err
+	}
+	return n, nil
+}
+
+func runInfo(ctx context.Context, cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	if err := parseFlags(flags, args, exactly(1)); err != nil {
+		return err
+	}
+
+	file, err := cli.client.GetFile(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if cli.json {
+		return cli.printJSON(file)
+	}
+
+	w := tabwriter.NewWriter(cli.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%s\n", file.ID)
+	fmt.Fprintf(w, "Name:\t%s\n", file.Name)
+	fmt.Fprintf(w, "Size:\t%s (%d bytes)\n", formatSize(file.Size), file.Size)
+	fmt.Fprintf(w, "Content type:\t%s\n", file.ContentType)
+	fmt.Fprintf(w, "Scan status:\t%s\n", file.ScanStatus)
+	if file.Tier != "" {
+		fmt.Fprintf(w, "Tier:\t%s\n", file.Tier)
+	}
+	if file.ExpiresAt != nil {
+		fmt.Fprintf(w, "Expires at:\t%s\n", file.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	if file.RetainUntil != nil {
+		fmt.Fprintf(w, "Retained until:\t%s\n", file.RetainUntil.Local().Format(time.RFC3339))
+	}
+	if file.LegalHold {
+		fmt.Fprintf(w, "Legal hold:\tyes\n")
+	}
+	if file.LastAccessedAt != nil {
+		fmt.Fprintf(w, "Last accessed at:\t%s\n", file.LastAccessedAt.Local().Format(time.RFC3339))
+	}
+	if len(file.ScrubbedMetadata) > 0 {
+		fmt.Fprintf(w, "Scrubbed metadata:\t%s\n", strings.Join(file.ScrubbedMetadata, ", "))
+	}
+	return w.Flush()
+}
+
+func runList(ctx context.Context, cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	if err := parseFlags(flags, args, exactly(2)); err != nil {
+		return err
+	}
+	from, to, err := parseRange(flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	res, err := cli.client.SearchFiles(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	if cli.json {
+		return cli.printJSON(res)
+	}
+
+	w := tabwriter.NewWriter(cli.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSIZE\tSCAN\tNAME")
+	for _, file := range res.Files {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", file.ID, formatSize(file.Size), file.ScanStatus, file.Name)
+	}
+	return w.Flush()
+}
+
+func runDelete(ctx context.Context, cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	if err := parseFlags(flags, args, atLeast(1)); err != nil {
+		return err
+	}
+
+	type deleteResult struct {
+		ID    string `json:"id"`
+		Error string `json:"error,omitempty"`
+	}
+	results := make([]deleteResult, 0, flags.NArg())
+	failed := 0
+	for _, id := range flags.Args() {
+		res := deleteResult{ID: id}
+		if err := cli.client.DeleteFile(ctx, id); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			res.Error = err.Error()
+			failed++
+			if !cli.json {
+				fmt.Fprintf(cli.stderr, "%s: %v\n", id, err)
+			}
+		} else if !cli.json {
+			fmt.Fprintf(cli.stdout, "Deleted %s\n", id)
+		}
+		results = append(results, res)
+	}
+
+	if cli.json {
+		if err := cli.printJSON(results); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deletions failed", failed, flags.NArg())
+	}
+	return nil
+}
+
+func runDeleteRange(ctx context.Context, cli *cli, args []string) error {
+	flags := cli.newFlagSet()
+	yes := flags.Bool("yes", false, "delete without asking for confirmation")
+	if err := parseFlags(flags, args, exactly(2)); err != nil {
+		return err
+	}
+	from, to, err := parseRange(flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if !*yes {
+		// The files are listed first, so the user knows what is about to be deleted
+		files, err := cli.client.SearchFiles(ctx, from, to)
+		if err != nil {
+			return err
+		}
+		if files.Count == 0 {
+			fmt.Fprintf(cli.stderr, "No files uploaded between %s and %s\n", flags.Arg(0), flags.Arg(1))
+			return nil
+		}
+		if !isTerminal(os.Stdin) {
+			return fmt.Errorf("refusing to delete %d files without confirmation, use -yes", files.Count)
+		}
+		fmt.Fprintf(cli.stderr, "Delete %d files uploaded between %s and %s? Type 'yes' to confirm: ", files.Count, flags.Arg(0), flags.Arg(1))
+		answer, err := cli.readLine()
+		if err != nil {
+			return err
+		}
+		if answer != "yes" {
+			return errors.New("deletion cancelled")
+		}
+	}
+
+	res, err := cli.client.DeleteFiles(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	if cli.json {
+		return cli.printJSON(res)
+	}
+
+	failed := 0
+	for _, item := range res.Result {
+		if item.Error != "" {
+			failed++
+			fmt.Fprintf(cli.stderr, "%s: %s\n", item.ID, item.Error)
+		}
+	}
+	fmt.Fprintf(cli.stdout, "Deleted %d files\n", res.Count-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deletions failed", failed, res.Count)
+	}
+	return nil
+}
+
+// parseRange parses the dates of the range, both inclusive.
+func parseRange(rawFrom, rawTo string) (from, to time.Time, err error) {
+	if from, err = time.Parse(dateFormat, rawFrom); err != nil {
+		return from, to, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", rawFrom)
+	}
+	if to, err = time.Parse(dateFormat, rawTo); err != nil {
+		return from, to, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", rawTo)
+	}
+	return from, to, nil
+}
+
+func (cli *cli) printJSON(v any) error {
+	enc := json.NewEncoder(cli.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// readLine reads a line from stdin, without its line ending.
+func (cli *cli) readLine() (string, error) {
+	line, err := cli.stdin.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// readPassword prompts for the password, hiding it on the terminals where stty is available.
+func (cli *cli) readPassword(prompt string) (string, error) {
+	fmt.Fprint(cli.stderr, prompt)
+	if isTerminal(os.Stdin) && stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(cli.stderr)
+		}()
+	}
+	return cli.readLine()
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// Error of the commands whose usage was printed, as their arguments are invalid.
+var errUsage = errors.New("invalid usage")
+
+// parseFlags parses the flags of the command and checks its number of arguments,
+// printing its usage if invalid.
+func parseFlags(flags *flag.FlagSet, args []string, valid func(n int) bool) error {
+	// The flag set prints the error and the usage itself
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if !valid(flags.NArg()) {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func exactly(n int) func(int) bool {
+	return func(nargs int) bool { return nargs == n }
+}
+
+func atLeast(n int) func(int) bool {
+	return func(nargs int) bool { return nargs >= n }
+}
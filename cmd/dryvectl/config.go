@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Server used until another one is configured.
+const defaultServer = "http://localhost:8666"
+
+// Config is stored in the user config directory, as it holds the tokens of the user.
+type Config struct {
+	Server string `json:"server"`
+	Email  string `json:"email,omitempty"`
+	Token  string `json:"token,omitempty"`
+	// Rotated on each refresh of the token
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// defaultConfigPath returns the path of the config file, DRYVECTL_CONFIG if set.
+func defaultConfigPath() string {
+	if p := os.Getenv("DRYVECTL_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(".dryvectl", "config.json")
+	}
+	return filepath.Join(dir, "dryvectl", "config.json")
+}
+
+// loadConfig reads the config file, the defaults if it does not exist yet.
+func loadConfig(path string) (Config, error) {
+	c := Config{Server: defaultServer}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("cannot read the config file: %w", err)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// saveConfig writes the config file readable by the user only, replacing it at once.
+func saveConfig(path string, c Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("cannot create the config directory: %w", err)
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
+		return fmt.Errorf("cannot write the config file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot write the config file: %w", err)
+	}
+	return nil
+}
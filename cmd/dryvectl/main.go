@@ -0,0 +1,144 @@
+// Command dryvectl is the command-line client of the Dryve API.
+package main
+
+import (
+	"bufio"
+	"context"
+	"dryve/pkg/client"
+	"dryve/pkg/dto"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// command is a subcommand of dryvectl.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, cli *cli, args []string) error
+}
+
+var commands = []command{
+	{"login", "[-email EMAIL] [-password-stdin]", "Log in and store the token in the config file", runLogin},
+	{"logout", "[-all]", "Revoke the token, or all the sessions, and remove it from the config file", runLogout},
+	{"upload", "[-expires-in SECONDS] PATH...", "Upload files, glob patterns and directories", runUpload},
+	{"download", "[-o PATH] [-f] ID", "Download a file, to its name or the given path", runDownload},
+	{"info", "ID", "Show the metadata of a file", runInfo},
+	{"ls", "FROM TO", "List the files uploaded between two dates (YYYY-MM-DD)", runList},
+	{"rm", "ID...", "Delete files", runDelete},
+	{"rm-range", "[-yes] FROM TO", "Delete the files uploaded between two dates, once confirmed (files:delete_range permission)", runDeleteRange},
+}
+
+// cli holds the state shared by the commands.
+type cli struct {
+	cmd        *command
+	configPath string
+	config     Config
+	client     *client.Client
+	// Whether to print the results as JSON, for scripts
+	json   bool
+	stdin  *bufio.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	flag.Usage = usage
+	configPath := flag.String("config", defaultConfigPath(), "path of the config file")
+	server := flag.String("server", "", "URL of the server, overriding the config file")
+	jsonOutput := flag.Bool("json", false, "print the results as JSON")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd := findCommand(flag.Arg(0))
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "dryvectl: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dryvectl: %v\n", err)
+		os.Exit(1)
+	}
+	if *server != "" {
+		config.Server = strings.TrimSuffix(*server, "/")
+	}
+
+	cli := &cli{
+		cmd:        cmd,
+		configPath: *configPath,
+		config:     config,
+		json:       *jsonOutput,
+		stdin:      bufio.NewReader(os.Stdin),
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+	}
+	cli.client = client.New(config.Server, client.WithToken(config.Token), client.WithRefreshToken(config.RefreshToken),
+		client.WithSessionHook(cli.saveSession))
+
+	// Interrupting cancels the running request
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err = cmd.run(ctx, cli, flag.Args()[1:])
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if errors.Is(err, client.ErrUnauthorized) {
+		fmt.Fprintf(os.Stderr, "dryvectl: %v, run dryvectl login\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dryvectl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: dryvectl [-config PATH] [-server URL] [-json] COMMAND [ARGS]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// saveSession stores the tokens of a login or a refresh in the config file, as the previous
+// refresh token cannot be used anymore.
+func (cli *cli) saveSession(res dto.LoginResponse) {
+	cli.config.Token = res.Token
+	cli.config.RefreshToken = res.RefreshToken
+	if err := saveConfig(cli.configPath, cli.config); err != nil {
+		fmt.Fprintf(cli.stderr, "dryvectl: cannot save the refreshed token: %v\n", err)
+	}
+}
+
+// newFlagSet creates the flag set of the running command, printing its usage on errors.
+func (cli *cli) newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(cli.cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dryvectl %s %s\n\n%s\n", cli.cmd.name, cli.cmd.args, cli.cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
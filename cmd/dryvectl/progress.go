@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Width of the bar, in characters.
+const progressWidth = 30
+
+// Minimum delay between two redraws of a progress bar.
+const progressInterval = 100 * time.Millisecond
+
+// progressBar draws the progress of a transfer on a terminal. A nil progressBar draws nothing.
+type progressBar struct {
+	w     io.Writer
+	label string
+	// Total number of bytes, negative if unknown
+	total int64
+	done  int64
+	drawn time.Time
+}
+
+// newProgressBar returns a progress bar drawn on stderr, or nil if stderr is not a terminal.
+func (cli *cli) newProgressBar(label string, total int64) *progressBar {
+	f, ok := cli.stderr.(*os.File)
+	if !ok || !isTerminal(f) {
+		return nil
+	}
+	return &progressBar{w: f, label: label, total: total}
+}
+
+// Reader returns a reader advancing the bar as r is read.
+func (p *progressBar) Reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r: r, bar: p}
+}
+
+func (p *progressBar) add(n int) {
+	p.done += int64(n)
+	if time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+func (p *progressBar) draw() {
+	p.drawn = time.Now()
+	label := p.label
+	if r := []rune(label); len(r) > 24 {
+		label = "…" + string(r[len(r)-23:])
+	}
+	if p.total < 0 {
+		fmt.Fprintf(p.w, "\r%-24s %s", label, formatSize(p.done))
+		return
+	}
+
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = float64(p.done) / float64(p.total)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	filled := int(ratio * progressWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	fmt.Fprintf(p.w, "\r%-24s [%s] %3.0f%% %s/%s", label, bar, ratio*100, formatSize(p.done), formatSize(p.total))
+}
+
+// Finish draws the final state of the bar and moves to the next line.
+func (p *progressBar) Finish() {
+	if p == nil {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.w)
+}
+
+type progressReader struct {
+	r   io.Reader
+	bar *progressBar
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.bar.add(n)
+	return n, err
+}
+
+// isTerminal returns whether the file is a terminal rather than a pipe or a regular file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// formatSize formats a number of bytes with a binary unit.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"dryve/internal/app"
 	"dryve/internal/config"
+	"dryve/internal/datastruct"
 	"dryve/internal/repository"
 	"dryve/internal/service"
 	"fmt"
@@ -28,6 +30,12 @@ func main() {
 	}
 	config := config.NewConfig(defaultConfigPath)
 
+	// Anyone knowing the key could forge presigned URLs of any user
+	if config.Presign.Key == "" {
+		fmt.Printf("presign.key must be set to a secret key\n")
+		os.Exit(1)
+	}
+
 	// Initialize database
 	db, err := repository.NewDB(config.Database)
 	if err != nil {
@@ -37,16 +45,132 @@ func main() {
 	// Register data access objects
 	dao := repository.NewDAO(db)
 
+	// Spread the blobs over the storage volumes
+	storagePool := service.NewStoragePool(dao, config.Storage)
+
+	// Start background workers
+	ctx := context.Background()
+
+	// Mirror the blobs to the replicas, if any
+	var replicator service.Replicator
+	if len(config.Replication.Replicas) > 0 {
+		replicator = service.NewReplicator(dao, storagePool, config.Replication.Replicas, config.Replication.Mode == "sync",
+			time.Duration(config.Replication.IntervalSecs)*time.Second, config.Replication.BatchSize)
+		go replicator.Run(ctx)
+	}
+
+	// Demote the idle files to the slower tiers, if any
+	if len(config.Storage.Tiers) > 1 {
+		tieringWorker := service.NewTieringWorker(dao, storagePool,
+			time.Duration(config.Storage.TieringIntervalSecs)*time.Second)
+		go tieringWorker.Run(ctx)
+	}
+
+	deletionWorker := service.NewDeletionWorker(dao, storagePool, replicator,
+		time.Duration(config.Storage.DeletionIntervalSecs)*time.Second, config.Storage.DeletionBatchSize)
+	go deletionWorker.Run(ctx)
+
+	// Scan uploads for malware, if enabled
+	var scanner service.Scanner
+	if config.Scan.Enabled {
+		scanner = service.NewClamdScanner(config.Scan.Network, config.Scan.Address,
+			time.Duration(config.Scan.TimeoutSecs)*time.Second)
+	}
+
+	// Deliver the file and user lifecycle events to webhooks and stream clients
+	events := service.NewEventBus()
+	eventStream := service.NewEventStream(config.Stream.HistorySize, config.Stream.BufferSize)
+	events.Subscribe(eventStream.Handle)
+	webhookService := service.NewWebhookService(dao, time.Duration(config.Webhooks.TimeoutSecs)*time.Second,
+		time.Duration(config.Webhooks.IntervalSecs)*time.Second, config.Webhooks.MaxAttempts)
+	events.Subscribe(webhookService.Handle)
+	go webhookService.Run(ctx)
+
+	fileService := service.NewFileService(dao, storagePool, replicator, scanner, config.Scan.Mode == "sync", events)
+	expiryReaper := service.NewExpiryReaper(dao, fileService,
+		time.Duration(config.Expiry.ReaperIntervalSecs)*time.Second)
+	go expiryReaper.Run(ctx)
+	if scanner != nil {
+		scanWorker := service.NewScanWorker(dao, fileService,
+			time.Duration(config.Scan.IntervalSecs)*time.Second)
+		go scanWorker.Run(ctx)
+	}
+
+	// Fetch the files imported from remote URLs in background
+	importService := service.NewImportService(dao, fileService, config.Limits.MaxFileSize, config.Import.MaxRedirects,
+		time.Duration(config.Import.TimeoutSecs)*time.Second, config.Import.MaxConcurrent)
+	if err := importService.FailInterrupted(); err != nil {
+		fmt.Printf("cannot fail the interrupted imports, err %v\n", err)
+	}
+
+	// Prune the change journal past its retention
+	changeJournal := service.NewChangeJournal(dao, time.Duration(config.Changes.RetentionDays)*24*time.Hour,
+		time.Duration(config.Changes.PruneIntervalSecs)*time.Second)
+	go changeJournal.Run(ctx)
+
+	// Abort the multipart uploads abandoned by the S3 clients
+	multipartService := service.NewMultipartService(dao, config.Storage.Path, config.Limits.MaxFileSize,
+		time.Duration(config.S3.MultipartTTLHours)*time.Hour, time.Duration(config.S3.MultipartPruneIntervalSecs)*time.Second)
+	go multipartService.Run(ctx)
+
+	// Build the exports of the user data in background, and remove the expired archives
+	// TODO: Replace this when I get an email provider
+	emailService := service.NewMockEmailService(config.Email)
+	exportService := service.NewExportService(dao, fileService, emailService, config.Export,
+		config.Email.User, config.HTTP.BaseURL, []byte(config.Presign.Key))
+	if err := exportService.FailInterrupted(); err != nil {
+		fmt.Printf("cannot fail the interrupted exports, err %v\n", err)
+	}
+	go exportService.Run(ctx)
+
+	// Delete the accounts past their grace period, along with their files and data
+	accountDeletionWorker := service.NewAccountDeletionWorker(dao, fileService, multipartService, exportService,
+		time.Duration(config.Accounts.DeletionIntervalSecs)*time.Second)
+	go accountDeletionWorker.Run(ctx)
+
+	// Issue and revoke the sessions, and prune the expired ones
+	sessionService := service.NewSessionService(dao, config.JWT)
+	go sessionService.Run(ctx)
+
+	// Grant the permissions of the built-in and custom roles
+	authorizer, err := service.NewAuthorizer(config.RBAC.Roles)
+	if err != nil {
+		fmt.Printf("invalid roles, err %v\n", err)
+		os.Exit(1)
+	}
+
 	// Create application and register services
 	app := app.NewApp(config).
-		WithFileService(service.NewFileService(dao, config.Storage.Path)).
-		WithUserService(service.NewUserService(dao)).
-		// TODO: Replace this when I get an email provider
-		WithEmailService(service.NewMockEmailService(config.Email))
+		WithFileService(fileService).
+		WithUserService(service.NewUserService(dao, events)).
+		WithSessionService(sessionService).
+		WithAuthorizer(authorizer).
+		WithEmailService(emailService).
+		WithAuditService(service.NewAuditService(dao)).
+		WithWebhookService(webhookService).
+		WithMultipartService(multipartService).
+		WithStoragePool(storagePool).
+		WithReplicator(replicator).
+		WithImportService(importService).
+		WithEventStream(eventStream).
+		WithChangeJournal(changeJournal).
+		WithExportService(exportService).
+		WithDeletionWorker(deletionWorker).
+		WithAccountDeletionWorker(accountDeletionWorker)
 
 	// Create and setup middlewares and routes
 	r := setupRouter(app)
 
+	// Start the S3 compatible API on its own listener, if enabled
+	if config.S3.Enabled {
+		go func() {
+			err := http.ListenAndServe(fmt.Sprintf(":%d", config.S3.Port), setupS3Router(app))
+			if err != nil {
+				fmt.Printf("S3 server failed with err %v\n", err)
+			}
+		}()
+	}
+
 	// Start server
 	err = http.ListenAndServe(fmt.Sprintf(":%d", config.HTTP.Port), r)
 	if err != nil {
@@ -55,9 +179,55 @@ func main() {
 }
 
 // setupRouter creates and setups middlewares and routes
+// WebDAV is mounted apart, as its collection paths end with a slash.
 func setupRouter(app *app.App) *chi.Mux {
 	r := chi.NewRouter()
 
+	r.Mount("/dav", setupDAVRouter(app))
+	r.Mount("/", setupAPIRouter(app))
+
+	return r
+}
+
+// setupDAVRouter creates and setups middlewares and routes of the WebDAV endpoint
+func setupDAVRouter(app *app.App) *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Use(middleware.Logger)
+	r.Use(middleware.RealIP)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.RequestID)
+	// Authenticate with the email and the password or an app token.
+	r.Use(app.BasicAuthMiddleware)
+
+	r.Handle("/*", http.HandlerFunc(app.WebDAV))
+
+	return r
+}
+
+// setupS3Router creates and setups middlewares and routes of the S3 compatible API
+// Buckets are addressed in the path, e.g. /{bucket}/{key}, not in the host name.
+func setupS3Router(app *app.App) *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Use(middleware.Logger)
+	r.Use(middleware.RealIP)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.RequestID)
+	// Authenticate the SigV4 signature with the access key of the user.
+	r.Use(app.S3AuthMiddleware)
+
+	r.Get("/", app.S3ListBuckets)
+	r.Handle("/{bucket}", http.HandlerFunc(app.S3Bucket))
+	r.Handle("/{bucket}/*", http.HandlerFunc(app.S3Object))
+
+	return r
+}
+
+// setupAPIRouter creates and setups middlewares and routes of the REST API
+func setupAPIRouter(app *app.App) *chi.Mux {
+	r := chi.NewRouter()
+
 	// Match request paths with a trailing slash and redirect to the same path without.
 	r.Use(middleware.RedirectSlashes)
 	// Set a few useful out-of-the-box middlewares.
@@ -87,6 +257,8 @@ func setupRouter(app *app.App) *chi.Mux {
 	r.Route("/auth", func(r chi.Router) {
 		r.Post("/login", app.Login)
 		r.Post("/register", app.Register)
+		r.Post("/refresh", app.Refresh)
+		r.With(app.JWTMiddleware).Post("/logout", app.Logout)
 	})
 
 	// Protected routes (only requiring JWT)
@@ -97,6 +269,17 @@ func setupRouter(app *app.App) *chi.Mux {
 		r.Get("/user/verify/1", app.EmailVerifyStep1)
 	})
 
+	// Presigned routes (signature in the query string instead of JWT)
+	r.Route("/presigned", func(r chi.Router) {
+		r.Use(app.PresignMiddleware)
+		r.Use(httprate.LimitByIP(app.Config.Limits.FileEndpointsRateLimit, 1*time.Minute))
+
+		r.Post("/files", app.UploadFile)
+		r.Get("/files/{id}/download", app.DownloadFile)
+		r.Get("/events", app.StreamEvents)
+		r.Get("/exports/{id}/download", app.DownloadExport)
+	})
+
 	// Public routes
 	// Public route for email verification
 	r.Get("/user/verify/2/email/{id}/{code}", app.EmailVerifyStep2)
@@ -110,16 +293,111 @@ func setupRouter(app *app.App) *chi.Mux {
 		// Use JWT Claims to populate context (user, role, etc.)
 		r.Use(app.AuthMiddleware)
 
+		// Permissions granted to the role of the user
+		read := app.RequirePermission(datastruct.PermFilesRead)
+		write := app.RequirePermission(datastruct.PermFilesWrite)
+		remove := app.RequirePermission(datastruct.PermFilesDelete)
+
 		r.Route("/files", func(r chi.Router) {
-			r.Get("/{id}", app.GetFile)
-			r.Get("/range/{from}/{to}", app.SearchFilesByDateRange)
+			r.With(read).Get("/{id}", app.GetFile)
+			r.With(read).Get("/range/{from}/{to}", app.SearchFilesByDateRange)
+			r.With(write).Get("/import/{id}", app.GetImport)
 
 			r.Group(func(r chi.Router) {
 				r.Use(httprate.LimitByIP(app.Config.Limits.FileEndpointsRateLimit, 1*time.Minute))
-				r.Post("/", app.UploadFile)
-				r.Get("/{id}/download", app.DownloadFile)
-				r.Delete("/{id}", app.DeleteFile)
-				r.Delete("/range/{from}/{to}", app.DeleteFiles)
+				r.With(write).Post("/", app.UploadFile)
+				r.With(write).Post("/import", app.ImportFile)
+				r.With(read).Get("/{id}/download", app.DownloadFile)
+				r.With(read).Get("/{id}/original", app.DownloadOriginal)
+				r.With(remove).Delete("/{id}", app.DeleteFile)
+				r.With(app.RequirePermission(datastruct.PermFilesDeleteRange)).Delete("/range/{from}/{to}", app.DeleteFiles)
+			})
+		})
+
+		r.With(read).Get("/events", app.StreamEvents)
+		r.With(read).Get("/changes", app.ListChanges)
+		r.Post("/presign", app.Presign)
+
+		r.Get("/user/settings", app.GetSettings)
+		r.Put("/user/settings", app.UpdateSettings)
+
+		r.Route("/user/deletion", func(r chi.Router) {
+			r.Put("/", app.RequestAccountDeletion)
+			r.Get("/", app.GetAccountDeletion)
+			r.Delete("/", app.CancelAccountDeletion)
+		})
+
+		r.Route("/user/exports", func(r chi.Router) {
+			r.Post("/", app.RequestExport)
+			r.Get("/{id}", app.GetExport)
+			r.Get("/{id}/download", app.DownloadExport)
+		})
+
+		r.Route("/user/tokens", func(r chi.Router) {
+			r.Post("/", app.CreateAppToken)
+			r.Get("/", app.ListAppTokens)
+			r.Delete("/{id}", app.DeleteAppToken)
+		})
+
+		r.Route("/user/access-keys", func(r chi.Router) {
+			r.Post("/", app.CreateAccessKey)
+			r.Get("/", app.ListAccessKeys)
+			r.Delete("/{id}", app.DeleteAccessKey)
+		})
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Post("/", app.CreateWebhook)
+			r.Get("/", app.ListWebhooks)
+			r.Delete("/{id}", app.DeleteWebhook)
+			r.Get("/{id}/deliveries", app.ListWebhookDeliveries)
+			r.Post("/{id}/deliveries/{deliveryId}/redeliver", app.RedeliverWebhook)
+		})
+
+		r.Route("/storage", func(r chi.Router) {
+			r.Use(app.RequirePermission(datastruct.PermStorageAdmin))
+			r.Get("/deletions", app.GetDeletionStatus)
+		})
+
+		// Admin routes, each group requiring its permission
+		r.Route("/admin", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(app.RequirePermission(datastruct.PermHoldsAdmin))
+				r.Put("/files/{id}/hold", app.PlaceFileHold)
+				r.Delete("/files/{id}/hold", app.ReleaseFileHold)
+				r.Put("/users/{id}/hold", app.PlaceUserHold)
+				r.Delete("/users/{id}/hold", app.ReleaseUserHold)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.RequirePermission(datastruct.PermUsersAdmin))
+				r.Get("/users", app.ListUsers)
+				r.Get("/users/{id}", app.GetUserAccount)
+				r.Put("/users/{id}/verify", app.VerifyUserAccount)
+				r.Put("/users/{id}/disabled", app.DisableUser)
+				r.Delete("/users/{id}/disabled", app.EnableUser)
+				r.Post("/users/{id}/password-reset", app.ResetUserPassword)
+				r.Put("/users/{id}/role", app.SetUserRole)
+				r.Put("/users/{id}/deletion", app.DeleteUserAccount)
+				r.Delete("/users/{id}/deletion", app.CancelUserAccountDeletion)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.RequirePermission(datastruct.PermFilesAdmin))
+				r.Get("/users/{id}/files", app.ListUserFiles)
+				r.Delete("/users/{id}/files/{fileId}", app.DeleteUserFile)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.RequirePermission(datastruct.PermAuditRead))
+				r.Get("/audit", app.SearchAudit)
+				r.Get("/audit/export", app.ExportAudit)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.RequirePermission(datastruct.PermStorageAdmin))
+				r.Get("/storage/volumes", app.ListVolumes)
+				r.Post("/storage/volumes/{name}/drain", app.DrainVolume)
+				r.Get("/storage/replicas", app.ListReplicas)
 			})
 		})
 	})
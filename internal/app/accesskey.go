@@ -0,0 +1,87 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// CreateAccessKey creates an S3 access key for the user, returning its secret only once.
+func (app *App) CreateAccessKey(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	key, err := app.UserService.CreateAccessKey(user.ID)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditAccessKeyCreate, "", datastruct.AuditFailure, err.Error())
+		http.Error(w, "error creating access key", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditAccessKeyCreate, key.KeyID, datastruct.AuditSuccess, "")
+
+	res := accessKeyResponse(key)
+	res.Secret = key.Secret
+	common.EncodeJSONAndSend(w, res)
+}
+
+// ListAccessKeys returns the S3 access keys of the user, without their secrets.
+func (app *App) ListAccessKeys(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	keys, err := app.UserService.ListAccessKeys(user.ID)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		http.Error(w, "error getting access keys", http.StatusInternalServerError)
+		return
+	}
+
+	var res dto.ListAccessKeysResponse
+	res.Count = len(keys)
+	res.Keys = make([]dto.AccessKeyResponse, res.Count)
+	for i, key := range keys {
+		res.Keys[i] = accessKeyResponse(key)
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+// DeleteAccessKey revokes the S3 access key with the given id.
+func (app *App) DeleteAccessKey(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	idParam := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		http.Error(w, "Invalid access key id", http.StatusBadRequest)
+		return
+	}
+
+	err = app.UserService.DeleteAccessKey(user.ID, uint(id))
+	if err == service.ErrAccessKeyNotFound {
+		http.Error(w, "Access key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditAccessKeyDelete, idParam, datastruct.AuditFailure, err.Error())
+		http.Error(w, "error deleting access key", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditAccessKeyDelete, idParam, datastruct.AuditSuccess, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func accessKeyResponse(key datastruct.AccessKey) dto.AccessKeyResponse {
+	return dto.AccessKeyResponse{
+		ID:        key.ID,
+		KeyID:     key.KeyID,
+		CreatedAt: key.CreatedAt,
+	}
+}
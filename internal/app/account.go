@@ -0,0 +1,198 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/internal/utils"
+	"dryve/pkg/dto"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// RequestAccountDeletion schedules the deletion of the account of the user, once confirmed
+// with their password, after a grace period during which it can be cancelled.
+func (app *App) RequestAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	var req dto.DeleteAccountRequest
+	err := common.DecodeJSONBody(w, r, &req)
+	if err != nil {
+		common.HandleDecodeError(w, err)
+		return
+	}
+
+	if !utils.VerifyPassword(user.Password, req.Password) {
+		app.audit(r, auditAccountDelete, strconv.Itoa(int(user.ID)), datastruct.AuditFailure, "wrong password")
+		http.Error(w, "Wrong password", http.StatusUnauthorized)
+		return
+	}
+	if user.LegalHold {
+		app.audit(r, auditAccountDelete, strconv.Itoa(int(user.ID)), datastruct.AuditBlocked, service.ErrAccountImmutable.Error())
+		http.Error(w, "Account under legal hold", http.StatusConflict)
+		return
+	}
+	if user.DeleteAt != nil {
+		w.WriteHeader(http.StatusAccepted)
+		common.EncodeJSONAndSend(w, dto.AccountDeletionResponse{DeleteAt: user.DeleteAt})
+		return
+	}
+
+	deleteAt := time.Now().Add(time.Duration(app.Config.Accounts.DeletionGraceDays) * 24 * time.Hour)
+	if _, err := app.UserService.SetDeletion(user.ID, &deleteAt); err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditAccountDelete, strconv.Itoa(int(user.ID)), datastruct.AuditFailure, err.Error())
+		http.Error(w, "Error scheduling the account deletion", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditAccountDelete, strconv.Itoa(int(user.ID)), datastruct.AuditSuccess, "scheduled at "+deleteAt.UTC().Format(time.RFC3339))
+
+	email := dto.Email{
+		From:    app.Config.Email.User,
+		To:      user.Email,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf("Hi %s,<br><br>Your account and all your files will be deleted on <b>%s</b>. "+
+			"Until then, you can cancel the deletion by logging in.", user.FirstName, deleteAt.UTC().Format(time.RFC1123)),
+	}
+	if err := app.EmailService.SendEmail(email); err != nil {
+		logrus.Errorf("cannot send the account deletion email to user %d: %v", user.ID, err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	common.EncodeJSONAndSend(w, dto.AccountDeletionResponse{DeleteAt: &deleteAt})
+}
+
+// GetAccountDeletion returns the time of the scheduled deletion of the account of the user, if any.
+func (app *App) GetAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	common.EncodeJSONAndSend(w, dto.AccountDeletionResponse{DeleteAt: user.DeleteAt})
+}
+
+// CancelAccountDeletion cancels the scheduled deletion of the account of the user.
+func (app *App) CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	if user.DeleteAt == nil {
+		http.Error(w, "No account deletion scheduled", http.StatusNotFound)
+		return
+	}
+
+	_, err := app.UserService.SetDeletion(user.ID, nil)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditAccountDeleteCancel, strconv.Itoa(int(user.ID)), datastruct.AuditFailure, err.Error())
+		http.Error(w, "Error cancelling the account deletion", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditAccountDeleteCancel, strconv.Itoa(int(user.ID)), datastruct.AuditSuccess, "")
+
+	common.EncodeJSONAndSend(w, dto.AccountDeletionResponse{})
+}
+
+// DeleteUserAccount schedules the deletion of the account of the user with the given id after the
+// grace period, or deletes it at once with ?immediate=true.
+func (app *App) DeleteUserAccount(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+	immediate := r.URL.Query().Get("immediate") == "true"
+
+	user, err := app.UserService.GetUser(uint(id))
+	if err == gorm.ErrRecordNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Errorf(err.Error())
+		http.Error(w, "error getting user", http.StatusInternalServerError)
+		return
+	}
+	if user.LegalHold {
+		app.audit(r, auditAccountDelete, idParam, datastruct.AuditBlocked, service.ErrAccountImmutable.Error())
+		http.Error(w, "Account under legal hold", http.StatusConflict)
+		return
+	}
+
+	deleteAt := time.Now()
+	if !immediate {
+		deleteAt = deleteAt.Add(time.Duration(app.Config.Accounts.DeletionGraceDays) * 24 * time.Hour)
+		if user.DeleteAt != nil && user.DeleteAt.Before(deleteAt) {
+			deleteAt = *user.DeleteAt
+		}
+	}
+	user, err = app.UserService.SetDeletion(user.ID, &deleteAt)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditAccountDelete, idParam, datastruct.AuditFailure, err.Error())
+		http.Error(w, "Error scheduling the account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	if !immediate {
+		app.audit(r, auditAccountDelete, idParam, datastruct.AuditSuccess, "scheduled at "+deleteAt.UTC().Format(time.RFC3339))
+		w.WriteHeader(http.StatusAccepted)
+		common.EncodeJSONAndSend(w, dto.AccountDeletionResponse{ID: user.ID, DeleteAt: user.DeleteAt})
+		return
+	}
+
+	// Accounts which cannot be deleted yet are left to the worker, which retries them
+	err = app.AccountDeletionWorker.Delete(*user)
+	if err == service.ErrAccountImmutable {
+		app.audit(r, auditAccountDelete, idParam, datastruct.AuditBlocked, err.Error())
+		http.Error(w, "Account holds retained files or files under legal hold", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.audit(r, auditAccountDelete, idParam, datastruct.AuditFailure, err.Error())
+		http.Error(w, "Error deleting the account", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditAccountDelete, idParam, datastruct.AuditSuccess, "deleted")
+
+	common.EncodeJSONAndSend(w, dto.AccountDeletionResponse{ID: user.ID, Deleted: true})
+}
+
+// CancelUserAccountDeletion cancels the scheduled deletion of the account of the user with the given id.
+func (app *App) CancelUserAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.UserService.GetUser(uint(id))
+	if err == gorm.ErrRecordNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Errorf(err.Error())
+		http.Error(w, "error getting user", http.StatusInternalServerError)
+		return
+	}
+	if user.DeleteAt == nil {
+		http.Error(w, "No account deletion scheduled", http.StatusNotFound)
+		return
+	}
+
+	if _, err := app.UserService.SetDeletion(user.ID, nil); err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditAccountDeleteCancel, idParam, datastruct.AuditFailure, err.Error())
+		http.Error(w, "Error cancelling the account deletion", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditAccountDeleteCancel, idParam, datastruct.AuditSuccess, "")
+
+	common.EncodeJSONAndSend(w, dto.AccountDeletionResponse{ID: user.ID})
+}
@@ -0,0 +1,417 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 500
+)
+
+// ListUsers returns a page of the users matching the query filters, by ID, along with their storage usage.
+// ?q= matches the email and the names, ?role=, ?verified= and ?disabled= filter on the account.
+func (app *App) ListUsers(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultUserPageSize
+	}
+	if limit > maxUserPageSize {
+		limit = maxUserPageSize
+	}
+
+	users, total, err := app.UserService.SearchUsers(filter, offset, limit)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	usage, err := app.UserService.GetUsage(ids)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditAdminUserList, "", datastruct.AuditSuccess, r.URL.RawQuery)
+
+	var res dto.ListUsersResponse
+	res.Count = len(users)
+	res.Total = total
+	res.Offset = offset
+	res.Users = make([]dto.AdminUserResponse, res.Count)
+	for i, user := range users {
+		res.Users[i] = adminUserResponse(user, usage[user.ID])
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+// GetUserAccount returns the account of the user with the given id, along with their storage usage.
+func (app *App) GetUserAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getTargetUser(w, r)
+	if !ok {
+		return
+	}
+	app.audit(r, auditAdminUserView, strconv.Itoa(int(user.ID)), datastruct.AuditSuccess, "")
+
+	app.sendUserAccount(w, user)
+}
+
+// VerifyUserAccount verifies the email of the user with the given id, for users who never got the verification email.
+func (app *App) VerifyUserAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+	target := strconv.Itoa(int(user.ID))
+
+	if err := app.UserService.VerifyUser(user.ID); err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditVerifyEmail, target, datastruct.AuditFailure, err.Error())
+		http.Error(w, "error verifying user", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditVerifyEmail, target, datastruct.AuditSuccess, "by admin")
+
+	user.Verified = true
+	app.sendUserAccount(w, user)
+}
+
+// DisableUser disables the user with the given id, refusing all their requests, and revokes their sessions.
+func (app *App) DisableUser(w http.ResponseWriter, r *http.Request) {
+	app.setUserDisabled(w, r, true)
+}
+
+// EnableUser re-enables the disabled user with the given id.
+func (app *App) EnableUser(w http.ResponseWriter, r *http.Request) {
+	app.setUserDisabled(w, r, false)
+}
+
+func (app *App) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	user, ok := app.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+	target := strconv.Itoa(int(user.ID))
+	action := auditUserEnable
+	if disabled {
+		action = auditUserDisable
+	}
+
+	actor := r.Context().Value(ctxKeyUser).(*datastruct.User)
+	if disabled && actor.ID == user.ID {
+		app.audit(r, action, target, datastruct.AuditBlocked, "own account")
+		http.Error(w, "Cannot disable your own account", http.StatusConflict)
+		return
+	}
+
+	user, err := app.UserService.SetDisabled(user.ID, disabled)
+	if err == nil && disabled {
+		err = app.SessionService.RevokeAll(user.ID)
+	}
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, action, target, datastruct.AuditFailure, err.Error())
+		http.Error(w, "error updating user", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, action, target, datastruct.AuditSuccess, "")
+
+	app.sendUserAccount(w, user)
+}
+
+// ResetUserPassword replaces the password of the user with the given id with a temporary one sent to them
+// by email, and revokes their sessions.
+func (app *App) ResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+	target := strconv.Itoa(int(user.ID))
+
+	user, password, err := app.UserService.ResetPassword(user.ID)
+	if err == nil {
+		err = app.SessionService.RevokeAll(user.ID)
+	}
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditPasswordReset, target, datastruct.AuditFailure, err.Error())
+		http.Error(w, "error resetting the password", http.StatusInternalServerError)
+		return
+	}
+
+	email := dto.Email{
+		From:    app.Config.Email.User,
+		To:      user.Email,
+		Subject: "Your password was reset",
+		Body: fmt.Sprintf("Hi %s,<br><br>Your password was reset by an administrator. "+
+			"Your temporary password is <b>%s</b>, you have been logged out of all your devices.", user.FirstName, password),
+	}
+	if err := app.EmailService.SendEmail(email); err != nil {
+		logrus.Errorf("cannot send the password reset email to user %d: %v", user.ID, err)
+		app.audit(r, auditPasswordReset, target, datastruct.AuditFailure, "email not sent")
+		http.Error(w, "Password reset but the email could not be sent", http.StatusBadGateway)
+		return
+	}
+	app.audit(r, auditPasswordReset, target, datastruct.AuditSuccess, "")
+
+	app.sendUserAccount(w, user)
+}
+
+// SetUserRole changes the role of the user with the given id. Admins can only grant the roles whose
+// permissions they hold themselves.
+func (app *App) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+	target := strconv.Itoa(int(user.ID))
+
+	var req dto.SetRoleRequest
+	err := common.DecodeJSONBody(w, r, &req)
+	if err != nil {
+		common.HandleDecodeError(w, err)
+		return
+	}
+	role := datastruct.Role(req.Role)
+	if !app.Authorizer.IsRole(role) {
+		http.Error(w, fmt.Sprintf("Unknown role %q", req.Role), http.StatusBadRequest)
+		return
+	}
+
+	actor := r.Context().Value(ctxKeyUser).(*datastruct.User)
+	if actor.ID == user.ID {
+		app.audit(r, auditRoleChange, target, datastruct.AuditBlocked, "own account")
+		http.Error(w, "Cannot change your own role", http.StatusConflict)
+		return
+	}
+	if !app.holdsPermissionsOf(actor, role) {
+		app.audit(r, auditRoleChange, target, datastruct.AuditBlocked, fmt.Sprintf("role %s not grantable", role))
+		http.Error(w, "Cannot grant a role with permissions you lack", http.StatusForbidden)
+		return
+	}
+
+	previous := user.Role
+	user, err = app.UserService.SetRole(user.ID, role)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditRoleChange, target, datastruct.AuditFailure, err.Error())
+		http.Error(w, "error updating user", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditRoleChange, target, datastruct.AuditSuccess, fmt.Sprintf("%s to %s", previous, role))
+
+	app.sendUserAccount(w, user)
+}
+
+// ListUserFiles returns the subfolders and files of a folder of the user with the given id, the root folder
+// unless ?folder= is given.
+func (app *App) ListUserFiles(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+
+	folder := r.URL.Query().Get("folder")
+	if folder == "" {
+		folder = datastruct.RootFolder
+	}
+	folders, files, err := app.FileService.ListFolder(user.ID, folder)
+	if err == service.ErrFolderNotFound || err == service.ErrFolderBadRequest {
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditAdminFileList, strconv.Itoa(int(user.ID)), datastruct.AuditSuccess, folder)
+
+	res := dto.AdminUserFilesResponse{
+		UserID:  user.ID,
+		Folder:  folder,
+		Folders: make([]string, len(folders)),
+		Files:   make([]dto.GetFileResponse, len(files)),
+	}
+	for i, f := range folders {
+		res.Folders[i] = f.Path
+	}
+	for i, f := range files {
+		res.Files[i] = app.fileResponse(f)
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+// DeleteUserFile deletes the file with the given file id of the user with the given id.
+func (app *App) DeleteUserFile(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.getManagedUser(w, r)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "fileId")
+	detail := fmt.Sprintf("of user %d", user.ID)
+
+	// Expired files can still be deleted before being purged
+	metaFile, err := app.FileService.Get(id)
+	if err == service.ErrFileNotFound {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != service.ErrFileExpired {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if metaFile.UserID != user.ID {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	err = app.FileService.Delete(metaFile)
+	if err == service.ErrFileImmutable {
+		app.audit(r, auditFileDelete, id, datastruct.AuditBlocked, detail+", "+err.Error())
+		http.Error(w, "File is retained or under legal hold", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		app.audit(r, auditFileDelete, id, datastruct.AuditFailure, detail+", "+err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditFileDelete, id, datastruct.AuditSuccess, detail)
+
+	common.EncodeJSONAndSend(w, dto.DeleteFileResponse{
+		ID: id,
+	})
+}
+
+// getTargetUser loads the user of the id URL param, writing the error response if it cannot.
+func (app *App) getTargetUser(w http.ResponseWriter, r *http.Request) (*datastruct.User, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := app.UserService.GetUser(uint(id))
+	if err == gorm.ErrRecordNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		logrus.Errorf(err.Error())
+		http.Error(w, "error getting user", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// getManagedUser loads the user of the id URL param like getTargetUser, refusing the users whose role
+// has permissions the admin lacks, so that they cannot take over more privileged accounts.
+func (app *App) getManagedUser(w http.ResponseWriter, r *http.Request) (*datastruct.User, bool) {
+	user, ok := app.getTargetUser(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	actor := r.Context().Value(ctxKeyUser).(*datastruct.User)
+	if !app.holdsPermissionsOf(actor, user.Role) {
+		app.audit(r, auditAccessDenied, r.URL.Path, datastruct.AuditBlocked, fmt.Sprintf("role %s cannot manage role %s", actor.Role, user.Role))
+		http.Error(w, "Cannot manage a user with permissions you lack", http.StatusForbidden)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// holdsPermissionsOf reports whether the user is granted every permission of the role.
+func (app *App) holdsPermissionsOf(user *datastruct.User, role datastruct.Role) bool {
+	for _, perm := range app.Authorizer.Permissions(role) {
+		if !app.Authorizer.Can(user.Role, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// sendUserAccount sends the account of the user along with their storage usage.
+func (app *App) sendUserAccount(w http.ResponseWriter, user *datastruct.User) {
+	usage, err := app.UserService.GetUsage([]uint{user.ID})
+	if err != nil {
+		logrus.Errorf(err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	common.EncodeJSONAndSend(w, adminUserResponse(*user, usage[user.ID]))
+}
+
+// parseUserFilter reads the user filters from the query parameters.
+func parseUserFilter(r *http.Request) (repository.UserFilter, error) {
+	query := r.URL.Query()
+	filter := repository.UserFilter{
+		Query: query.Get("q"),
+		Role:  datastruct.Role(query.Get("role")),
+	}
+
+	if verified := query.Get("verified"); verified != "" {
+		v, err := strconv.ParseBool(verified)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid verified filter")
+		}
+		filter.Verified = &v
+	}
+
+	if disabled := query.Get("disabled"); disabled != "" {
+		v, err := strconv.ParseBool(disabled)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid disabled filter")
+		}
+		filter.Disabled = &v
+	}
+
+	return filter, nil
+}
+
+func adminUserResponse(user datastruct.User, usage repository.UserUsage) dto.AdminUserResponse {
+	return dto.AdminUserResponse{
+		ID:        user.ID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Role:      string(user.Role),
+		Verified:  user.Verified,
+		Disabled:  user.Disabled,
+		LegalHold: user.LegalHold,
+		CreatedAt: user.CreatedAt,
+		DeleteAt:  user.DeleteAt,
+		Files:     usage.Files,
+		Size:      usage.Size,
+	}
+}
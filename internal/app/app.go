@@ -3,13 +3,32 @@ package app
 import (
 	"dryve/internal/config"
 	"dryve/internal/service"
+	"sync"
 )
 
 type App struct {
-	Config       config.Config
-	FileService  service.FileService
-	UserService  service.UserService
-	EmailService service.EmailService
+	Config         config.Config
+	FileService    service.FileService
+	UserService    service.UserService
+	SessionService service.SessionService
+	Authorizer     service.Authorizer
+	EmailService   service.EmailService
+	AuditService   service.AuditService
+
+	WebhookService   service.WebhookService
+	MultipartService service.MultipartService
+	StoragePool      service.StoragePool
+	Replicator       service.Replicator
+	ImportService    service.ImportService
+	EventStream      service.EventStream
+	ChangeJournal    service.ChangeJournal
+	ExportService    service.ExportService
+
+	DeletionWorker        service.DeletionWorker
+	AccountDeletionWorker service.AccountDeletionWorker
+
+	// WebDAV lock systems by user ID
+	davLocks sync.Map
 }
 
 func NewApp(config config.Config) *App {
@@ -28,7 +47,72 @@ func (a *App) WithUserService(s service.UserService) *App {
 	return a
 }
 
+func (a *App) WithSessionService(s service.SessionService) *App {
+	a.SessionService = s
+	return a
+}
+
+func (a *App) WithAuthorizer(z service.Authorizer) *App {
+	a.Authorizer = z
+	return a
+}
+
 func (a *App) WithEmailService(s service.EmailService) *App {
 	a.EmailService = s
 	return a
 }
+
+func (a *App) WithAuditService(s service.AuditService) *App {
+	a.AuditService = s
+	return a
+}
+
+func (a *App) WithWebhookService(s service.WebhookService) *App {
+	a.WebhookService = s
+	return a
+}
+
+func (a *App) WithMultipartService(s service.MultipartService) *App {
+	a.MultipartService = s
+	return a
+}
+
+func (a *App) WithStoragePool(p service.StoragePool) *App {
+	a.StoragePool = p
+	return a
+}
+
+func (a *App) WithReplicator(r service.Replicator) *App {
+	a.Replicator = r
+	return a
+}
+
+func (a *App) WithImportService(s service.ImportService) *App {
+	a.ImportService = s
+	return a
+}
+
+func (a *App) WithEventStream(s service.EventStream) *App {
+	a.EventStream = s
+	return a
+}
+
+func (a *App) WithChangeJournal(j service.ChangeJournal) *App {
+	a.ChangeJournal = j
+	return a
+}
+
+func (a *App) WithExportService(s service.ExportService) *App {
+	a.ExportService = s
+	return a
+}
+
+func (a *App) WithDeletionWorker(w service.DeletionWorker) *App {
+	a.DeletionWorker = w
+	return a
+}
+
+func (a *App) WithAccountDeletionWorker(w service.AccountDeletionWorker) *App {
+	a.AccountDeletionWorker = w
+	return a
+}
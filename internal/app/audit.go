@@ -0,0 +1,189 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"dryve/pkg/dto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// Audited actions
+const (
+	auditLogin               = "auth.login"
+	auditRegister            = "auth.register"
+	auditRefresh             = "auth.refresh"
+	auditLogout              = "auth.logout"
+	auditAccessDenied        = "auth.denied"
+	auditVerifyEmail         = "user.verify"
+	auditFileUpload          = "file.upload"
+	auditFileDownload        = "file.download"
+	auditFileDelete          = "file.delete"
+	auditFileMove            = "file.move"
+	auditFileRangeDelete     = "file.delete_range"
+	auditFileImport          = "file.import"
+	auditTokenCreate         = "token.create"
+	auditTokenDelete         = "token.delete"
+	auditAccessKeyCreate     = "access_key.create"
+	auditAccessKeyDelete     = "access_key.delete"
+	auditVolumeDrain         = "storage.volume.drain"
+	auditSettingsUpdate      = "user.settings.update"
+	auditUserExport          = "user.export"
+	auditUserExportDownload  = "user.export.download"
+	auditAccountDelete       = "user.delete"
+	auditAccountDeleteCancel = "user.delete.cancel"
+	auditUserDisable         = "user.disable"
+	auditUserEnable          = "user.enable"
+	auditPasswordReset       = "user.password.reset"
+	auditRoleChange          = "user.role"
+	auditAdminUserList       = "admin.user.list"
+	auditAdminUserView       = "admin.user.view"
+	auditAdminFileList       = "admin.file.list"
+)
+
+// audit records an action performed by the user of the request.
+func (app *App) audit(r *http.Request, action, target string, outcome datastruct.AuditOutcome, detail string) {
+	var actorID uint
+	if user, ok := r.Context().Value(ctxKeyUser).(*datastruct.User); ok {
+		actorID = user.ID
+	}
+	app.auditActor(r, actorID, action, target, outcome, detail)
+}
+
+// auditActor records an action performed by the given user, zero if anonymous.
+func (app *App) auditActor(r *http.Request, actorID uint, action, target string, outcome datastruct.AuditOutcome, detail string) {
+	entry := datastruct.AuditEntry{
+		Action:    action,
+		ActorID:   actorID,
+		IP:        r.RemoteAddr,
+		RequestID: middleware.GetReqID(r.Context()),
+		Target:    target,
+		Outcome:   outcome,
+		Detail:    detail,
+	}
+
+	if err := app.AuditService.Record(entry); err != nil {
+		logrus.Errorf("cannot record audit entry %s on %s: %v", action, target, err)
+	}
+}
+
+// SearchAudit returns a page of the audit entries matching the query filters, newest first.
+func (app *App) SearchAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+
+	entries, total, err := app.AuditService.Search(filter, offset, limit)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var res dto.SearchAuditResponse
+	res.Count = len(entries)
+	res.Total = total
+	res.Offset = offset
+	res.Entries = make([]dto.AuditEntryResponse, res.Count)
+	for i, entry := range entries {
+		res.Entries[i] = auditEntryResponse(entry)
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+// ExportAudit streams all the audit entries matching the query filters as JSON lines, oldest first.
+func (app *App) ExportAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=audit.jsonl")
+
+	enc := json.NewEncoder(w)
+	err = app.AuditService.Export(filter, func(entry datastruct.AuditEntry) error {
+		return enc.Encode(auditEntryResponse(entry))
+	})
+	if err != nil {
+		// Headers are likely sent already, the truncated export is all we can do
+		logrus.Errorf("cannot export audit log: %v", err)
+	}
+}
+
+// parseAuditFilter reads the audit filters from the query parameters.
+// Dates are in the YYYY-MM-DD format, both inclusive.
+func parseAuditFilter(r *http.Request) (repository.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := repository.AuditFilter{
+		Action:  query.Get("action"),
+		Target:  query.Get("target"),
+		Outcome: datastruct.AuditOutcome(query.Get("outcome")),
+	}
+
+	if actor := query.Get("actor"); actor != "" {
+		id, err := strconv.Atoi(actor)
+		if err != nil || id <= 0 {
+			return filter, fmt.Errorf("Invalid actor id")
+		}
+		filter.ActorID = uint(id)
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, err := common.ParseAndValidateDate(from)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid date format")
+		}
+		filter.From = t
+	}
+
+	if to := query.Get("to"); to != "" {
+		t, err := common.ParseAndValidateDate(to)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid date format")
+		}
+		filter.To = t.AddDate(0, 0, 1)
+	}
+
+	return filter, nil
+}
+
+func auditEntryResponse(entry datastruct.AuditEntry) dto.AuditEntryResponse {
+	return dto.AuditEntryResponse{
+		ID:        entry.ID,
+		Time:      entry.CreatedAt,
+		Action:    entry.Action,
+		ActorID:   entry.ActorID,
+		IP:        entry.IP,
+		RequestID: entry.RequestID,
+		Target:    entry.Target,
+		Outcome:   string(entry.Outcome),
+		Detail:    entry.Detail,
+	}
+}
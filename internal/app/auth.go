@@ -2,14 +2,18 @@ package app
 
 import (
 	"context"
-	"dryve/internal/dto"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
 	"dryve/internal/utils"
+	"dryve/pkg/dto"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type contextKey string
@@ -20,6 +24,8 @@ var ctxKeyUser contextKey = "user"
 // Context Keys for JWT claims basic info
 var ctxKeyUserId contextKey = "user_id"
 var ctxKeyUserEmail contextKey = "user_email"
+var ctxKeyTokenID contextKey = "token_id"
+var ctxKeyTokenExpiresAt contextKey = "token_expires_at"
 
 func (app *App) Login(w http.ResponseWriter, r *http.Request) {
 	var l dto.LoginRequest
@@ -31,25 +37,93 @@ func (app *App) Login(w http.ResponseWriter, r *http.Request) {
 
 	user, err := app.UserService.GetUserByEmail(l.Email)
 	if err != nil {
+		app.auditActor(r, 0, auditLogin, l.Email, datastruct.AuditFailure, "unknown email")
 		http.Error(w, "Wrong username or password", http.StatusUnauthorized)
 		return
 	}
 
 	if !utils.VerifyPassword(user.Password, l.Password) {
+		app.auditActor(r, user.ID, auditLogin, l.Email, datastruct.AuditFailure, "wrong password")
 		http.Error(w, "Wrong username or password", http.StatusUnauthorized)
 		return
 	}
 
-	jwtStr, err := utils.GenerateJWT(app.Config.JWT, *user)
+	if user.Disabled {
+		app.auditActor(r, user.ID, auditLogin, l.Email, datastruct.AuditBlocked, "user disabled")
+		http.Error(w, "User disabled", http.StatusForbidden)
+		return
+	}
+
+	session, err := app.SessionService.Create(*user)
 	if err != nil {
-		logrus.Errorf("cannot create jwt with error '%v'", err)
 		http.Error(w, "Cannot create JWT", http.StatusInternalServerError)
 		return
 	}
 
-	EncodeJSONAndSend(w, dto.LoginResponse{
-		Token: jwtStr,
-	})
+	app.auditActor(r, user.ID, auditLogin, l.Email, datastruct.AuditSuccess, "")
+
+	EncodeJSONAndSend(w, loginResponse(session))
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// Each refresh token can only be used once, presenting a used one again revokes its session.
+func (app *App) Refresh(w http.ResponseWriter, r *http.Request) {
+	var rr dto.RefreshRequest
+	err := DecodeJSONBody(w, r, &rr)
+	if err != nil {
+		HandleDecodeError(w, err)
+		return
+	}
+
+	session, err := app.SessionService.Refresh(rr.RefreshToken)
+	target := strconv.Itoa(int(session.UserID))
+	if err == service.ErrSessionReused {
+		app.auditActor(r, session.UserID, auditRefresh, target, datastruct.AuditBlocked, err.Error())
+		http.Error(w, "Refresh token reused, session revoked", http.StatusUnauthorized)
+		return
+	}
+	if err == service.ErrSessionInvalid {
+		app.auditActor(r, session.UserID, auditRefresh, target, datastruct.AuditFailure, err.Error())
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Cannot refresh the session", http.StatusInternalServerError)
+		return
+	}
+
+	EncodeJSONAndSend(w, loginResponse(session))
+}
+
+// Logout revokes the access token of the request and its refresh tokens, or every session
+// of the user with ?all=true.
+func (app *App) Logout(w http.ResponseWriter, r *http.Request) {
+	id := r.Context().Value(ctxKeyUserId).(uint)
+	jti, _ := r.Context().Value(ctxKeyTokenID).(string)
+	expiresAt, _ := r.Context().Value(ctxKeyTokenExpiresAt).(time.Time)
+	all := r.URL.Query().Get("all") == "true"
+
+	detail := ""
+	if all {
+		detail = "all sessions"
+	}
+	if err := app.SessionService.Logout(id, jti, expiresAt, all); err != nil {
+		app.auditActor(r, id, auditLogout, strconv.Itoa(int(id)), datastruct.AuditFailure, err.Error())
+		http.Error(w, "Cannot log out", http.StatusInternalServerError)
+		return
+	}
+	app.auditActor(r, id, auditLogout, strconv.Itoa(int(id)), datastruct.AuditSuccess, detail)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loginResponse(session service.Session) dto.LoginResponse {
+	return dto.LoginResponse{
+		Token:            session.AccessToken,
+		ExpiresAt:        session.AccessExpiresAt,
+		RefreshToken:     session.RefreshToken,
+		RefreshExpiresAt: session.RefreshExpiresAt,
+	}
 }
 
 func (app *App) Register(w http.ResponseWriter, r *http.Request) {
@@ -62,6 +136,7 @@ func (app *App) Register(w http.ResponseWriter, r *http.Request) {
 
 	user, err := app.UserService.GetUserByEmail(rr.Email)
 	if err == nil && user.Email != "" {
+		app.auditActor(r, 0, auditRegister, rr.Email, datastruct.AuditFailure, "email already registered")
 		http.Error(w, "This email has already been registered", http.StatusForbidden)
 		return
 	}
@@ -75,9 +150,11 @@ func (app *App) Register(w http.ResponseWriter, r *http.Request) {
 	user, err = app.UserService.CreateUser(rr)
 	if err != nil {
 		logrus.Errorf("cannot create user with error '%v'", err)
+		app.auditActor(r, 0, auditRegister, rr.Email, datastruct.AuditFailure, err.Error())
 		http.Error(w, "Cannot register user", http.StatusInternalServerError)
 		return
 	}
+	app.auditActor(r, user.ID, auditRegister, rr.Email, datastruct.AuditSuccess, "")
 
 	w.Write([]byte(fmt.Sprintf("Succesfully created user %s %s [%s] with ID %d", user.FirstName, user.LastName, user.Email, user.ID)))
 }
@@ -98,12 +175,35 @@ func (app *App) JWTMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		ctx := r.Context()
-
 		// Need to first assert the accurate dynamic type of the interface value and then to desired.
 		// float64 is because is default for json encoding numbers.
-		ctx = context.WithValue(ctx, ctxKeyUserId, uint(claims["UserID"].(float64)))
+		userID := uint(claims["UserID"].(float64))
+
+		// Tokens revoked by a logout or a refresh token reuse before their expiration,
+		// or issued before all the sessions of the user were revoked, without a jti if too old
+		jti, _ := claims["jti"].(string)
+		var issuedAt time.Time
+		if iat, ok := claims["iat"].(float64); ok {
+			issuedAt = time.Unix(int64(iat), 0)
+		}
+		revoked, err := app.SessionService.IsRevoked(userID, jti, issuedAt)
+		if err != nil {
+			logrus.Errorf("cannot check the revocation of JWT %s: %v", jti, err)
+			http.Error(w, "cannot verify JWT", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(w, "JWT revoked", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, ctxKeyUserId, userID)
 		ctx = context.WithValue(ctx, ctxKeyUserEmail, claims["UserEmail"])
+		ctx = context.WithValue(ctx, ctxKeyTokenID, jti)
+		if exp, ok := claims["exp"].(float64); ok {
+			ctx = context.WithValue(ctx, ctxKeyTokenExpiresAt, time.Unix(int64(exp), 0))
+		}
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
@@ -116,6 +216,11 @@ func (app *App) AuthMiddleware(next http.Handler) http.Handler {
 		id := r.Context().Value(ctxKeyUserId).(uint)
 
 		user, err := app.UserService.GetUser(id)
+		if err == gorm.ErrRecordNotFound {
+			// Deleted since the token was issued
+			http.Error(w, "user not found", http.StatusUnauthorized)
+			return
+		}
 		if err != nil {
 			logrus.Errorf(err.Error())
 			http.Error(w, "error getting user", http.StatusInternalServerError)
@@ -126,6 +231,10 @@ func (app *App) AuthMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "user not verified", http.StatusUnauthorized)
 			return
 		}
+		if user.Disabled {
+			http.Error(w, "user disabled", http.StatusForbidden)
+			return
+		}
 
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, ctxKeyUser, user)
@@ -136,6 +245,37 @@ func (app *App) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(hfn)
 }
 
+// RequirePermission only lets the users whose role is granted the permission through, it must follow AuthMiddleware.
+func (app *App) RequirePermission(perm datastruct.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hfn := func(w http.ResponseWriter, r *http.Request) {
+			user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+			if !app.Authorizer.Can(user.Role, perm) {
+				app.audit(r, auditAccessDenied, r.URL.Path, datastruct.AuditBlocked, fmt.Sprintf("role %s lacks %s", user.Role, perm))
+				http.Error(w, fmt.Sprintf("%s permission required", perm), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(hfn)
+	}
+}
+
+// methodPermission returns the permission on files required by the method of a request of the
+// WebDAV, S3 or presigned endpoints, which do not go through RequirePermission.
+func methodPermission(method string) datastruct.Permission {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		return datastruct.PermFilesRead
+	case http.MethodDelete:
+		return datastruct.PermFilesDelete
+	default:
+		return datastruct.PermFilesWrite
+	}
+}
+
 func (app *App) EmailVerifyStep1(w http.ResponseWriter, r *http.Request) {
 	to := r.Context().Value(ctxKeyUserEmail).(string)
 	id := r.Context().Value(ctxKeyUserId).(uint)
@@ -192,15 +332,18 @@ func (app *App) EmailVerifyStep2(w http.ResponseWriter, r *http.Request) {
 
 	if code != user.EmailCode {
 		logrus.Errorf("wrong verification code %s", code)
+		app.auditActor(r, user.ID, auditVerifyEmail, user.Email, datastruct.AuditFailure, "wrong verification code")
 		http.Error(w, "wrong verification code", http.StatusUnauthorized)
 		return
 	}
 
 	if err = app.UserService.VerifyUser(uint(id)); err != nil {
 		logrus.Errorf(err.Error())
+		app.auditActor(r, user.ID, auditVerifyEmail, user.Email, datastruct.AuditFailure, err.Error())
 		http.Error(w, "error verifying user", http.StatusInternalServerError)
 		return
 	}
+	app.auditActor(r, user.ID, auditVerifyEmail, user.Email, datastruct.AuditSuccess, "")
 
 	w.Write([]byte(fmt.Sprintf("Email %s succesfully verified", user.Email)))
 }
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultChangesPageSize = 500
+	maxChangesPageSize     = 1000
+)
+
+// ListChanges returns the changes of the files and folders of the user following the cursor, oldest first.
+// Without cursor, it returns the cursor of the current position. Expired cursors return 410 Gone,
+// the client having to list all its files again before following the changes from a new cursor.
+func (app *App) ListChanges(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultChangesPageSize
+	}
+	if limit > maxChangesPageSize {
+		limit = maxChangesPageSize
+	}
+
+	page, err := app.ChangeJournal.List(user.ID, r.URL.Query().Get("cursor"), limit)
+	if err == service.ErrChangesBadRequest {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err == service.ErrCursorExpired {
+		http.Error(w, "Cursor expired, do a full resync", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	res := dto.ListChangesResponse{
+		Changes: make([]dto.ChangeResponse, len(page.Changes)),
+		Cursor:  page.Cursor,
+		HasMore: page.HasMore,
+	}
+	for i, change := range page.Changes {
+		res.Changes[i] = dto.ChangeResponse{
+			ID:      change.ID,
+			Time:    change.CreatedAt,
+			Kind:    string(change.Kind),
+			Op:      string(change.Op),
+			FileID:  change.FileUUID,
+			Path:    change.Path,
+			OldPath: change.OldPath,
+			Size:    change.Size,
+			MD5:     change.MD5,
+		}
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
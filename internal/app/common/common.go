@@ -1,12 +1,14 @@
 package common
 
 import (
+	"dryve/internal/utils"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -111,3 +113,45 @@ func HandleDecodeError(w http.ResponseWriter, err error) {
 func ParseAndValidateDate(date string) (time.Time, error) {
 	return time.Parse(acceptedTimeFormat, date)
 }
+
+// ParseExpiry returns the expiration time given either as seconds from now
+// or as an RFC 3339 timestamp, nil if none is given.
+func ParseExpiry(expiresIn, expiresAt string, now time.Time) (*time.Time, error) {
+	switch {
+	case expiresIn != "" && expiresAt != "":
+		return nil, fmt.Errorf("only one of expires_in and expires_at can be set")
+
+	case expiresIn != "":
+		secs, err := strconv.ParseInt(expiresIn, 10, 64)
+		if err != nil || secs <= 0 {
+			return nil, fmt.Errorf("expires_in must be a positive number of seconds")
+		}
+		t := now.Add(time.Duration(secs) * time.Second)
+		return &t, nil
+
+	case expiresAt != "":
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("expires_at must be an RFC 3339 timestamp")
+		}
+		if !t.After(now) {
+			return nil, fmt.Errorf("expires_at must be in the future")
+		}
+		return &t, nil
+	}
+
+	return nil, nil
+}
+
+// ContentDisposition returns the Content-Disposition header of a file (RFC 6266), with
+// an ASCII fallback filename for old clients and the UTF-8 one encoded as in RFC 5987.
+func ContentDisposition(disposition, name string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback, utils.URIEncode(name, true))
+}
@@ -202,3 +202,110 @@ func TestEncodeJSONAndSend(t *testing.T) {
 		})
 	}
 }
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	inOneHour := now.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresIn string
+		expiresAt string
+		want      *time.Time
+		wantErr   bool
+	}{
+		{
+			name: "No expiry",
+			want: nil,
+		},
+		{
+			name:      "Expires in seconds",
+			expiresIn: "3600",
+			want:      &inOneHour,
+		},
+		{
+			name:      "Expires at timestamp",
+			expiresAt: "2023-03-01T13:00:00Z",
+			want:      &inOneHour,
+		},
+		{
+			name:      "Both set",
+			expiresIn: "3600",
+			expiresAt: "2023-03-01T13:00:00Z",
+			wantErr:   true,
+		},
+		{
+			name:      "Negative seconds",
+			expiresIn: "-1",
+			wantErr:   true,
+		},
+		{
+			name:      "Invalid seconds",
+			expiresIn: "1h",
+			wantErr:   true,
+		},
+		{
+			name:      "Past timestamp",
+			expiresAt: "2023-03-01T11:00:00Z",
+			wantErr:   true,
+		},
+		{
+			name:      "Invalid timestamp",
+			expiresAt: "2023-03-01",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExpiry(tt.expiresIn, tt.expiresAt, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseExpiry() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("ParseExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name        string
+		disposition string
+		filename    string
+		want        string
+	}{
+		{
+			name:        "ASCII name",
+			disposition: "attachment",
+			filename:    "report.pdf",
+			want:        `attachment; filename="report.pdf"; filename*=UTF-8''report.pdf`,
+		},
+		{
+			name:        "Spaces",
+			disposition: "inline",
+			filename:    "my report.pdf",
+			want:        `inline; filename="my report.pdf"; filename*=UTF-8''my%20report.pdf`,
+		},
+		{
+			name:        "Non-ASCII name",
+			disposition: "attachment",
+			filename:    "café.txt",
+			want:        `attachment; filename="caf_.txt"; filename*=UTF-8''caf%C3%A9.txt`,
+		},
+		{
+			name:        "Header injection",
+			disposition: "attachment",
+			filename:    "a\"\r\nSet-Cookie: x=y;.txt",
+			want:        `attachment; filename="a___Set-Cookie: x=y;.txt"; filename*=UTF-8''a%22%0D%0ASet-Cookie%3A%20x%3Dy%3B.txt`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContentDisposition(tt.disposition, tt.filename); got != tt.want {
+				t.Errorf("ContentDisposition() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// Type of the WebSocket messages keeping idle connections open.
+const streamKeepalive = "keepalive"
+
+// Max duration of a write to a stream client.
+const streamWriteTimeout = 10 * time.Second
+
+// StreamEvents pushes the created, updated and deleted file events of the user as they happen,
+// over WebSocket when the connection is upgraded, or else as Server-Sent Events.
+// Clients resume after the event given in the Last-Event-ID header or the lastEventId parameter.
+func (app *App) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		app.streamWebSocket(w, r, user, lastEventID)
+		return
+	}
+	app.streamSSE(w, r, user, lastEventID)
+}
+
+// streamSSE sends the events as a text/event-stream until the client disconnects or falls behind.
+func (app *App) streamSSE(w http.ResponseWriter, r *http.Request, user *datastruct.User, lastEventID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := app.EventStream.Subscribe(user.ID, lastEventID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disable the buffering of the reverse proxies, like nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if sub.Resync {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", service.StreamResync)
+	}
+	for _, e := range sub.Backlog {
+		if err := writeSSE(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(time.Duration(app.Config.Stream.KeepaliveSecs) * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, e); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSE(w http.ResponseWriter, e service.StreamEvent) error {
+	data, err := json.Marshal(e.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Event.Type, data)
+	return err
+}
+
+// streamWebSocket sends the events as JSON messages until the client disconnects or falls behind.
+// Origins are not checked, as the stream is authenticated by tokens and not by cookies.
+func (app *App) streamWebSocket(w http.ResponseWriter, r *http.Request, user *datastruct.User, lastEventID string) {
+	server := websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			sub := app.EventStream.Subscribe(user.ID, lastEventID)
+			defer sub.Close()
+
+			// Incoming messages are ignored, reading only tells when the client leaves
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				var msg string
+				for websocket.Message.Receive(ws, &msg) == nil {
+				}
+			}()
+
+			send := func(msg dto.StreamMessage) bool {
+				ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+				if err := websocket.JSON.Send(ws, msg); err != nil {
+					logrus.Debugf("cannot send event to user %d: %v", user.ID, err)
+					return false
+				}
+				return true
+			}
+
+			if sub.Resync && !send(dto.StreamMessage{Type: service.StreamResync}) {
+				return
+			}
+			for _, e := range sub.Backlog {
+				if !send(streamMessage(e)) {
+					return
+				}
+			}
+
+			keepalive := time.NewTicker(time.Duration(app.Config.Stream.KeepaliveSecs) * time.Second)
+			defer keepalive.Stop()
+
+			for {
+				select {
+				case <-closed:
+					return
+				case e, ok := <-sub.C:
+					if !ok || !send(streamMessage(e)) {
+						return
+					}
+				case <-keepalive.C:
+					if !send(dto.StreamMessage{Type: streamKeepalive}) {
+						return
+					}
+				}
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func streamMessage(e service.StreamEvent) dto.StreamMessage {
+	return dto.StreamMessage{
+		ID:    e.ID,
+		Type:  e.Event.Type,
+		Event: &e.Event,
+	}
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RequestExport starts the export of all the data of the user, built in background.
+// The download link of the archive is sent by email once done.
+func (app *App) RequestExport(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	job, err := app.ExportService.Request(*user)
+	if err == service.ErrExportInProgress {
+		app.audit(r, auditUserExport, "", datastruct.AuditFailure, err.Error())
+		http.Error(w, "An export is already in progress", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.audit(r, auditUserExport, "", datastruct.AuditFailure, err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditUserExport, strconv.Itoa(int(job.ID)), datastruct.AuditSuccess, "")
+
+	w.WriteHeader(http.StatusAccepted)
+	common.EncodeJSONAndSend(w, exportJobResponse(job))
+}
+
+// GetExport returns the status of the export with the given id, which must belong to the user.
+func (app *App) GetExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.getExport(w, r)
+	if !ok {
+		return
+	}
+
+	common.EncodeJSONAndSend(w, exportJobResponse(job))
+}
+
+// DownloadExport returns the archive of the export with the given id, which must belong to the user.
+func (app *App) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.getExport(w, r)
+	if !ok {
+		return
+	}
+	target := strconv.Itoa(int(job.ID))
+
+	f, err := app.ExportService.Open(job)
+	if err == service.ErrExportNotReady {
+		http.Error(w, "Export not ready", http.StatusConflict)
+		return
+	}
+	if err == service.ErrExportExpired {
+		http.Error(w, "Export expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		app.audit(r, auditUserExportDownload, target, datastruct.AuditFailure, err.Error())
+		http.Error(w, "Internal error loading export", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	app.audit(r, auditUserExportDownload, target, datastruct.AuditSuccess, "")
+
+	w.Header().Set("Content-Disposition", common.ContentDisposition(dispositionAttachment, fmt.Sprintf("dryve-export-%d.zip", job.ID)))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", *job.FinishedAt, f)
+}
+
+// getExport loads the export of the id URL param, writing the error response if it cannot.
+func (app *App) getExport(w http.ResponseWriter, r *http.Request) (datastruct.ExportJob, bool) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid export id", http.StatusBadRequest)
+		return datastruct.ExportJob{}, false
+	}
+
+	job, err := app.ExportService.Get(user.ID, uint(id))
+	if err == service.ErrExportNotFound {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return job, false
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return job, false
+	}
+
+	return job, true
+}
+
+func exportJobResponse(job datastruct.ExportJob) dto.ExportJobResponse {
+	return dto.ExportJobResponse{
+		ID:         job.ID,
+		Status:     string(job.Status),
+		Size:       job.Size,
+		Files:      job.Files,
+		Skipped:    job.Skipped,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+		ExpiresAt:  job.ExpiresAt,
+	}
+}
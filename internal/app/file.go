@@ -2,22 +2,29 @@ package app
 
 import (
 	"dryve/internal/app/common"
-	"dryve/internal/dto"
+	"dryve/internal/datastruct"
 	"dryve/internal/service"
+	"dryve/internal/utils"
+	"dryve/pkg/dto"
 	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
 )
 
 // UploadFile handles the upload file endpoint.
 // It parses the multipart form, saves the file to disk, and creates a database entry for the file.
 func (app *App) UploadFile(w http.ResponseWriter, r *http.Request) {
-	tooBigError := fmt.Sprintf("Max file size is %d MB", app.Config.Limits.MaxFileSize>>20)
+	maxFileSize := app.maxUploadSize(r)
+	tooBigError := fmt.Sprintf("Max file size is %d bytes", maxFileSize)
 
 	// Parse the multipart form with a max file size
-	err := r.ParseMultipartForm(app.Config.Limits.MaxFileSize)
+	err := r.ParseMultipartForm(maxFileSize)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error: %s\n%s", err.Error(), tooBigError), http.StatusBadRequest)
 		return
@@ -31,59 +38,297 @@ func (app *App) UploadFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	if fileHeader.Size > app.Config.Limits.MaxFileSize {
+	if fileHeader.Size > maxFileSize {
 		http.Error(w, tooBigError, http.StatusBadRequest)
 		return
 	}
 
-	metaFile, err := app.FileService.Upload(file, fileHeader)
+	// Validate the optional expiration against the max TTL and the retention of the user role
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+	expiresAt, retainUntil, err := app.fileLifetime(user, r.FormValue("expires_in"), r.FormValue("expires_at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The folder of the file is created along with its missing parents
+	folder := r.FormValue("folder")
+	name := fileHeader.Filename
+	// Presigned uploads go to the signed location, which the form cannot change
+	presigned, isPresigned := r.Context().Value(ctxKeyPresignedURL).(utils.PresignedURL)
+	if isPresigned && presigned.Folder != "" {
+		if f := r.PostFormValue("folder"); f != "" && f != presigned.Folder {
+			http.Error(w, "Folder is bound by the presigned URL", http.StatusForbidden)
+			return
+		}
+		folder = presigned.Folder
+	}
+	if isPresigned && presigned.Name != "" {
+		name = presigned.Name
+	}
+	if folder == "" {
+		folder = datastruct.RootFolder
+	}
+	if !strings.HasPrefix(folder, "/") || path.Clean(folder) != folder {
+		http.Error(w, "Folder must be an absolute path", http.StatusBadRequest)
+		return
+	}
+	err = app.FileService.CreateFolders(user.ID, folder)
+	if err == service.ErrFolderExists {
+		http.Error(w, "A file exists at the folder path", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// A named presigned URL uploads a single file, never replacing one
+	if isPresigned && presigned.Name != "" {
+		_, err := app.FileService.GetByPath(user.ID, folder, name)
+		if err == nil {
+			http.Error(w, "A file exists at the presigned location", http.StatusConflict)
+			return
+		}
+		if err != service.ErrFileNotFound {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	scrub, keepOriginal := app.imagePrivacy(user)
+	metaFile, err := app.FileService.Upload(file, name, service.UploadOptions{
+		UserID:             user.ID,
+		Folder:             folder,
+		ExpiresAt:          expiresAt,
+		RetainUntil:        retainUntil,
+		ScrubImageMetadata: scrub,
+		KeepImageOriginal:  keepOriginal,
+	})
 	if err == service.ErrFileBadRequest {
+		app.audit(r, auditFileUpload, name, datastruct.AuditFailure, err.Error())
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 	if err == service.ErrFileProcessing {
+		app.audit(r, auditFileUpload, name, datastruct.AuditFailure, err.Error())
 		http.Error(w, "Error processing file", http.StatusInternalServerError)
 		return
 	}
+	if err == service.ErrStorageFull {
+		app.audit(r, auditFileUpload, name, datastruct.AuditFailure, err.Error())
+		http.Error(w, "No storage space left", http.StatusInsufficientStorage)
+		return
+	}
+	if err == service.ErrFileInfected {
+		app.audit(r, auditFileUpload, metaFile.UUID, datastruct.AuditBlocked, "quarantined, found "+metaFile.ScanSignature)
+		http.Error(w, fmt.Sprintf("File %s quarantined, found %s", metaFile.UUID, metaFile.ScanSignature), http.StatusUnprocessableEntity)
+		return
+	}
+	app.audit(r, auditFileUpload, metaFile.UUID, datastruct.AuditSuccess, name)
 
 	common.EncodeJSONAndSend(w, dto.UploadFileResponse{
-		ID: metaFile.UUID,
+		ID:               metaFile.UUID,
+		ScanStatus:       string(metaFile.ScanStatus),
+		ScrubbedMetadata: scrubbedMetadata(metaFile),
+		OriginalKept:     metaFile.Scrubbed && keepOriginal,
+	})
+}
+
+// imagePrivacy returns whether the metadata of the images uploaded by the user is removed
+// and their original kept, following the settings of the user or else the server defaults.
+func (app *App) imagePrivacy(user *datastruct.User) (scrub, keepOriginal bool) {
+	scrub = app.Config.Privacy.ScrubImageMetadata
+	if user.ScrubImageMetadata != nil {
+		scrub = *user.ScrubImageMetadata
+	}
+	keepOriginal = app.Config.Privacy.KeepImageOriginal
+	if user.KeepImageOriginal != nil {
+		keepOriginal = *user.KeepImageOriginal
+	}
+	return scrub, keepOriginal
+}
+
+// scrubbedMetadata returns the kinds of image metadata removed from the file on upload.
+func scrubbedMetadata(metaFile datastruct.File) []string {
+	if metaFile.ScrubbedMetadata == "" {
+		return nil
+	}
+	return strings.Split(metaFile.ScrubbedMetadata, ",")
+}
+
+// storeFile uploads the content as the file with the given name in a folder of the user,
+// replacing the existing file once uploaded. Expiry and retention follow the user role.
+// It is used by the protocols addressing files by path, like WebDAV and S3. Images are
+// stored as is, since their clients check the size or checksum of the uploaded content.
+func (app *App) storeFile(r *http.Request, user *datastruct.User, folder, name string, content io.Reader) (datastruct.File, error) {
+	replaced, err := app.FileService.GetByPath(user.ID, folder, name)
+	if err != nil && err != service.ErrFileNotFound {
+		return replaced, err
+	}
+	exists := err == nil
+	if exists {
+		if err := app.FileService.CheckMutable(replaced); err != nil {
+			app.audit(r, auditFileUpload, replaced.UUID, datastruct.AuditBlocked, err.Error())
+			return replaced, err
+		}
+	}
+
+	expiresAt, retainUntil, err := app.fileLifetime(user, "", "")
+	if err != nil {
+		return datastruct.File{}, err
+	}
+
+	metaFile, err := app.FileService.Upload(content, name, service.UploadOptions{
+		UserID:      user.ID,
+		Folder:      folder,
+		ExpiresAt:   expiresAt,
+		RetainUntil: retainUntil,
 	})
+	if err == service.ErrFileInfected {
+		app.audit(r, auditFileUpload, metaFile.UUID, datastruct.AuditBlocked, "quarantined, found "+metaFile.ScanSignature)
+		return metaFile, err
+	}
+	if err != nil {
+		app.audit(r, auditFileUpload, name, datastruct.AuditFailure, err.Error())
+		return metaFile, err
+	}
+	app.audit(r, auditFileUpload, metaFile.UUID, datastruct.AuditSuccess, path.Join(folder, name))
+
+	if exists {
+		if err := app.FileService.Delete(replaced); err != nil {
+			logrus.Errorf("cannot delete replaced file %s: %v", replaced.UUID, err)
+		}
+	}
+
+	return metaFile, nil
+}
+
+// fileLifetime returns the requested expiration of a file uploaded by the user and the end of
+// its retention, nil if none. Users whose role has a max TTL cannot exceed it and get it by default,
+// extended to the end of the retention of their role if later. Retained files cannot expire before.
+func (app *App) fileLifetime(user *datastruct.User, expiresIn, expiresAt string) (expiry, retainUntil *time.Time, err error) {
+	now := time.Now()
+	expiry, err = common.ParseExpiry(expiresIn, expiresAt, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	retainUntil = app.fileRetention(user, now)
+
+	if maxTTL, ok := app.Config.Expiry.MaxTTLHours[string(user.Role)]; ok && maxTTL > 0 {
+		limit := now.Add(time.Duration(maxTTL) * time.Hour)
+		if expiry != nil && expiry.After(limit) {
+			return nil, nil, fmt.Errorf("max expiration is %d hours", maxTTL)
+		}
+		if expiry == nil {
+			if retainUntil != nil && limit.Before(*retainUntil) {
+				limit = *retainUntil
+			}
+			expiry = &limit
+		}
+	}
+
+	if expiry != nil && retainUntil != nil && expiry.Before(*retainUntil) {
+		return nil, nil, fmt.Errorf("files cannot expire before their retention ends on %s", retainUntil.Format(time.RFC3339))
+	}
+
+	return expiry, retainUntil, nil
 }
 
-// GetFile returns the file with the given id (internal UUID).
+// GetFile returns the file with the given id (internal UUID) of the user.
 func (app *App) GetFile(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
 
 	// Check if the file exists and retrieve metadata
-	metaFile, err := app.FileService.Get(id)
+	metaFile, err := app.getUserFile(user, id)
 	if err == service.ErrFileNotFound {
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
+	if err == service.ErrFileExpired {
+		http.Error(w, "File expired", http.StatusGone)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
 
-	// Only return the safely exposable metadata
-	common.EncodeJSONAndSend(w, dto.GetFileResponse{
-		ID:   metaFile.UUID,
-		Name: metaFile.Name,
-		Size: metaFile.Size,
-	})
+	common.EncodeJSONAndSend(w, app.fileResponse(metaFile))
+}
+
+// getUserFile returns the file with the given id (internal UUID), as not found
+// when it belongs to another user.
+func (app *App) getUserFile(user *datastruct.User, id string) (datastruct.File, error) {
+	metaFile, err := app.FileService.Get(id)
+	if (err == nil || err == service.ErrFileExpired) && metaFile.UserID != user.ID {
+		return datastruct.File{}, service.ErrFileNotFound
+	}
+	return metaFile, err
+}
+
+// fileContentType returns the MIME type of the file, from its name for files uploaded
+// before it was detected.
+func fileContentType(metaFile datastruct.File) string {
+	if metaFile.ContentType != "" {
+		return metaFile.ContentType
+	}
+	return utils.DetectContentType(metaFile.Name, nil)
 }
 
-// DownloadFile returns the file with the given id (internal UUID).
+// fileResponse only returns the safely exposable metadata of the file.
+func (app *App) fileResponse(metaFile datastruct.File) dto.GetFileResponse {
+	return dto.GetFileResponse{
+		ID:               metaFile.UUID,
+		Name:             metaFile.Name,
+		Size:             metaFile.Size,
+		ExpiresAt:        metaFile.ExpiresAt,
+		RetainUntil:      metaFile.RetainUntil,
+		LegalHold:        metaFile.LegalHold,
+		ScanStatus:       string(metaFile.ScanStatus),
+		ContentType:      fileContentType(metaFile),
+		Tier:             app.StoragePool.Tier(metaFile.Volume),
+		LastAccessedAt:   metaFile.LastAccessedAt,
+		ScrubbedMetadata: scrubbedMetadata(metaFile),
+	}
+}
+
+// Dispositions of the downloaded files.
+const (
+	dispositionAttachment = "attachment"
+	dispositionInline     = "inline"
+)
+
+// Content Security Policy of the files displayed inline, allowing no scripts nor external resources.
+const inlineCSP = "default-src 'none'; img-src 'self' data:; media-src 'self'; style-src 'unsafe-inline'"
+
+// DownloadFile returns the file with the given id (internal UUID) of the user.
+// The file is displayed by the browser with ?disposition=inline, if its type is safe to display.
 func (app *App) DownloadFile(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	disposition := r.URL.Query().Get("disposition")
+	switch disposition {
+	case "":
+		disposition = dispositionAttachment
+	case dispositionAttachment, dispositionInline:
+	default:
+		http.Error(w, "Disposition must be inline or attachment", http.StatusBadRequest)
+		return
+	}
 
 	// Check if the file exists and retrieve metadata
-	metaFile, err := app.FileService.Get(id)
+	metaFile, err := app.getUserFile(user, id)
 	if err == service.ErrFileNotFound {
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
+	if err == service.ErrFileExpired {
+		http.Error(w, "File expired", http.StatusGone)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
@@ -91,16 +336,37 @@ func (app *App) DownloadFile(w http.ResponseWriter, r *http.Request) {
 
 	// Retrieve the file
 	file, err := app.FileService.LoadFile(metaFile)
+	if err == service.ErrFilePendingScan || err == service.ErrFileInfected {
+		app.audit(r, auditFileDownload, id, datastruct.AuditBlocked, err.Error())
+	}
+	if err == service.ErrFilePendingScan {
+		http.Error(w, "File pending malware scan", http.StatusConflict)
+		return
+	}
+	if err == service.ErrFileInfected {
+		http.Error(w, "File quarantined", http.StatusForbidden)
+		return
+	}
 	if err != nil {
+		app.audit(r, auditFileDownload, id, datastruct.AuditFailure, err.Error())
 		http.Error(w, "Internal error loading file", http.StatusInternalServerError)
 		return
 	}
 	defer file.Close()
+	app.audit(r, auditFileDownload, id, datastruct.AuditSuccess, "")
 
-	// Set the headers
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", metaFile.Name))
-	w.Header().Set("Content-Type", "application/octet-stream")
+	// Set the headers, only content safe to display is served inline
+	contentType := fileContentType(metaFile)
+	if disposition == dispositionInline && !utils.IsInlineSafe(contentType) {
+		disposition = dispositionAttachment
+	}
+	w.Header().Set("Content-Disposition", common.ContentDisposition(disposition, metaFile.Name))
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", metaFile.Size))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if disposition == dispositionInline {
+		w.Header().Set("Content-Security-Policy", inlineCSP)
+	}
 
 	// Copy the file to the response
 	_, err = io.Copy(w, file)
@@ -110,27 +376,101 @@ func (app *App) DownloadFile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// DeleteFile deletes the file with the given id from storage and the database.
-func (app *App) DeleteFile(w http.ResponseWriter, r *http.Request) {
+// DownloadOriginal returns the private original of the scrubbed image with the given id
+// (internal UUID), always as an attachment. Only the owner of the file can download it.
+func (app *App) DownloadOriginal(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
 
 	// Check if the file exists and retrieve metadata
-	metaFile, err := app.FileService.Get(id)
+	metaFile, err := app.getUserFile(user, id)
 	if err == service.ErrFileNotFound {
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
+	if err == service.ErrFileExpired {
+		http.Error(w, "File expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	original, err := app.FileService.GetOriginal(metaFile)
+	if err == service.ErrFileNotFound {
+		http.Error(w, "Original not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Retrieve the file
+	file, err := app.FileService.LoadFile(original)
+	if err == service.ErrFilePendingScan || err == service.ErrFileInfected {
+		app.audit(r, auditFileDownload, original.UUID, datastruct.AuditBlocked, err.Error())
+	}
+	if err == service.ErrFilePendingScan {
+		http.Error(w, "File pending malware scan", http.StatusConflict)
+		return
+	}
+	if err == service.ErrFileInfected {
+		http.Error(w, "File quarantined", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		app.audit(r, auditFileDownload, original.UUID, datastruct.AuditFailure, err.Error())
+		http.Error(w, "Internal error loading file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	app.audit(r, auditFileDownload, original.UUID, datastruct.AuditSuccess, "original of "+id)
+
+	w.Header().Set("Content-Disposition", common.ContentDisposition(dispositionAttachment, original.Name))
+	w.Header().Set("Content-Type", fileContentType(original))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", original.Size))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// Copy the file to the response
+	_, err = io.Copy(w, file)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
+}
+
+// DeleteFile deletes the file with the given id of the user from storage and the database.
+func (app *App) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	// Check if the file exists and retrieve metadata
+	// Expired files can still be deleted before being purged
+	metaFile, err := app.getUserFile(user, id)
+	if err == service.ErrFileNotFound {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != service.ErrFileExpired {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
 
 	// Delete the file
 	err = app.FileService.Delete(metaFile)
+	if err == service.ErrFileImmutable {
+		app.audit(r, auditFileDelete, id, datastruct.AuditBlocked, err.Error())
+		http.Error(w, "File is retained or under legal hold", http.StatusForbidden)
+		return
+	}
 	if err != nil {
+		app.audit(r, auditFileDelete, id, datastruct.AuditFailure, err.Error())
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
+	app.audit(r, auditFileDelete, id, datastruct.AuditSuccess, "")
 
 	common.EncodeJSONAndSend(w, dto.DeleteFileResponse{
 		ID: id,
@@ -150,7 +490,8 @@ func (app *App) SearchFilesByDateRange(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metaFiles, err := app.FileService.SearchByDateRange(from, to)
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+	metaFiles, err := app.FileService.SearchByDateRange(user.ID, from, to)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
@@ -160,11 +501,7 @@ func (app *App) SearchFilesByDateRange(w http.ResponseWriter, r *http.Request) {
 	res.Count = len(metaFiles)
 	res.Files = make([]dto.GetFileResponse, res.Count)
 	for i, metaFile := range metaFiles {
-		res.Files[i] = dto.GetFileResponse{
-			ID:   metaFile.UUID,
-			Name: metaFile.Name,
-			Size: metaFile.Size,
-		}
+		res.Files[i] = app.fileResponse(metaFile)
 	}
 
 	common.EncodeJSONAndSend(w, res)
@@ -183,7 +520,8 @@ func (app *App) DeleteFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	metaFiles, err := app.FileService.SearchByDateRange(from, to)
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+	metaFiles, err := app.FileService.SearchByDateRange(user.ID, from, to)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
@@ -192,15 +530,36 @@ func (app *App) DeleteFiles(w http.ResponseWriter, r *http.Request) {
 	var res dto.DeleteFilesResponse
 	res.Count = len(metaFiles)
 	res.Result = make([]dto.DeleteFilesResponseItem, res.Count)
+
+	// Retained and held files are skipped, the others are deleted all at once
+	// so the range is never left half deleted
+	deletable := make([]datastruct.File, 0, len(metaFiles))
 	for i, metaFile := range metaFiles {
 		res.Result[i] = dto.DeleteFilesResponseItem{
 			ID: metaFile.UUID,
 		}
-		err = app.FileService.Delete(metaFile)
-		if err != nil {
-			// TODO: Better error handling here
+		if err := app.FileService.CheckMutable(metaFile); err != nil {
+			if err == service.ErrFileImmutable {
+				app.audit(r, auditFileDelete, metaFile.UUID, datastruct.AuditBlocked, err.Error())
+			}
 			res.Result[i].Error = err.Error()
+			continue
+		}
+		deletable = append(deletable, metaFile)
+	}
+
+	target := fmt.Sprintf("%s/%s", fromParam, toParam)
+	err = app.FileService.DeleteMany(deletable)
+	if err != nil {
+		app.audit(r, auditFileRangeDelete, target, datastruct.AuditFailure, err.Error())
+		for i := range res.Result {
+			if res.Result[i].Error == "" {
+				res.Result[i].Error = err.Error()
+			}
 		}
+	} else {
+		app.audit(r, auditFileRangeDelete, target, datastruct.AuditSuccess,
+			fmt.Sprintf("deleted %d of %d files", len(deletable), len(metaFiles)))
 	}
 
 	common.EncodeJSONAndSend(w, res)
@@ -2,7 +2,7 @@ package app
 
 import (
 	"dryve/internal/datastruct"
-	"dryve/internal/dto"
+	"dryve/pkg/dto"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ImportFile starts the import of the file at the given URL, fetched by the server in background.
+// Expiry and retention follow the user role, and images are scrubbed as uploads.
+func (app *App) ImportFile(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	var req dto.ImportFileRequest
+	err := common.DecodeJSONBody(w, r, &req)
+	if err != nil {
+		common.HandleDecodeError(w, err)
+		return
+	}
+
+	expiresAt, retainUntil, err := app.fileLifetime(user, "", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scrub, keepOriginal := app.imagePrivacy(user)
+
+	job, err := app.ImportService.Import(user.ID, req.URL, req.Name, service.UploadOptions{
+		ExpiresAt:          expiresAt,
+		RetainUntil:        retainUntil,
+		ScrubImageMetadata: scrub,
+		KeepImageOriginal:  keepOriginal,
+	})
+	if err == service.ErrImportBadRequest {
+		app.audit(r, auditFileImport, redactURL(req.URL), datastruct.AuditFailure, err.Error())
+		http.Error(w, "URL must be http or https and not target a private address", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		app.audit(r, auditFileImport, redactURL(req.URL), datastruct.AuditFailure, err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditFileImport, strconv.Itoa(int(job.ID)), datastruct.AuditSuccess, redactURL(job.URL))
+
+	w.WriteHeader(http.StatusAccepted)
+	common.EncodeJSONAndSend(w, importJobResponse(job))
+}
+
+// GetImport returns the status of the import with the given id, which must belong to the user.
+func (app *App) GetImport(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid import id", http.StatusBadRequest)
+		return
+	}
+
+	job, err := app.ImportService.Get(user.ID, uint(id))
+	if err == service.ErrImportNotFound {
+		http.Error(w, "Import not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	common.EncodeJSONAndSend(w, importJobResponse(job))
+}
+
+func importJobResponse(job datastruct.ImportJob) dto.ImportJobResponse {
+	return dto.ImportJobResponse{
+		ID:         job.ID,
+		URL:        job.URL,
+		Name:       job.Name,
+		Status:     string(job.Status),
+		Size:       job.Size,
+		FileID:     job.FileUUID,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	}
+}
+
+// redactURL strips the credentials and query of the URL, which may hold secrets, for the audit log.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
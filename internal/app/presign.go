@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/internal/utils"
+	"dryve/pkg/dto"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Context Key for the parameters of a presigned URL
+var ctxKeyPresignedURL contextKey = "presigned_url"
+
+// Paths of the presigned routes.
+const (
+	presignedUploadPath   = "/presigned/files"
+	presignedDownloadPath = "/presigned/files/%s/download"
+	presignedEventsPath   = "/presigned/events"
+)
+
+// Presign returns a time-limited URL to download or upload a file, or to open the event stream, without a JWT.
+// Browsers cannot set the Authorization header of EventSource and WebSocket connections.
+func (app *App) Presign(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	var req dto.PresignRequest
+	err := common.DecodeJSONBody(w, r, &req)
+	if err != nil {
+		common.HandleDecodeError(w, err)
+		return
+	}
+
+	if req.ExpiresIn <= 0 || req.ExpiresIn > app.Config.Presign.MaxTTLSecs {
+		http.Error(w, fmt.Sprintf("expiresIn must be between 1 and %d seconds", app.Config.Presign.MaxTTLSecs), http.StatusBadRequest)
+		return
+	}
+
+	p := utils.PresignedURL{
+		Method:  strings.ToUpper(req.Method),
+		Expires: time.Now().Add(time.Duration(req.ExpiresIn) * time.Second),
+		UserID:  user.ID,
+	}
+	if perm := methodPermission(p.Method); !app.Authorizer.Can(user.Role, perm) {
+		app.audit(r, auditAccessDenied, r.URL.Path, datastruct.AuditBlocked, fmt.Sprintf("role %s lacks %s", user.Role, perm))
+		http.Error(w, fmt.Sprintf("%s permission required", perm), http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case p.Method == http.MethodGet && req.Events:
+		p.Path = presignedEventsPath
+
+	case p.Method == http.MethodGet:
+		_, err := app.getUserFile(user, req.ID)
+		if err == service.ErrFileNotFound {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if err == service.ErrFileExpired {
+			http.Error(w, "File expired", http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		p.Path = fmt.Sprintf(presignedDownloadPath, req.ID)
+
+	case p.Method == http.MethodPost:
+		if req.MaxSize < 0 || req.MaxSize > app.Config.Limits.MaxFileSize {
+			http.Error(w, fmt.Sprintf("Max file size is %d MB", app.Config.Limits.MaxFileSize>>20), http.StatusBadRequest)
+			return
+		}
+		p.Path = presignedUploadPath
+		p.MaxSize = req.MaxSize
+
+		// The uploads go to the signed location only
+		p.Folder = req.Folder
+		if p.Folder == "" {
+			p.Folder = datastruct.RootFolder
+		}
+		if !strings.HasPrefix(p.Folder, "/") || path.Clean(p.Folder) != p.Folder {
+			http.Error(w, "Folder must be an absolute path", http.StatusBadRequest)
+			return
+		}
+		if req.Name != "" {
+			p.Name = utils.NormalizeFilename(req.Name)
+		}
+
+	default:
+		http.Error(w, "method must be GET or POST", http.StatusBadRequest)
+		return
+	}
+
+	app.audit(r, "file.presign", p.Method+" "+p.Path, datastruct.AuditSuccess, "")
+
+	common.EncodeJSONAndSend(w, dto.PresignResponse{
+		URL:       fmt.Sprintf("%s%s?%s", app.Config.HTTP.BaseURL, p.Path, p.Sign([]byte(app.Config.Presign.Key))),
+		Method:    p.Method,
+		ExpiresAt: p.Expires,
+	})
+}
+
+// PresignMiddleware verifies the signature of presigned URLs and populates the context
+// with the signing user, in place of JWTMiddleware and AuthMiddleware.
+func (app *App) PresignMiddleware(next http.Handler) http.Handler {
+	hfn := func(w http.ResponseWriter, r *http.Request) {
+		p, err := utils.VerifyPresignedURL([]byte(app.Config.Presign.Key), r.Method, r.URL.Path, r.URL.Query(), time.Now())
+		if err != nil {
+			logrus.Errorf("cannot verify presigned url: %v", err)
+			http.Error(w, "invalid or expired presigned url", http.StatusForbidden)
+			return
+		}
+
+		user, err := app.UserService.GetUser(p.UserID)
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "invalid or expired presigned url", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			logrus.Errorf(err.Error())
+			http.Error(w, "error getting user", http.StatusInternalServerError)
+			return
+		}
+
+		if !user.Verified {
+			http.Error(w, "user not verified", http.StatusUnauthorized)
+			return
+		}
+		if user.Disabled {
+			http.Error(w, "user disabled", http.StatusForbidden)
+			return
+		}
+		// The role of the user may have changed since the URL was signed
+		if perm := methodPermission(r.Method); !app.Authorizer.Can(user.Role, perm) {
+			app.auditActor(r, user.ID, auditAccessDenied, r.URL.Path, datastruct.AuditBlocked, fmt.Sprintf("role %s lacks %s", user.Role, perm))
+			http.Error(w, fmt.Sprintf("%s permission required", perm), http.StatusForbidden)
+			return
+		}
+
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, ctxKeyUser, user)
+		ctx = context.WithValue(ctx, ctxKeyPresignedURL, p)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(hfn)
+}
+
+// maxUploadSize returns the max size of an uploaded file, possibly lowered by a presigned URL.
+func (app *App) maxUploadSize(r *http.Request) int64 {
+	if p, ok := r.Context().Value(ctxKeyPresignedURL).(utils.PresignedURL); ok && p.MaxSize > 0 && p.MaxSize < app.Config.Limits.MaxFileSize {
+		return p.MaxSize
+	}
+	return app.Config.Limits.MaxFileSize
+}
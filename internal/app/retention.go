@@ -0,0 +1,109 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// fileRetention returns the retention end of a file uploaded by the user at the given time, nil if not retained.
+func (app *App) fileRetention(user *datastruct.User, now time.Time) *time.Time {
+	days, ok := app.Config.Retention.Days[string(user.Role)]
+	if !ok || days <= 0 {
+		return nil
+	}
+
+	retainUntil := now.AddDate(0, 0, days)
+	return &retainUntil
+}
+
+// PlaceFileHold places a legal hold on the file with the given id.
+func (app *App) PlaceFileHold(w http.ResponseWriter, r *http.Request) {
+	app.setFileHold(w, r, true)
+}
+
+// ReleaseFileHold releases the legal hold of the file with the given id.
+func (app *App) ReleaseFileHold(w http.ResponseWriter, r *http.Request) {
+	app.setFileHold(w, r, false)
+}
+
+func (app *App) setFileHold(w http.ResponseWriter, r *http.Request, hold bool) {
+	id := chi.URLParam(r, "id")
+
+	metaFile, err := app.FileService.Get(id)
+	if err == service.ErrFileNotFound {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != service.ErrFileExpired {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	action := holdAction("file", hold)
+	if err = app.FileService.SetLegalHold(metaFile, hold); err != nil {
+		app.audit(r, action, id, datastruct.AuditFailure, err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, action, id, datastruct.AuditSuccess, "")
+
+	common.EncodeJSONAndSend(w, dto.LegalHoldResponse{
+		ID:        id,
+		LegalHold: hold,
+	})
+}
+
+// PlaceUserHold places a legal hold on all the files of the user with the given id.
+func (app *App) PlaceUserHold(w http.ResponseWriter, r *http.Request) {
+	app.setUserHold(w, r, true)
+}
+
+// ReleaseUserHold releases the legal hold on the files of the user with the given id.
+func (app *App) ReleaseUserHold(w http.ResponseWriter, r *http.Request) {
+	app.setUserHold(w, r, false)
+}
+
+func (app *App) setUserHold(w http.ResponseWriter, r *http.Request, hold bool) {
+	idParam := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	action := holdAction("user", hold)
+	err = app.UserService.SetLegalHold(uint(id), hold)
+	if err == gorm.ErrRecordNotFound {
+		app.audit(r, action, idParam, datastruct.AuditFailure, "user not found")
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, action, idParam, datastruct.AuditFailure, err.Error())
+		http.Error(w, "error setting user legal hold", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, action, idParam, datastruct.AuditSuccess, "")
+
+	common.EncodeJSONAndSend(w, dto.LegalHoldResponse{
+		ID:        idParam,
+		LegalHold: hold,
+	})
+}
+
+func holdAction(target string, hold bool) string {
+	if hold {
+		return target + ".hold.place"
+	}
+	return target + ".hold.release"
+}
@@ -0,0 +1,738 @@
+package app
+
+import (
+	"context"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/internal/utils"
+	"dryve/pkg/dto"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// Max number of keys listed at once, as in S3.
+const s3MaxKeys = 1000
+
+// Max size of the XML body listing the parts of a multipart upload.
+const s3MaxCompleteBody = 1 << 20
+
+// Buckets are the top level folders of the user, whose names must be valid in S3 too.
+var s3BucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// S3AuthMiddleware authenticates the SigV4 signed requests with the access keys of
+// the users, and populates the context with the user. The payload is verified while read.
+func (app *App) S3AuthMiddleware(next http.Handler) http.Handler {
+	hfn := func(w http.ResponseWriter, r *http.Request) {
+		sig, err := utils.ParseSigV4(r, time.Now())
+		switch err {
+		case nil:
+		case utils.ErrSigV4Missing:
+			s3Error(w, r, http.StatusForbidden, "AccessDenied", "Anonymous access is not allowed")
+			return
+		case utils.ErrSigV4Expired:
+			s3Error(w, r, http.StatusForbidden, "RequestTimeTooSkewed", "The request time is out of the signature validity")
+			return
+		default:
+			s3Error(w, r, http.StatusBadRequest, "AuthorizationHeaderMalformed", "The signature is malformed")
+			return
+		}
+		if sig.Service != "s3" || sig.Region != app.Config.S3.Region {
+			s3Error(w, r, http.StatusBadRequest, "AuthorizationHeaderMalformed",
+				fmt.Sprintf("The credential scope must be the s3 service in %s", app.Config.S3.Region))
+			return
+		}
+
+		key, err := app.UserService.GetAccessKey(sig.AccessKey)
+		if err == service.ErrAccessKeyNotFound {
+			app.auditActor(r, 0, auditLogin, sig.AccessKey, datastruct.AuditFailure, "s3, unknown access key")
+			s3Error(w, r, http.StatusForbidden, "InvalidAccessKeyId", "The access key does not exist")
+			return
+		}
+		if err != nil {
+			logrus.Errorf("cannot get access key: %v", err)
+			s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+			return
+		}
+		if err := sig.Verify(r, key.Secret); err != nil {
+			app.auditActor(r, key.UserID, auditLogin, sig.AccessKey, datastruct.AuditFailure, "s3, signature mismatch")
+			s3Error(w, r, http.StatusForbidden, "SignatureDoesNotMatch", "The signature does not match")
+			return
+		}
+
+		user, err := app.UserService.GetUser(key.UserID)
+		if err != nil {
+			s3Error(w, r, http.StatusForbidden, "InvalidAccessKeyId", "The access key does not exist")
+			return
+		}
+		if !user.Verified {
+			s3Error(w, r, http.StatusForbidden, "AccessDenied", "User not verified")
+			return
+		}
+		if user.Disabled {
+			s3Error(w, r, http.StatusForbidden, "AccessDenied", "User disabled")
+			return
+		}
+		if perm := methodPermission(r.Method); !app.Authorizer.Can(user.Role, perm) {
+			app.auditActor(r, user.ID, auditAccessDenied, r.URL.Path, datastruct.AuditBlocked, fmt.Sprintf("role %s lacks %s", user.Role, perm))
+			s3Error(w, r, http.StatusForbidden, "AccessDenied", fmt.Sprintf("The %s permission is required", perm))
+			return
+		}
+
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{sig.Body(r, key.Secret), r.Body}
+		ctx := context.WithValue(r.Context(), ctxKeyUser, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(hfn)
+}
+
+// S3ListBuckets lists the buckets of the user, i.e. the top level folders.
+func (app *App) S3ListBuckets(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	folders, _, err := app.FileService.ListFolder(user.ID, datastruct.RootFolder)
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+
+	res := dto.S3ListBucketsResponse{
+		Xmlns: dto.S3Namespace,
+		Owner: dto.S3Owner{
+			ID:          strconv.Itoa(int(user.ID)),
+			DisplayName: user.Email,
+		},
+		Buckets: make([]dto.S3Bucket, len(folders)),
+	}
+	for i, folder := range folders {
+		res.Buckets[i] = dto.S3Bucket{
+			Name:         path.Base(folder.Path),
+			CreationDate: s3Time(folder.CreatedAt),
+		}
+	}
+
+	s3Send(w, http.StatusOK, res)
+}
+
+// S3Bucket handles the bucket operations: ListObjects, ListObjectsV2, GetBucketLocation,
+// HeadBucket, CreateBucket and DeleteBucket.
+func (app *App) S3Bucket(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+	bucket := chi.URLParam(r, "bucket")
+	bucketPath := datastruct.RootFolder + bucket
+
+	if r.Method == http.MethodPut {
+		if !s3BucketName.MatchString(bucket) {
+			s3Error(w, r, http.StatusBadRequest, "InvalidBucketName", "The bucket name is not valid")
+			return
+		}
+		_, err := app.FileService.CreateFolder(user.ID, bucketPath)
+		if err == service.ErrFolderExists {
+			s3Error(w, r, http.StatusConflict, "BucketAlreadyOwnedByYou", "The bucket already exists")
+			return
+		}
+		if err != nil {
+			s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+			return
+		}
+		w.Header().Set("Location", "/"+bucket)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	folders, files, err := app.FileService.ListFolder(user.ID, bucketPath)
+	if err == service.ErrFolderNotFound {
+		s3Error(w, r, http.StatusNotFound, "NoSuchBucket", "The bucket does not exist")
+		return
+	}
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		if _, ok := r.URL.Query()["location"]; ok {
+			s3Send(w, http.StatusOK, dto.S3LocationResponse{Xmlns: dto.S3Namespace, Region: app.Config.S3.Region})
+			return
+		}
+		app.s3ListObjects(w, r, user, bucket)
+	case http.MethodDelete:
+		if len(folders) > 0 || len(files) > 0 {
+			s3Error(w, r, http.StatusConflict, "BucketNotEmpty", "The bucket is not empty")
+			return
+		}
+		if err := app.FileService.DeleteFolder(user.ID, bucketPath); err != nil {
+			s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not allowed on buckets")
+	}
+}
+
+// s3ListObjects lists the objects of the bucket, i.e. all the files in the folder tree,
+// keyed by their path relative to the bucket. It serves both ListObjects and ListObjectsV2.
+func (app *App) s3ListObjects(w http.ResponseWriter, r *http.Request, user *datastruct.User, bucket string) {
+	q := r.URL.Query()
+	v2 := q.Get("list-type") == "2"
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+
+	maxKeys := s3MaxKeys
+	if param := q.Get("max-keys"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 0 {
+			s3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+			return
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	// Keys are listed after the marker (V1), the continuation token or start-after (V2)
+	after := q.Get("marker")
+	if v2 {
+		after = q.Get("start-after")
+		if token := q.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				s3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid continuation token")
+				return
+			}
+			after = string(decoded)
+		}
+	}
+
+	files, err := app.FileService.ListTree(user.ID, datastruct.RootFolder+bucket)
+	if err == service.ErrFolderNotFound {
+		s3Error(w, r, http.StatusNotFound, "NoSuchBucket", "The bucket does not exist")
+		return
+	}
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+
+	type object struct {
+		key  string
+		file datastruct.File
+	}
+	now := time.Now()
+	root := datastruct.RootFolder + bucket + "/"
+	objects := make([]object, 0, len(files))
+	for _, metaFile := range files {
+		if !metaFile.IsExpired(now) {
+			key := strings.TrimPrefix(path.Join(metaFile.Folder, metaFile.Name), root)
+			objects = append(objects, object{key, metaFile})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].key < objects[j].key })
+
+	encode := func(s string) string { return s }
+	if q.Get("encoding-type") == "url" {
+		encode = func(s string) string { return utils.URIEncode(s, false) }
+	}
+
+	res := dto.S3ListObjectsResponse{
+		Xmlns:        dto.S3Namespace,
+		Name:         bucket,
+		Prefix:       encode(prefix),
+		Delimiter:    encode(delimiter),
+		MaxKeys:      maxKeys,
+		EncodingType: q.Get("encoding-type"),
+	}
+
+	// Keys sharing a prefix up to the delimiter are rolled up, they are contiguous once sorted
+	var last string
+	count := 0
+	for _, o := range objects {
+		if !strings.HasPrefix(o.key, prefix) || o.key <= after {
+			continue
+		}
+
+		if delimiter != "" {
+			if i := strings.Index(o.key[len(prefix):], delimiter); i >= 0 {
+				common := o.key[:len(prefix)+i+len(delimiter)]
+				if common == last || strings.HasPrefix(after, common) {
+					continue
+				}
+				if count == maxKeys {
+					res.IsTruncated = true
+					break
+				}
+				res.CommonPrefixes = append(res.CommonPrefixes, dto.S3CommonPrefix{Prefix: encode(common)})
+				last = common
+				count++
+				continue
+			}
+		}
+
+		if count == maxKeys {
+			res.IsTruncated = true
+			break
+		}
+		res.Contents = append(res.Contents, dto.S3Object{
+			Key:          encode(o.key),
+			LastModified: s3Time(o.file.UpdatedAt),
+			ETag:         s3ETag(o.file),
+			Size:         o.file.Size,
+			StorageClass: "STANDARD",
+		})
+		last = o.key
+		count++
+	}
+
+	if v2 {
+		res.KeyCount = &count
+		res.ContinuationToken = q.Get("continuation-token")
+		res.StartAfter = encode(q.Get("start-after"))
+		if res.IsTruncated {
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		}
+	} else {
+		marker := encode(q.Get("marker"))
+		res.Marker = &marker
+		if res.IsTruncated {
+			res.NextMarker = encode(last)
+		}
+	}
+
+	s3Send(w, http.StatusOK, res)
+}
+
+// S3Object handles the object operations: GetObject, HeadObject, PutObject, DeleteObject
+// and the multipart upload ones.
+func (app *App) S3Object(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+	bucket := chi.URLParam(r, "bucket")
+	key := strings.TrimPrefix(r.URL.Path, "/"+bucket+"/")
+	if key == "" {
+		app.S3Bucket(w, r)
+		return
+	}
+
+	folder, name, ok := s3ObjectPath(bucket, key)
+	if !ok {
+		s3Error(w, r, http.StatusBadRequest, "InvalidArgument", "The object key is not valid")
+		return
+	}
+	if _, err := app.FileService.GetFolder(user.ID, datastruct.RootFolder+bucket); err != nil {
+		s3Error(w, r, http.StatusNotFound, "NoSuchBucket", "The bucket does not exist")
+		return
+	}
+
+	q := r.URL.Query()
+	_, multipart := q["uploadId"]
+	switch {
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		app.s3GetObject(w, r, user, folder, name)
+	case r.Method == http.MethodPut && multipart:
+		app.s3UploadPart(w, r, user, bucket, key)
+	case r.Method == http.MethodPut:
+		app.s3PutObject(w, r, user, folder, name)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		app.s3CreateMultipartUpload(w, r, user, bucket, key)
+	case r.Method == http.MethodPost && multipart:
+		app.s3CompleteMultipartUpload(w, r, user, bucket, key, folder, name)
+	case r.Method == http.MethodDelete && multipart:
+		app.s3AbortMultipartUpload(w, r, user, bucket, key)
+	case r.Method == http.MethodDelete:
+		app.s3DeleteObject(w, r, user, folder, name)
+	default:
+		s3Error(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The method is not allowed on objects")
+	}
+}
+
+// s3ObjectPath returns the folder and the name of the file of an object key.
+// Keys ending with a slash are folder markers, whose name is empty.
+func s3ObjectPath(bucket, key string) (string, string, bool) {
+	full := datastruct.RootFolder + bucket + "/" + strings.TrimSuffix(key, "/")
+	if path.Clean(full) != full || strings.HasSuffix(key, "//") {
+		return "", "", false
+	}
+	if strings.HasSuffix(key, "/") {
+		return full, "", true
+	}
+	return path.Dir(full), path.Base(full), true
+}
+
+func (app *App) s3GetObject(w http.ResponseWriter, r *http.Request, user *datastruct.User, folder, name string) {
+	if name == "" {
+		if _, err := app.FileService.GetFolder(user.ID, folder); err != nil {
+			s3Error(w, r, http.StatusNotFound, "NoSuchKey", "The object does not exist")
+			return
+		}
+		w.Header().Set("ETag", s3EmptyETag)
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	metaFile, err := app.FileService.GetByPath(user.ID, folder, name)
+	if err == service.ErrFileNotFound || (err == nil && metaFile.IsExpired(time.Now())) {
+		s3Error(w, r, http.StatusNotFound, "NoSuchKey", "The object does not exist")
+		return
+	}
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+
+	w.Header().Set("ETag", s3ETag(metaFile))
+	w.Header().Set("Content-Type", fileContentType(metaFile))
+	w.Header().Set("Last-Modified", metaFile.UpdatedAt.UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.FormatInt(metaFile.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	file, err := app.FileService.LoadFile(metaFile)
+	if err == service.ErrFilePendingScan || err == service.ErrFileInfected {
+		app.audit(r, auditFileDownload, metaFile.UUID, datastruct.AuditBlocked, err.Error())
+		s3Error(w, r, http.StatusForbidden, "AccessDenied", "The object is "+err.Error())
+		return
+	}
+	if err != nil {
+		app.audit(r, auditFileDownload, metaFile.UUID, datastruct.AuditFailure, err.Error())
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+	defer file.Close()
+	app.audit(r, auditFileDownload, metaFile.UUID, datastruct.AuditSuccess, "")
+
+	// Handles ranges and conditional requests
+	rs, ok := file.(io.ReadSeeker)
+	if !ok {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+	http.ServeContent(w, r, name, metaFile.UpdatedAt, rs)
+}
+
+func (app *App) s3PutObject(w http.ResponseWriter, r *http.Request, user *datastruct.User, folder, name string) {
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		s3Error(w, r, http.StatusNotImplemented, "NotImplemented", "CopyObject is not supported")
+		return
+	}
+	size, ok := app.s3ContentLength(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.FileService.CreateFolders(user.ID, folder); err != nil {
+		s3FolderError(w, r, err)
+		return
+	}
+	if name == "" {
+		w.Header().Set("ETag", s3EmptyETag)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	body := &s3Body{r: io.LimitReader(r.Body, size)}
+	metaFile, err := app.storeFile(r, user, folder, name, body)
+	if err != nil {
+		s3StoreError(w, r, err, body.err)
+		return
+	}
+
+	w.Header().Set("ETag", s3ETag(metaFile))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *App) s3DeleteObject(w http.ResponseWriter, r *http.Request, user *datastruct.User, folder, name string) {
+	// Folder markers only go along with their folder when it is empty
+	if name == "" {
+		folders, files, err := app.FileService.ListFolder(user.ID, folder)
+		if err == nil && len(folders) == 0 && len(files) == 0 {
+			err = app.FileService.DeleteFolder(user.ID, folder)
+		}
+		if err != nil && err != service.ErrFolderNotFound {
+			s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	metaFile, err := app.FileService.GetByPath(user.ID, folder, name)
+	if err == service.ErrFileNotFound {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+
+	err = app.FileService.Delete(metaFile)
+	if err == service.ErrFileImmutable {
+		app.audit(r, auditFileDelete, metaFile.UUID, datastruct.AuditBlocked, err.Error())
+		s3Error(w, r, http.StatusForbidden, "AccessDenied", "The object is retained or under legal hold")
+		return
+	}
+	if err != nil {
+		app.audit(r, auditFileDelete, metaFile.UUID, datastruct.AuditFailure, err.Error())
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+	app.audit(r, auditFileDelete, metaFile.UUID, datastruct.AuditSuccess, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) s3CreateMultipartUpload(w http.ResponseWriter, r *http.Request, user *datastruct.User, bucket, key string) {
+	upload, err := app.MultipartService.Create(user.ID, bucket, key)
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+
+	s3Send(w, http.StatusOK, dto.S3InitiateMultipartUploadResponse{
+		Xmlns:    dto.S3Namespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: upload.UploadID,
+	})
+}
+
+func (app *App) s3UploadPart(w http.ResponseWriter, r *http.Request, user *datastruct.User, bucket, key string) {
+	upload, ok := app.s3MultipartUpload(w, r, user, bucket, key)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil {
+		s3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid part number")
+		return
+	}
+	size, ok := app.s3ContentLength(w, r)
+	if !ok {
+		return
+	}
+
+	body := &s3Body{r: io.LimitReader(r.Body, size)}
+	etag, err := app.MultipartService.PutPart(upload, number, body)
+	if err == service.ErrPartInvalid {
+		s3Error(w, r, http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("Part numbers must be within 1 and %d", service.MaxParts))
+		return
+	}
+	if err == service.ErrUploadTooLarge {
+		s3Error(w, r, http.StatusBadRequest, "EntityTooLarge", fmt.Sprintf("Max file size is %d bytes", app.Config.Limits.MaxFileSize))
+		return
+	}
+	if err != nil {
+		s3StoreError(w, r, err, body.err)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *App) s3CompleteMultipartUpload(w http.ResponseWriter, r *http.Request, user *datastruct.User, bucket, key, folder, name string) {
+	upload, ok := app.s3MultipartUpload(w, r, user, bucket, key)
+	if !ok {
+		return
+	}
+	if name == "" {
+		s3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Folder markers cannot be uploaded in parts")
+		return
+	}
+
+	var req dto.S3CompleteMultipartUploadRequest
+	if err := xml.NewDecoder(io.LimitReader(r.Body, s3MaxCompleteBody)).Decode(&req); err != nil {
+		s3Error(w, r, http.StatusBadRequest, "MalformedXML", "The XML is not well-formed")
+		return
+	}
+	parts := make([]service.CompletedPart, len(req.Parts))
+	for i, part := range req.Parts {
+		parts[i] = service.CompletedPart{Number: part.PartNumber, ETag: part.ETag}
+	}
+
+	content, size, err := app.MultipartService.Assemble(upload, parts)
+	if err == service.ErrPartInvalid {
+		s3Error(w, r, http.StatusBadRequest, "InvalidPart", "A part is missing, unordered or does not match its ETag")
+		return
+	}
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+	defer content.Close()
+	if size > app.Config.Limits.MaxFileSize {
+		s3Error(w, r, http.StatusBadRequest, "EntityTooLarge", fmt.Sprintf("Max file size is %d bytes", app.Config.Limits.MaxFileSize))
+		return
+	}
+
+	if err := app.FileService.CreateFolders(user.ID, folder); err != nil {
+		s3FolderError(w, r, err)
+		return
+	}
+	metaFile, err := app.storeFile(r, user, folder, name, content)
+	if err != nil {
+		s3StoreError(w, r, err, nil)
+		return
+	}
+
+	if err := app.MultipartService.Abort(upload); err != nil {
+		logrus.Errorf("cannot remove parts of upload %s: %v", upload.UploadID, err)
+	}
+
+	s3Send(w, http.StatusOK, dto.S3CompleteMultipartUploadResponse{
+		Xmlns:    dto.S3Namespace,
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     s3ETag(metaFile),
+	})
+}
+
+func (app *App) s3AbortMultipartUpload(w http.ResponseWriter, r *http.Request, user *datastruct.User, bucket, key string) {
+	upload, ok := app.s3MultipartUpload(w, r, user, bucket, key)
+	if !ok {
+		return
+	}
+
+	if err := app.MultipartService.Abort(upload); err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// s3MultipartUpload returns the multipart upload of the request, which must be for the object.
+func (app *App) s3MultipartUpload(w http.ResponseWriter, r *http.Request, user *datastruct.User, bucket, key string) (datastruct.MultipartUpload, bool) {
+	upload, err := app.MultipartService.Get(user.ID, r.URL.Query().Get("uploadId"))
+	if err == service.ErrUploadNotFound || (err == nil && (upload.Bucket != bucket || upload.Key != key)) {
+		s3Error(w, r, http.StatusNotFound, "NoSuchUpload", "The multipart upload does not exist")
+		return upload, false
+	}
+	if err != nil {
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+		return upload, false
+	}
+
+	return upload, true
+}
+
+// s3ContentLength returns the length of the payload, decoded if streamed in chunks,
+// which must be known and within the max file size.
+func (app *App) s3ContentLength(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	size := r.ContentLength
+	if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" {
+		var err error
+		if size, err = strconv.ParseInt(decoded, 10, 64); err != nil {
+			s3Error(w, r, http.StatusBadRequest, "InvalidArgument", "Invalid decoded content length")
+			return 0, false
+		}
+	}
+	if size < 0 {
+		s3Error(w, r, http.StatusLengthRequired, "MissingContentLength", "The content length is required")
+		return 0, false
+	}
+	if size > app.Config.Limits.MaxFileSize {
+		s3Error(w, r, http.StatusBadRequest, "EntityTooLarge", fmt.Sprintf("Max file size is %d bytes", app.Config.Limits.MaxFileSize))
+		return 0, false
+	}
+
+	return size, true
+}
+
+// s3Body records the error reading the payload, to tell the signature
+// errors of the payload from the storage ones.
+type s3Body struct {
+	r   io.Reader
+	err error
+}
+
+func (b *s3Body) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// s3StoreError sends the error of storing an object or a part, given the error reading its payload.
+func s3StoreError(w http.ResponseWriter, r *http.Request, err, bodyErr error) {
+	switch {
+	case bodyErr == utils.ErrSigV4Mismatch:
+		s3Error(w, r, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The payload does not match its signed hash")
+	case bodyErr != nil:
+		s3Error(w, r, http.StatusBadRequest, "IncompleteBody", "The payload is incomplete or malformed")
+	case err == service.ErrFileImmutable:
+		s3Error(w, r, http.StatusForbidden, "AccessDenied", "The object is retained or under legal hold")
+	case err == service.ErrFileInfected:
+		s3Error(w, r, http.StatusForbidden, "AccessDenied", "The object is infected and quarantined")
+	default:
+		s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+	}
+}
+
+// s3FolderError sends the error of creating the folders of an object key.
+func s3FolderError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == service.ErrFolderExists {
+		s3Error(w, r, http.StatusConflict, "InvalidArgument", "An object already exists with the name of a parent folder")
+		return
+	}
+	s3Error(w, r, http.StatusInternalServerError, "InternalError", "Internal error")
+}
+
+// ETag of the empty content.
+const s3EmptyETag = `"d41d8cd98f00b204e9800998ecf8427e"`
+
+// s3ETag returns the ETag of the file, the MD5 of its content when known.
+func s3ETag(metaFile datastruct.File) string {
+	if metaFile.MD5 != "" {
+		return `"` + metaFile.MD5 + `"`
+	}
+	return `"` + metaFile.UUID + `"`
+}
+
+// s3Time returns the time in UTC with the millisecond precision of S3.
+func s3Time(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+// s3Send sends the S3 XML document.
+func s3Send(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("cannot encode S3 response: %v", err)
+	}
+}
+
+// s3Error sends the S3 XML error.
+func s3Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	s3Send(w, status, dto.S3Error{
+		Code:      code,
+		Message:   message,
+		Resource:  r.URL.Path,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
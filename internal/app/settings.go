@@ -0,0 +1,56 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/pkg/dto"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// GetSettings returns the settings of the user, along with the effective ones.
+func (app *App) GetSettings(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	common.EncodeJSONAndSend(w, app.settingsResponse(user))
+}
+
+// UpdateSettings replaces the settings of the user. Null settings fall back to the server defaults.
+func (app *App) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	var req dto.UserSettingsRequest
+	err := common.DecodeJSONBody(w, r, &req)
+	if err != nil {
+		common.HandleDecodeError(w, err)
+		return
+	}
+
+	updated, err := app.UserService.SetImagePrivacy(user.ID, req.ScrubImageMetadata, req.KeepImageOriginal)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditSettingsUpdate, "", datastruct.AuditFailure, err.Error())
+		http.Error(w, "error updating settings", http.StatusInternalServerError)
+		return
+	}
+
+	res := app.settingsResponse(updated)
+	app.audit(r, auditSettingsUpdate, "", datastruct.AuditSuccess,
+		fmt.Sprintf("scrubImageMetadata=%t keepImageOriginal=%t", res.ScrubImageMetadata, res.KeepImageOriginal))
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+func (app *App) settingsResponse(user *datastruct.User) dto.UserSettingsResponse {
+	scrub, keepOriginal := app.imagePrivacy(user)
+	return dto.UserSettingsResponse{
+		ScrubImageMetadata: scrub,
+		KeepImageOriginal:  keepOriginal,
+		Overrides: dto.UserSettingsRequest{
+			ScrubImageMetadata: user.ScrubImageMetadata,
+			KeepImageOriginal:  user.KeepImageOriginal,
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetDeletionStatus returns the state of the pending blob deletions.
+func (app *App) GetDeletionStatus(w http.ResponseWriter, r *http.Request) {
+	res, err := app.DeletionWorker.Status()
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+// ListVolumes returns the storage volumes with their usage and the state of their drain.
+func (app *App) ListVolumes(w http.ResponseWriter, r *http.Request) {
+	volumes, err := app.StoragePool.Volumes()
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	common.EncodeJSONAndSend(w, dto.ListVolumesResponse{
+		Count:   len(volumes),
+		Volumes: volumes,
+	})
+}
+
+// DrainVolume stops placing new blobs on the volume with the given name and
+// relocates its blobs to the other volumes in background.
+func (app *App) DrainVolume(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	err := app.StoragePool.Drain(name)
+	if err == service.ErrVolumeNotFound {
+		http.Error(w, "Volume not found", http.StatusNotFound)
+		return
+	}
+	if err == service.ErrVolumeDraining {
+		http.Error(w, "Volume already draining", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.audit(r, auditVolumeDrain, name, datastruct.AuditFailure, err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditVolumeDrain, name, datastruct.AuditSuccess, "")
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ListReplicas returns the replicas with the number of blobs they lack and the state of their re-sync.
+func (app *App) ListReplicas(w http.ResponseWriter, r *http.Request) {
+	replicas := []dto.ReplicaResponse{}
+	if app.Replicator != nil {
+		var err error
+		if replicas, err = app.Replicator.Status(); err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	common.EncodeJSONAndSend(w, dto.ListReplicasResponse{
+		Count:    len(replicas),
+		Replicas: replicas,
+	})
+}
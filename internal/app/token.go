@@ -0,0 +1,95 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// CreateAppToken creates an app token for the user, returning its value only once.
+func (app *App) CreateAppToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	var req dto.CreateAppTokenRequest
+	err := common.DecodeJSONBody(w, r, &req)
+	if err != nil {
+		common.HandleDecodeError(w, err)
+		return
+	}
+
+	appToken, token, err := app.UserService.CreateAppToken(user.ID, req.Name)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditTokenCreate, req.Name, datastruct.AuditFailure, err.Error())
+		http.Error(w, "error creating app token", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditTokenCreate, strconv.Itoa(int(appToken.ID)), datastruct.AuditSuccess, req.Name)
+
+	res := appTokenResponse(appToken)
+	res.Token = token
+	common.EncodeJSONAndSend(w, res)
+}
+
+// ListAppTokens returns the app tokens of the user, without their values.
+func (app *App) ListAppTokens(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	tokens, err := app.UserService.ListAppTokens(user.ID)
+	if err != nil {
+		logrus.Errorf(err.Error())
+		http.Error(w, "error getting app tokens", http.StatusInternalServerError)
+		return
+	}
+
+	var res dto.ListAppTokensResponse
+	res.Count = len(tokens)
+	res.Tokens = make([]dto.AppTokenResponse, res.Count)
+	for i, token := range tokens {
+		res.Tokens[i] = appTokenResponse(token)
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+// DeleteAppToken revokes the app token with the given id.
+func (app *App) DeleteAppToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	idParam := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		http.Error(w, "Invalid token id", http.StatusBadRequest)
+		return
+	}
+
+	err = app.UserService.DeleteAppToken(user.ID, uint(id))
+	if err == service.ErrTokenNotFound {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Errorf(err.Error())
+		app.audit(r, auditTokenDelete, idParam, datastruct.AuditFailure, err.Error())
+		http.Error(w, "error deleting app token", http.StatusInternalServerError)
+		return
+	}
+	app.audit(r, auditTokenDelete, idParam, datastruct.AuditSuccess, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func appTokenResponse(token datastruct.AppToken) dto.AppTokenResponse {
+	return dto.AppTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		CreatedAt:  token.CreatedAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
@@ -0,0 +1,443 @@
+package app
+
+import (
+	"context"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/internal/utils"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// Prefix of the WebDAV routes.
+const davPrefix = "/dav"
+
+// Register the WebDAV methods on top of the standard HTTP ones, so routes match them.
+func init() {
+	for _, method := range []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"} {
+		chi.RegisterMethod(method)
+	}
+}
+
+// BasicAuthMiddleware authenticates the user with basic auth, using the email along
+// with either the password or an app token, and populates the context with the user.
+func (app *App) BasicAuthMiddleware(next http.Handler) http.Handler {
+	hfn := func(w http.ResponseWriter, r *http.Request) {
+		unauthorized := func() {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dryve", charset="UTF-8"`)
+			http.Error(w, "wrong username or password", http.StatusUnauthorized)
+		}
+
+		email, secret, ok := r.BasicAuth()
+		if !ok {
+			unauthorized()
+			return
+		}
+
+		user, err := app.UserService.GetUserByEmail(email)
+		if err != nil {
+			app.auditActor(r, 0, auditLogin, email, datastruct.AuditFailure, "basic auth, unknown email")
+			unauthorized()
+			return
+		}
+
+		if !app.UserService.VerifyAppToken(user.ID, secret) && !utils.VerifyPassword(user.Password, secret) {
+			app.auditActor(r, user.ID, auditLogin, email, datastruct.AuditFailure, "basic auth, wrong password or token")
+			unauthorized()
+			return
+		}
+
+		if !user.Verified {
+			http.Error(w, "user not verified", http.StatusUnauthorized)
+			return
+		}
+		if user.Disabled {
+			http.Error(w, "user disabled", http.StatusForbidden)
+			return
+		}
+		if perm := methodPermission(r.Method); !app.Authorizer.Can(user.Role, perm) {
+			app.auditActor(r, user.ID, auditAccessDenied, r.URL.Path, datastruct.AuditBlocked, fmt.Sprintf("role %s lacks %s", user.Role, perm))
+			http.Error(w, fmt.Sprintf("%s permission required", perm), http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxKeyUser, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(hfn)
+}
+
+// WebDAV serves the folders and files of the user over WebDAV.
+func (app *App) WebDAV(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	// Locks are per user, as every user space has its own paths
+	locks, _ := app.davLocks.LoadOrStore(user.ID, webdav.NewMemLS())
+
+	h := &webdav.Handler{
+		Prefix:     davPrefix,
+		FileSystem: &davFS{app: app, user: user, r: r},
+		LockSystem: locks.(webdav.LockSystem),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logrus.Debugf("webdav %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	h.ServeHTTP(w, r)
+}
+
+// davFS implements webdav.FileSystem over the space of a user through the FileService.
+type davFS struct {
+	app  *App
+	user *datastruct.User
+	r    *http.Request
+}
+
+func (d *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	_, err := d.app.FileService.CreateFolder(d.user.ID, name)
+	return davError(err)
+}
+
+func (d *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) == 0 {
+		return d.open(name)
+	}
+
+	folder, base := path.Dir(name), path.Base(name)
+	if _, err := d.app.FileService.GetFolder(d.user.ID, folder); err != nil {
+		return nil, davError(err)
+	}
+	if _, err := d.app.FileService.GetFolder(d.user.ID, name); err == nil {
+		return nil, fs.ErrExist
+	}
+
+	// Overwritten files are replaced, so they must be deletable
+	metaFile, err := d.app.FileService.GetByPath(d.user.ID, folder, base)
+	if err == nil {
+		if err := d.app.FileService.CheckMutable(metaFile); err != nil {
+			d.app.audit(d.r, auditFileUpload, metaFile.UUID, datastruct.AuditBlocked, err.Error())
+			return nil, davError(err)
+		}
+	} else if err != service.ErrFileNotFound {
+		return nil, davError(err)
+	}
+
+	tmp, err := os.CreateTemp("", "dryve-dav-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &davWriter{fs: d, folder: folder, name: base, tmp: tmp}, nil
+}
+
+// open opens a folder or a file for reading.
+func (d *davFS) open(name string) (webdav.File, error) {
+	info, err := d.stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &davDir{fs: d, path: name, info: info}, nil
+	}
+	return &davFile{fs: d, info: info}, nil
+}
+
+func (d *davFS) RemoveAll(ctx context.Context, name string) error {
+	info, err := d.stat(name)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		err = d.app.FileService.DeleteFolder(d.user.ID, name)
+		if err == service.ErrFileImmutable {
+			d.app.audit(d.r, auditFileDelete, name, datastruct.AuditBlocked, err.Error())
+		}
+		return davError(err)
+	}
+
+	err = d.app.FileService.Delete(info.file)
+	switch err {
+	case nil:
+		d.app.audit(d.r, auditFileDelete, info.file.UUID, datastruct.AuditSuccess, "")
+	case service.ErrFileImmutable:
+		d.app.audit(d.r, auditFileDelete, info.file.UUID, datastruct.AuditBlocked, err.Error())
+	default:
+		d.app.audit(d.r, auditFileDelete, info.file.UUID, datastruct.AuditFailure, err.Error())
+	}
+	return davError(err)
+}
+
+func (d *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	info, err := d.stat(oldName)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		err = d.app.FileService.MoveFolder(d.user.ID, oldName, newName)
+		if err == service.ErrFileImmutable {
+			d.app.audit(d.r, auditFileMove, oldName, datastruct.AuditBlocked, err.Error())
+		}
+		return davError(err)
+	}
+
+	_, err = d.app.FileService.Move(info.file, path.Dir(newName), path.Base(newName))
+	switch err {
+	case nil:
+		d.app.audit(d.r, auditFileMove, info.file.UUID, datastruct.AuditSuccess, newName)
+	case service.ErrFileImmutable:
+		d.app.audit(d.r, auditFileMove, info.file.UUID, datastruct.AuditBlocked, err.Error())
+	}
+	return davError(err)
+}
+
+func (d *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return d.stat(name)
+}
+
+// stat returns the info of the folder or of the file at the given path.
+// Expired files are gone, even if not purged yet.
+func (d *davFS) stat(name string) (*davFileInfo, error) {
+	folder, err := d.app.FileService.GetFolder(d.user.ID, name)
+	if err == nil {
+		return folderInfo(folder), nil
+	}
+	if err != service.ErrFolderNotFound {
+		return nil, davError(err)
+	}
+
+	metaFile, err := d.app.FileService.GetByPath(d.user.ID, path.Dir(name), path.Base(name))
+	if err != nil {
+		return nil, davError(err)
+	}
+	if metaFile.IsExpired(time.Now()) {
+		return nil, fs.ErrNotExist
+	}
+
+	return fileInfo(metaFile), nil
+}
+
+// davError maps the service errors to the os ones understood by webdav.
+func davError(err error) error {
+	switch err {
+	case service.ErrFileNotFound, service.ErrFolderNotFound:
+		return fs.ErrNotExist
+	case service.ErrFolderExists:
+		return fs.ErrExist
+	case service.ErrFileImmutable, service.ErrFileInfected, service.ErrFilePendingScan, service.ErrFolderBadRequest:
+		return fs.ErrPermission
+	}
+	return err
+}
+
+// davFileInfo implements os.FileInfo, webdav.ETager and webdav.ContentTyper.
+type davFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	file    datastruct.File
+}
+
+func folderInfo(folder datastruct.Folder) *davFileInfo {
+	return &davFileInfo{
+		name:    path.Base(folder.Path),
+		modTime: folder.UpdatedAt,
+		dir:     true,
+	}
+}
+
+func fileInfo(metaFile datastruct.File) *davFileInfo {
+	return &davFileInfo{
+		name:    metaFile.Name,
+		size:    metaFile.Size,
+		modTime: metaFile.UpdatedAt,
+		file:    metaFile,
+	}
+}
+
+func (i *davFileInfo) Name() string       { return i.name }
+func (i *davFileInfo) Size() int64        { return i.size }
+func (i *davFileInfo) ModTime() time.Time { return i.modTime }
+func (i *davFileInfo) IsDir() bool        { return i.dir }
+func (i *davFileInfo) Sys() any           { return nil }
+
+func (i *davFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ETag avoids reading the content, files are immutable so their UUID identifies the content.
+func (i *davFileInfo) ETag(ctx context.Context) (string, error) {
+	if i.dir {
+		return "", webdav.ErrNotImplemented
+	}
+	return fmt.Sprintf(`"%s"`, i.file.UUID), nil
+}
+
+// ContentType returns the type detected on upload, sniffing the content would count as a download.
+func (i *davFileInfo) ContentType(ctx context.Context) (string, error) {
+	return fileContentType(i.file), nil
+}
+
+// davDir is a folder opened for listing.
+type davDir struct {
+	fs      *davFS
+	path    string
+	info    *davFileInfo
+	entries []fs.FileInfo
+	listed  bool
+}
+
+func (d *davDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if !d.listed {
+		folders, files, err := d.fs.app.FileService.ListFolder(d.fs.user.ID, d.path)
+		if err != nil {
+			return nil, davError(err)
+		}
+		now := time.Now()
+		for _, folder := range folders {
+			d.entries = append(d.entries, folderInfo(folder))
+		}
+		for _, metaFile := range files {
+			if !metaFile.IsExpired(now) {
+				d.entries = append(d.entries, fileInfo(metaFile))
+			}
+		}
+		d.listed = true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
+
+func (d *davDir) Stat() (fs.FileInfo, error)                   { return d.info, nil }
+func (d *davDir) Read(p []byte) (int, error)                   { return 0, fs.ErrInvalid }
+func (d *davDir) Write(p []byte) (int, error)                  { return 0, fs.ErrPermission }
+func (d *davDir) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (d *davDir) Close() error                                 { return nil }
+
+// davFile is a file opened for reading, its blob is only loaded when read.
+type davFile struct {
+	fs     *davFS
+	info   *davFileInfo
+	blob   io.ReadSeeker
+	closer io.Closer
+}
+
+// load loads the blob through the FileService, which refuses quarantined files.
+func (f *davFile) load() error {
+	if f.blob != nil {
+		return nil
+	}
+
+	blob, err := f.fs.app.FileService.LoadFile(f.info.file)
+	if err != nil {
+		f.fs.app.audit(f.fs.r, auditFileDownload, f.info.file.UUID, datastruct.AuditBlocked, err.Error())
+		return davError(err)
+	}
+	rs, ok := blob.(io.ReadSeeker)
+	if !ok {
+		blob.Close()
+		return fmt.Errorf("blob of file %s is not seekable", f.info.file.UUID)
+	}
+	f.fs.app.audit(f.fs.r, auditFileDownload, f.info.file.UUID, datastruct.AuditSuccess, "")
+
+	f.blob = rs
+	f.closer = blob
+	return nil
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.blob.Read(p)
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.blob.Seek(offset, whence)
+}
+
+func (f *davFile) Close() error {
+	if f.closer != nil {
+		return f.closer.Close()
+	}
+	return nil
+}
+
+func (f *davFile) Readdir(count int) ([]fs.FileInfo, error) { return nil, fs.ErrInvalid }
+func (f *davFile) Stat() (fs.FileInfo, error)               { return f.info, nil }
+func (f *davFile) Write(p []byte) (int, error)              { return 0, fs.ErrPermission }
+
+// davWriter buffers the written content in a temporary file, uploaded on close.
+type davWriter struct {
+	fs     *davFS
+	folder string
+	name   string
+	tmp    *os.File
+	size   int64
+}
+
+func (f *davWriter) Write(p []byte) (int, error) {
+	if f.size+int64(len(p)) > f.fs.app.Config.Limits.MaxFileSize {
+		return 0, fmt.Errorf("max file size is %d MB", f.fs.app.Config.Limits.MaxFileSize>>20)
+	}
+	n, err := f.tmp.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *davWriter) Close() error {
+	defer os.Remove(f.tmp.Name())
+	defer f.tmp.Close()
+
+	if _, err := f.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err := f.fs.app.storeFile(f.fs.r, f.fs.user, f.folder, f.name, f.tmp)
+	return davError(err)
+}
+
+func (f *davWriter) Stat() (fs.FileInfo, error) {
+	return &davFileInfo{name: f.name, size: f.size, modTime: time.Now()}, nil
+}
+
+func (f *davWriter) Read(p []byte) (int, error)                   { return 0, fs.ErrInvalid }
+func (f *davWriter) Seek(offset int64, whence int) (int64, error) { return 0, fs.ErrInvalid }
+func (f *davWriter) Readdir(count int) ([]fs.FileInfo, error)     { return nil, fs.ErrInvalid }
+
+var _ webdav.FileSystem = (*davFS)(nil)
+var _ webdav.ETager = (*davFileInfo)(nil)
+var _ webdav.ContentTyper = (*davFileInfo)(nil)
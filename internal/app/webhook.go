@@ -0,0 +1,170 @@
+package app
+
+import (
+	"dryve/internal/app/common"
+	"dryve/internal/datastruct"
+	"dryve/internal/service"
+	"dryve/pkg/dto"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CreateWebhook registers a webhook for the user, returning its signing secret only once.
+func (app *App) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	var req dto.CreateWebhookRequest
+	err := common.DecodeJSONBody(w, r, &req)
+	if err != nil {
+		common.HandleDecodeError(w, err)
+		return
+	}
+
+	webhook, err := app.WebhookService.Create(user.ID, req.URL, req.Events)
+	if err == service.ErrWebhookBadRequest {
+		http.Error(w, "Invalid webhook url or events, supported events: "+strings.Join(service.EventTypes, ", "), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	res := webhookResponse(webhook)
+	res.Secret = webhook.Secret
+	common.EncodeJSONAndSend(w, res)
+}
+
+// ListWebhooks returns the webhooks of the user.
+func (app *App) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	webhooks, err := app.WebhookService.List(user.ID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var res dto.ListWebhooksResponse
+	res.Count = len(webhooks)
+	res.Webhooks = make([]dto.WebhookResponse, res.Count)
+	for i, webhook := range webhooks {
+		res.Webhooks[i] = webhookResponse(webhook)
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+// DeleteWebhook deletes the webhook with the given id.
+func (app *App) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.WebhookService.Delete(webhook); err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	common.EncodeJSONAndSend(w, webhookResponse(webhook))
+}
+
+// ListWebhookDeliveries returns the delivery log of the webhook with the given id.
+func (app *App) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.WebhookService.ListDeliveries(webhook)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var res dto.ListWebhookDeliveriesResponse
+	res.Count = len(deliveries)
+	res.Deliveries = make([]dto.WebhookDeliveryResponse, res.Count)
+	for i, delivery := range deliveries {
+		res.Deliveries[i] = deliveryResponse(delivery)
+	}
+
+	common.EncodeJSONAndSend(w, res)
+}
+
+// RedeliverWebhook schedules a new delivery of a past delivery of the webhook.
+func (app *App) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.Atoi(chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		http.Error(w, "Invalid delivery id", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := app.WebhookService.Redeliver(webhook, uint(deliveryID))
+	if err == service.ErrWebhookNotFound {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	common.EncodeJSONAndSend(w, deliveryResponse(delivery))
+}
+
+// userWebhook retrieves the webhook with the given id, which must belong to the user.
+func (app *App) userWebhook(w http.ResponseWriter, r *http.Request) (datastruct.Webhook, bool) {
+	user := r.Context().Value(ctxKeyUser).(*datastruct.User)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid webhook id", http.StatusBadRequest)
+		return datastruct.Webhook{}, false
+	}
+
+	webhook, err := app.WebhookService.Get(uint(id))
+	if err == service.ErrWebhookNotFound || (err == nil && webhook.UserID != user.ID) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return webhook, false
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return webhook, false
+	}
+
+	return webhook, true
+}
+
+func webhookResponse(webhook datastruct.Webhook) dto.WebhookResponse {
+	return dto.WebhookResponse{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    strings.Split(webhook.Events, ","),
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+func deliveryResponse(delivery datastruct.WebhookDelivery) dto.WebhookDeliveryResponse {
+	return dto.WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		Event:          delivery.Event,
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    delivery.DeliveredAt,
+	}
+}
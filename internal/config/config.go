@@ -8,16 +8,32 @@ import (
 )
 
 type Config struct {
-	HTTP     HTTPConfig     `mapstructure:"http"`
-	Limits   LimitsConfig   `mapstructure:"limits"`
-	Storage  StorageConfig  `mapstructure:"storage"`
-	Database DatabaseConfig `mapstructure:"database"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Email    EmailConfig    `mapstructure:"email"`
+	HTTP        HTTPConfig        `mapstructure:"http"`
+	Limits      LimitsConfig      `mapstructure:"limits"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	JWT         JWTConfig         `mapstructure:"jwt"`
+	Email       EmailConfig       `mapstructure:"email"`
+	Expiry      ExpiryConfig      `mapstructure:"expiry"`
+	Retention   RetentionConfig   `mapstructure:"retention"`
+	Scan        ScanConfig        `mapstructure:"scan"`
+	Webhooks    WebhooksConfig    `mapstructure:"webhooks"`
+	Presign     PresignConfig     `mapstructure:"presign"`
+	S3          S3Config          `mapstructure:"s3"`
+	Replication ReplicationConfig `mapstructure:"replication"`
+	Privacy     PrivacyConfig     `mapstructure:"privacy"`
+	Import      ImportConfig      `mapstructure:"import"`
+	Stream      StreamConfig      `mapstructure:"stream"`
+	Changes     ChangesConfig     `mapstructure:"changes"`
+	Export      ExportConfig      `mapstructure:"export"`
+	Accounts    AccountsConfig    `mapstructure:"accounts"`
+	RBAC        RBACConfig        `mapstructure:"rbac"`
 }
 
 type HTTPConfig struct {
 	Port int `mapstructure:"port" default:"8666"`
+	// Public URL of the server, used to build links
+	BaseURL string `mapstructure:"base_url" default:"http://localhost:8666"`
 }
 
 type LimitsConfig struct {
@@ -26,7 +42,112 @@ type LimitsConfig struct {
 }
 
 type StorageConfig struct {
+	// Path of the default volume, also holding the parts of the multipart uploads
 	Path string `mapstructure:"path" default:"/tmp/dryve-file-uploader"`
+	// Volumes the blobs are spread over, only the default volume if empty
+	Volumes []VolumeConfig `mapstructure:"volumes"`
+	// Tiers of the volumes from the fastest to the slowest, no tiering if empty
+	Tiers []TierConfig `mapstructure:"tiers"`
+	// Interval between two runs of the demotion of the idle files to slower tiers
+	TieringIntervalSecs int `mapstructure:"tiering_interval_secs" default:"3600"`
+	// Interval between two runs of the pending deletions worker
+	DeletionIntervalSecs int `mapstructure:"deletion_interval_secs" default:"10"`
+	// Max number of blobs removed by the pending deletions worker per run
+	DeletionBatchSize int `mapstructure:"deletion_batch_size" default:"100"`
+}
+
+// VolumeConfig is a storage volume, i.e. the mount point of a disk.
+type VolumeConfig struct {
+	// Unique name of the volume, recorded on the files it holds
+	Name string `mapstructure:"name"`
+	Path string `mapstructure:"path"`
+	// Share of the new blobs placed on the volume, none if 0
+	Weight int `mapstructure:"weight"`
+	// Free space kept on the volume, which gets no new blobs past it
+	ReservedBytes int64 `mapstructure:"reserved_bytes"`
+	// Name of the tier of the volume, the first tier if empty
+	Tier string `mapstructure:"tier"`
+}
+
+// TierConfig is a class of volumes, e.g. fast SSDs or a slow archive.
+type TierConfig struct {
+	Name string `mapstructure:"name"`
+	// Days without access after which files are demoted to the next tier, never if 0
+	DemoteAfterDays int `mapstructure:"demote_after_days"`
+}
+
+type ReplicationConfig struct {
+	// Locations the blobs are mirrored to, e.g. the mount points of other disks
+	Replicas []ReplicaConfig `mapstructure:"replicas"`
+	// Consistency mode, "sync" acknowledges uploads once on all the replicas, "async" once on the primary
+	Mode string `mapstructure:"mode" default:"async"`
+	// Interval between two runs of the re-sync of the lagging replicas
+	IntervalSecs int `mapstructure:"interval_secs" default:"300"`
+	// Max number of blobs copied to a replica per batch of the re-sync
+	BatchSize int `mapstructure:"batch_size" default:"100"`
+}
+
+// ReplicaConfig is a location holding a copy of every clean blob.
+type ReplicaConfig struct {
+	// Unique name of the replica, recorded on the copies it holds
+	Name string `mapstructure:"name"`
+	Path string `mapstructure:"path"`
+}
+
+// PrivacyConfig holds the defaults of the privacy settings, which users can override.
+type PrivacyConfig struct {
+	// Whether the EXIF, XMP and GPS metadata of the uploaded JPEG and PNG images is removed
+	ScrubImageMetadata bool `mapstructure:"scrub_image_metadata" default:"false"`
+	// Whether the original of the scrubbed images is kept as a private version
+	KeepImageOriginal bool `mapstructure:"keep_image_original" default:"false"`
+}
+
+// ImportConfig holds the settings of the imports of files from remote URLs.
+type ImportConfig struct {
+	// Max number of redirects followed by a fetch
+	MaxRedirects int `mapstructure:"max_redirects" default:"5"`
+	// Max duration of a fetch
+	TimeoutSecs int `mapstructure:"timeout_secs" default:"3600"`
+	// Max number of fetches running at once, the others waiting for their turn
+	MaxConcurrent int `mapstructure:"max_concurrent" default:"4"`
+}
+
+// StreamConfig holds the settings of the real-time event stream.
+type StreamConfig struct {
+	// Number of latest events kept for the reconnecting clients to resume from
+	HistorySize int `mapstructure:"history_size" default:"10000"`
+	// Number of events queued per client, slower clients being disconnected
+	BufferSize int `mapstructure:"buffer_size" default:"64"`
+	// Interval of the keepalives sent to idle clients
+	KeepaliveSecs int `mapstructure:"keepalive_secs" default:"30"`
+}
+
+// ChangesConfig holds the settings of the change journal.
+type ChangesConfig struct {
+	// Number of days the changes are kept, older cursors requiring a full resync
+	RetentionDays int `mapstructure:"retention_days" default:"30"`
+	// Interval of the removal of the changes past the retention
+	PruneIntervalSecs int `mapstructure:"prune_interval_secs" default:"3600"`
+}
+
+// ExportConfig holds the settings of the exports of the user data.
+type ExportConfig struct {
+	// Directory holding the export archives until they expire
+	Path string `mapstructure:"path" default:"/tmp/dryve-exports"`
+	// Number of hours the archive and its download link are valid
+	LinkTTLHours int `mapstructure:"link_ttl_hours" default:"72"`
+	// Max number of archives built at once, the others waiting for their turn
+	MaxConcurrent int `mapstructure:"max_concurrent" default:"2"`
+	// Interval of the removal of the expired archives
+	PruneIntervalSecs int `mapstructure:"prune_interval_secs" default:"3600"`
+}
+
+// AccountsConfig holds the settings of the deletion of the user accounts.
+type AccountsConfig struct {
+	// Number of days during which a requested deletion can be cancelled
+	DeletionGraceDays int `mapstructure:"deletion_grace_days" default:"14"`
+	// Interval between two runs of the deletion of the accounts past their grace period
+	DeletionIntervalSecs int `mapstructure:"deletion_interval_secs" default:"3600"`
 }
 
 type DatabaseConfig struct {
@@ -38,10 +159,20 @@ type DatabaseConfig struct {
 	Database string `mapstructure:"db_name" default:"not_set_db_name"`
 }
 
+type RBACConfig struct {
+	// Permissions by role, defining custom roles or replacing the defaults of the admin and user roles.
+	// "*" grants every permission and "files:*" every permission on files.
+	Roles map[string][]string `mapstructure:"roles"`
+}
+
 type JWTConfig struct {
 	Key     string `mapstructure:"key" default:"dryve"`
 	Issuer  string `mapstructure:"issuer" default:"dryve"`
-	TTLMins int    `mapstructure:"ttl_mins" default:"999999"`
+	TTLMins int    `mapstructure:"ttl_mins" default:"15"`
+	// Lifetime of the refresh tokens, rotated on each use
+	RefreshTTLHours int `mapstructure:"refresh_ttl_hours" default:"720"`
+	// Interval between the prunes of the expired refresh tokens and revocations
+	PruneIntervalSecs int `mapstructure:"prune_interval_secs" default:"3600"`
 }
 
 type EmailConfig struct {
@@ -52,6 +183,60 @@ type EmailConfig struct {
 	Password string `mapstructure:"password" default:"password"`
 }
 
+type ExpiryConfig struct {
+	// Max time to live of an uploaded file by user role, unlimited for missing roles
+	MaxTTLHours map[string]int `mapstructure:"max_ttl_hours"`
+	// Interval between two runs of the expired files reaper
+	ReaperIntervalSecs int `mapstructure:"reaper_interval_secs" default:"60"`
+}
+
+type RetentionConfig struct {
+	// Retention period of an uploaded file by user role, during which it cannot be
+	// deleted or renamed, not retained for missing roles
+	Days map[string]int `mapstructure:"days"`
+}
+
+type ScanConfig struct {
+	// Enables the malware scan of uploaded files
+	Enabled bool `mapstructure:"enabled" default:"false"`
+	// Network of the clamd daemon, "tcp" or "unix"
+	Network string `mapstructure:"network" default:"tcp"`
+	// Address of the clamd daemon, host:port or socket path
+	Address string `mapstructure:"address" default:"localhost:3310"`
+	// Scan policy, "sync" blocks uploads until scanned, "async" scans them in background
+	Mode        string `mapstructure:"mode" default:"sync"`
+	TimeoutSecs int    `mapstructure:"timeout_secs" default:"60"`
+	// Interval between two runs of the background scan of pending files
+	IntervalSecs int `mapstructure:"interval_secs" default:"10"`
+}
+
+type WebhooksConfig struct {
+	// Max number of attempts of a delivery before giving up
+	MaxAttempts int `mapstructure:"max_attempts" default:"8"`
+	TimeoutSecs int `mapstructure:"timeout_secs" default:"10"`
+	// Interval between two runs of the deliveries worker
+	IntervalSecs int `mapstructure:"interval_secs" default:"5"`
+}
+
+type PresignConfig struct {
+	// Key signing the presigned URLs, required: the server does not start without it
+	Key string `mapstructure:"key"`
+	// Max validity of a presigned URL
+	MaxTTLSecs int64 `mapstructure:"max_ttl_secs" default:"604800"`
+}
+
+type S3Config struct {
+	// Enables the S3 compatible API on its own listener
+	Enabled bool `mapstructure:"enabled" default:"false"`
+	Port    int  `mapstructure:"port" default:"8667"`
+	// Region expected in the signatures of the requests
+	Region string `mapstructure:"region" default:"us-east-1"`
+	// Age past which the incomplete multipart uploads are aborted
+	MultipartTTLHours int `mapstructure:"multipart_ttl_hours" default:"24"`
+	// Interval of the removal of the abandoned multipart uploads
+	MultipartPruneIntervalSecs int `mapstructure:"multipart_prune_interval_secs" default:"3600"`
+}
+
 // NewConfig creates a new config
 // It reads the config file and unmarshals it into a Config struct
 func NewConfig(file string) Config {
@@ -9,14 +9,18 @@ func TestNewConfig(t *testing.T) {
 	given := NewConfig("../../test/testconfig.json")
 	exp := Config{
 		HTTP: HTTPConfig{
-			Port: 8666,
+			Port:    8666,
+			BaseURL: "http://localhost:8666",
 		},
 		Limits: LimitsConfig{
 			MaxFileSize:            52428800,
 			FileEndpointsRateLimit: 10,
 		},
 		Storage: StorageConfig{
-			Path: "/tmp/dryve-filestorage",
+			Path:                 "/tmp/dryve-filestorage",
+			DeletionIntervalSecs: 10,
+			DeletionBatchSize:    100,
+			TieringIntervalSecs:  3600,
 		},
 		Database: DatabaseConfig{
 			Driver:   "postgres",
@@ -34,9 +38,69 @@ func TestNewConfig(t *testing.T) {
 			Password: "password",
 		},
 		JWT: JWTConfig{
-			Key:     "dryve",
-			Issuer:  "dryve",
-			TTLMins: 999999,
+			Key:               "dryve",
+			Issuer:            "dryve",
+			TTLMins:           15,
+			RefreshTTLHours:   720,
+			PruneIntervalSecs: 3600,
+		},
+		Expiry: ExpiryConfig{
+			ReaperIntervalSecs: 60,
+		},
+		Scan: ScanConfig{
+			Network:      "tcp",
+			Address:      "localhost:3310",
+			Mode:         "sync",
+			TimeoutSecs:  60,
+			IntervalSecs: 10,
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:  8,
+			TimeoutSecs:  10,
+			IntervalSecs: 5,
+		},
+		Presign: PresignConfig{
+			MaxTTLSecs: 604800,
+		},
+		S3: S3Config{
+			Enabled:                    false,
+			Port:                       8667,
+			Region:                     "us-east-1",
+			MultipartTTLHours:          24,
+			MultipartPruneIntervalSecs: 3600,
+		},
+		Replication: ReplicationConfig{
+			Mode:         "async",
+			IntervalSecs: 300,
+			BatchSize:    100,
+		},
+		Privacy: PrivacyConfig{
+			ScrubImageMetadata: false,
+			KeepImageOriginal:  false,
+		},
+		Import: ImportConfig{
+			MaxRedirects:  5,
+			TimeoutSecs:   3600,
+			MaxConcurrent: 4,
+		},
+		Stream: StreamConfig{
+			HistorySize:   10000,
+			BufferSize:    64,
+			KeepaliveSecs: 30,
+		},
+		Changes: ChangesConfig{
+			RetentionDays:     30,
+			PruneIntervalSecs: 3600,
+		},
+		Export: ExportConfig{
+			Path:              "/tmp/dryve-exports",
+			LinkTTLHours:      72,
+			MaxConcurrent:     2,
+			PruneIntervalSecs: 3600,
+		},
+		Accounts: AccountsConfig{
+			DeletionGraceDays:    14,
+			DeletionIntervalSecs: 3600,
 		},
 	}
 
@@ -49,14 +113,18 @@ func TestNewConfigDefaults(t *testing.T) {
 	given := NewConfig("../../test/testconfig_defaults.json")
 	exp := Config{
 		HTTP: HTTPConfig{
-			Port: 8666,
+			Port:    8666,
+			BaseURL: "http://localhost:8666",
 		},
 		Limits: LimitsConfig{
 			MaxFileSize:            52428800,
 			FileEndpointsRateLimit: 10,
 		},
 		Storage: StorageConfig{
-			Path: "/tmp/dryve-file-uploader",
+			Path:                 "/tmp/dryve-file-uploader",
+			DeletionIntervalSecs: 10,
+			DeletionBatchSize:    100,
+			TieringIntervalSecs:  3600,
 		},
 		Database: DatabaseConfig{
 			Driver:   "postgres",
@@ -74,9 +142,69 @@ func TestNewConfigDefaults(t *testing.T) {
 			Password: "password",
 		},
 		JWT: JWTConfig{
-			Key:     "dryve",
-			Issuer:  "dryve",
-			TTLMins: 999999,
+			Key:               "dryve",
+			Issuer:            "dryve",
+			TTLMins:           15,
+			RefreshTTLHours:   720,
+			PruneIntervalSecs: 3600,
+		},
+		Expiry: ExpiryConfig{
+			ReaperIntervalSecs: 60,
+		},
+		Scan: ScanConfig{
+			Network:      "tcp",
+			Address:      "localhost:3310",
+			Mode:         "sync",
+			TimeoutSecs:  60,
+			IntervalSecs: 10,
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:  8,
+			TimeoutSecs:  10,
+			IntervalSecs: 5,
+		},
+		Presign: PresignConfig{
+			MaxTTLSecs: 604800,
+		},
+		S3: S3Config{
+			Enabled:                    false,
+			Port:                       8667,
+			Region:                     "us-east-1",
+			MultipartTTLHours:          24,
+			MultipartPruneIntervalSecs: 3600,
+		},
+		Replication: ReplicationConfig{
+			Mode:         "async",
+			IntervalSecs: 300,
+			BatchSize:    100,
+		},
+		Privacy: PrivacyConfig{
+			ScrubImageMetadata: false,
+			KeepImageOriginal:  false,
+		},
+		Import: ImportConfig{
+			MaxRedirects:  5,
+			TimeoutSecs:   3600,
+			MaxConcurrent: 4,
+		},
+		Stream: StreamConfig{
+			HistorySize:   10000,
+			BufferSize:    64,
+			KeepaliveSecs: 30,
+		},
+		Changes: ChangesConfig{
+			RetentionDays:     30,
+			PruneIntervalSecs: 3600,
+		},
+		Export: ExportConfig{
+			Path:              "/tmp/dryve-exports",
+			LinkTTLHours:      72,
+			MaxConcurrent:     2,
+			PruneIntervalSecs: 3600,
+		},
+		Accounts: AccountsConfig{
+			DeletionGraceDays:    14,
+			DeletionIntervalSecs: 3600,
 		},
 	}
 
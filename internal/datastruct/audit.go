@@ -0,0 +1,33 @@
+package datastruct
+
+import "time"
+
+// AuditEntry is an append-only record of a security- or data-relevant action,
+// hence it is never updated nor soft deleted.
+type AuditEntry struct {
+	ID uint `gorm:"primarykey"`
+	// Time of the action
+	CreatedAt time.Time `gorm:"index"`
+	// Action performed, e.g. file.delete
+	Action string `gorm:"index"`
+	// ID of the user performing the action, zero if anonymous
+	ActorID uint `gorm:"index"`
+	// IP address of the actor
+	IP string
+	// ID of the request performing the action
+	RequestID string
+	// Target of the action, e.g. a file UUID
+	Target string `gorm:"index"`
+	// Outcome of the action
+	Outcome AuditOutcome
+	// Additional details about the outcome
+	Detail string
+}
+
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+	AuditBlocked AuditOutcome = "blocked"
+)
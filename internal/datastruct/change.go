@@ -0,0 +1,40 @@
+package datastruct
+
+import "time"
+
+// Change is an entry of the change journal of a user space, ordered by ID per user.
+type Change struct {
+	// Position of the change in the journal
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	// ID of the user owning the changed file or folder
+	UserID uint `gorm:"index"`
+	Kind   ChangeKind
+	Op     ChangeOp
+	// UUID of the changed file, empty for folders
+	FileUUID string
+	// Path of the file or folder after the change, before it for deletions
+	Path string
+	// Path of the file or folder before a move
+	OldPath string
+	// Size and checksum of the changed file
+	Size int64
+	MD5  string
+}
+
+type ChangeKind string
+
+const (
+	ChangeFile   ChangeKind = "file"
+	ChangeFolder ChangeKind = "folder"
+)
+
+type ChangeOp string
+
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeUpdate ChangeOp = "update"
+	// The descendants of a moved folder move along, without changes of their own
+	ChangeMove   ChangeOp = "move"
+	ChangeDelete ChangeOp = "delete"
+)
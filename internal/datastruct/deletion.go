@@ -0,0 +1,28 @@
+package datastruct
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PendingDeletion is an outbox entry for a blob that must be removed from storage.
+// It is written in the same transaction that deletes the file metadata, so the
+// blob removal survives crashes and is retried until it succeeds.
+type PendingDeletion struct {
+	gorm.Model
+	// UUID of the deleted file
+	FileUUID string `gorm:"index"`
+	// Name of the storage volume holding the blob
+	Volume string `gorm:"default:default"`
+	// Filename of the blob on the server, relative to its volume
+	Filename string
+	// Whether the copies on the replicas are kept, when only the blob was relocated
+	KeepReplicas bool
+	// Number of failed removal attempts
+	Attempts int
+	// Last removal error, if any
+	LastError string
+	// Earliest time of the next removal attempt
+	NextAttemptAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,42 @@
+package datastruct
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExportJob is the background build of an archive of all the data of a user.
+type ExportJob struct {
+	gorm.Model
+	// ID of the user exporting their data
+	UserID uint `gorm:"index"`
+	// Status of the export
+	Status ExportStatus `gorm:"index"`
+	// Filename of the archive, relative to the export directory, once done
+	Filename string
+	// Size of the archive in bytes
+	Size int64
+	// Number of files in the archive
+	Files int
+	// Number of files left out of the archive, as quarantined or unreadable
+	Skipped int
+	// Reason of the failure, if any
+	Error string
+	// Time the build started, nil while pending
+	StartedAt *time.Time
+	// Time the build ended, nil until done or failed
+	FinishedAt *time.Time
+	// Time after which the archive is removed, nil until done
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportDone    ExportStatus = "done"
+	ExportFailed  ExportStatus = "failed"
+	ExportExpired ExportStatus = "expired"
+)
@@ -1,15 +1,66 @@
 package datastruct
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type File struct {
 	gorm.Model
+	// ID of the user owning the file
+	UserID uint `gorm:"index"`
 	// UUID of the file used for the filename
 	UUID string `gorm:"index:idx_uuid,unique"`
-	// Original filename
+	// Original filename, normalized
 	Name string
+	// Path of the folder holding the file
+	Folder string `gorm:"default:/;index"`
 	// Size of the file
 	Size int64
-	// Filename of the file on the server
+	// Hex encoded MD5 of the content, the ETag of the S3 API
+	MD5 string
+	// MIME type of the content, detected on upload
+	ContentType string
+	// Name of the storage volume holding the blob
+	Volume string `gorm:"default:default;index"`
+	// Filename of the file on the server, relative to its volume
 	Filename string
+	// Time after which the file is gone and gets purged, nil if it never expires
+	ExpiresAt *time.Time `gorm:"index"`
+	// Time until which the file cannot be deleted or renamed, nil if not retained
+	RetainUntil *time.Time
+	// Whether the file is under legal hold, preventing deletes and renames until released
+	LegalHold bool
+	// Whether the image metadata was removed on upload
+	Scrubbed bool
+	// Kinds of image metadata removed on upload, comma separated
+	ScrubbedMetadata string
+	// UUID of the scrubbed file this file is the private original of, empty otherwise.
+	// Originals are hidden from the listings and only downloaded by their owner.
+	OriginalOf string `gorm:"default:'';index"`
+	// Time of the last download of the file, nil if never downloaded
+	LastAccessedAt *time.Time `gorm:"index"`
+	// Malware scan status, only clean files can be downloaded
+	ScanStatus ScanStatus `gorm:"default:clean;index"`
+	// Signature found by the malware scan, if infected
+	ScanSignature string
+}
+
+type ScanStatus string
+
+const (
+	ScanPending  ScanStatus = "pending"
+	ScanClean    ScanStatus = "clean"
+	ScanInfected ScanStatus = "infected"
+)
+
+// IsExpired reports whether the file expired at the given time.
+func (f File) IsExpired(now time.Time) bool {
+	return f.ExpiresAt != nil && !now.Before(*f.ExpiresAt)
+}
+
+// IsRetained reports whether the retention period of the file is running at the given time.
+func (f File) IsRetained(now time.Time) bool {
+	return f.RetainUntil != nil && now.Before(*f.RetainUntil)
 }
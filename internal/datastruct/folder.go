@@ -0,0 +1,18 @@
+package datastruct
+
+import "gorm.io/gorm"
+
+// Root folder of every user space.
+const RootFolder = "/"
+
+// Folder is a directory of a user space holding files and other folders.
+// The root folder is implicit and never stored.
+type Folder struct {
+	gorm.Model
+	// ID of the user owning the folder
+	UserID uint `gorm:"index:idx_folder_path,unique"`
+	// Absolute slash separated path of the folder, e.g. /reports/2023
+	Path string `gorm:"index:idx_folder_path,unique"`
+	// Path of the parent folder
+	Parent string `gorm:"index"`
+}
@@ -0,0 +1,39 @@
+package datastruct
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ImportJob is the background fetch of a file from a remote URL.
+type ImportJob struct {
+	gorm.Model
+	// ID of the user importing the file
+	UserID uint `gorm:"index"`
+	// URL of the fetched file
+	URL string
+	// Name of the imported file, from the request or else the response
+	Name string
+	// Status of the import
+	Status ImportStatus `gorm:"index"`
+	// Number of bytes fetched
+	Size int64
+	// UUID of the imported file, once done
+	FileUUID string
+	// Reason of the failure, if any
+	Error string
+	// Time the fetch started, nil while pending
+	StartedAt *time.Time
+	// Time the import ended, nil until done or failed
+	FinishedAt *time.Time
+}
+
+type ImportStatus string
+
+const (
+	ImportPending ImportStatus = "pending"
+	ImportRunning ImportStatus = "running"
+	ImportDone    ImportStatus = "done"
+	ImportFailed  ImportStatus = "failed"
+)
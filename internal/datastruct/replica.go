@@ -0,0 +1,14 @@
+package datastruct
+
+import (
+	"gorm.io/gorm"
+)
+
+// Replica records that a replica location holds a copy of the blob of a file.
+type Replica struct {
+	gorm.Model
+	// UUID of the replicated file
+	FileUUID string `gorm:"index:idx_replica,unique"`
+	// Name of the replica location
+	Name string `gorm:"index:idx_replica,unique"`
+}
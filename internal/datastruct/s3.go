@@ -0,0 +1,28 @@
+package datastruct
+
+import "gorm.io/gorm"
+
+// AccessKey is a credential of a user for the S3 API, whose requests are
+// signed with the secret (SigV4), so unlike app tokens the secret is stored.
+type AccessKey struct {
+	gorm.Model
+	// ID of the user owning the key
+	UserID uint `gorm:"index"`
+	// Public identifier of the key, the access key ID of S3 clients
+	KeyID string `gorm:"index:idx_access_key,unique"`
+	// Secret signing the requests, the secret access key of S3 clients
+	Secret string
+}
+
+// MultipartUpload is an S3 multipart upload in progress, whose parts are
+// stored apart until completed into a single file.
+type MultipartUpload struct {
+	gorm.Model
+	// ID of the upload given to the S3 clients
+	UploadID string `gorm:"index:idx_multipart_upload,unique"`
+	// ID of the user owning the upload
+	UserID uint `gorm:"index"`
+	// Bucket and key of the object being uploaded
+	Bucket string
+	Key    string
+}
@@ -0,0 +1,36 @@
+package datastruct
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is a single-use credential of a user, exchanged for a new access token
+// and a new refresh token of the same family, which is rotated from the same login.
+type RefreshToken struct {
+	gorm.Model
+	// ID of the user owning the token
+	UserID uint `gorm:"index"`
+	// SHA-256 hash of the token, which is never stored
+	Hash string `gorm:"index:idx_refresh_token_hash,unique"`
+	// ID shared by the tokens rotated from the same login
+	FamilyID string `gorm:"index"`
+	// ID (jti) and expiration of the access token issued along with the token
+	AccessJTI       string
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time `gorm:"index"`
+	// Time the token was exchanged, a used token presented again reveals a stolen family
+	UsedAt *time.Time
+	// Time the family of the token was revoked, by a logout or a reuse
+	RevokedAt *time.Time
+}
+
+// RevokedToken is an access token revoked before its expiration, by its jti claim.
+type RevokedToken struct {
+	JTI       string `gorm:"primarykey"`
+	UserID    uint   `gorm:"index"`
+	CreatedAt time.Time
+	// Expiration of the token, after which its revocation can be forgotten
+	ExpiresAt time.Time `gorm:"index"`
+}
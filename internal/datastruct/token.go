@@ -0,0 +1,21 @@
+package datastruct
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AppToken is a long-lived credential of a user for clients which cannot
+// use JWTs, such as WebDAV clients authenticating with basic auth.
+type AppToken struct {
+	gorm.Model
+	// ID of the user owning the token
+	UserID uint `gorm:"index"`
+	// Name given by the user to the token
+	Name string
+	// SHA-256 hash of the token, which is never stored
+	Hash string `gorm:"index:idx_token_hash,unique"`
+	// Time of the last use of the token
+	LastUsedAt *time.Time
+}
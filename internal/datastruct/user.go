@@ -1,6 +1,10 @@
 package datastruct
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
@@ -12,6 +16,18 @@ type User struct {
 	Role        Role `gorm:"default:user"`
 	Verified    bool
 	EmailCode   string
+	// Whether the user was disabled by an admin, refusing all their requests until re-enabled
+	Disabled bool
+	// Whether all the files of the user are under legal hold
+	LegalHold bool
+	// Whether the metadata of the uploaded images is removed, nil for the server default
+	ScrubImageMetadata *bool
+	// Whether the original of the scrubbed images is kept, nil for the server default
+	KeepImageOriginal *bool
+	// Time after which the account and all its data are deleted, nil unless requested
+	DeleteAt *time.Time `gorm:"index"`
+	// Access tokens issued before this time are rejected, nil unless all the sessions were revoked
+	TokensValidAfter *time.Time
 }
 
 type Role string
@@ -20,3 +36,31 @@ const (
 	ADMIN Role = "admin"
 	USER  Role = "user"
 )
+
+// Permission is an action granted to roles, named <resource>:<action>
+type Permission string
+
+const (
+	PermFilesRead        Permission = "files:read"
+	PermFilesWrite       Permission = "files:write"
+	PermFilesDelete      Permission = "files:delete"
+	PermFilesDeleteRange Permission = "files:delete_range"
+	PermFilesAdmin       Permission = "files:admin"
+	PermHoldsAdmin       Permission = "holds:admin"
+	PermUsersAdmin       Permission = "users:admin"
+	PermStorageAdmin     Permission = "storage:admin"
+	PermAuditRead        Permission = "audit:read"
+)
+
+// Permissions lists every permission which can be granted
+var Permissions = []Permission{
+	PermFilesRead,
+	PermFilesWrite,
+	PermFilesDelete,
+	PermFilesDeleteRange,
+	PermFilesAdmin,
+	PermHoldsAdmin,
+	PermUsersAdmin,
+	PermStorageAdmin,
+	PermAuditRead,
+}
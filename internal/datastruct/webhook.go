@@ -0,0 +1,64 @@
+package datastruct
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook is an endpoint registered by a user to receive lifecycle events.
+type Webhook struct {
+	gorm.Model
+	// ID of the user owning the webhook
+	UserID uint `gorm:"index"`
+	// URL receiving the events
+	URL string
+	// Secret used to sign the payloads
+	Secret string
+	// Comma separated types of the subscribed events
+	Events string
+}
+
+// Subscribes reports whether the webhook subscribed to the given event type.
+func (w Webhook) Subscribes(eventType string) bool {
+	for _, e := range strings.Split(w.Events, ",") {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an attempted delivery of an event to a webhook.
+type WebhookDelivery struct {
+	gorm.Model
+	// ID of the target webhook
+	WebhookID uint `gorm:"index"`
+	// ID of the delivered event
+	EventID string
+	// Type of the delivered event
+	Event string
+	// Signed JSON payload
+	Payload string
+	// Delivery status
+	Status DeliveryStatus `gorm:"index"`
+	// Number of failed attempts
+	Attempts int
+	// Earliest time of the next attempt
+	NextAttemptAt time.Time `gorm:"index"`
+	// HTTP status of the last response, zero if none
+	ResponseStatus int
+	// Last delivery error, if any
+	LastError string
+	// Time of the successful delivery
+	DeliveredAt *time.Time
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
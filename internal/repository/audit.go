@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Number of entries loaded at once while exporting the audit log.
+const auditExportBatchSize = 500
+
+// AuditFilter restricts the audit entries to query, zero values match everything.
+type AuditFilter struct {
+	Action  string
+	ActorID uint
+	Target  string
+	Outcome datastruct.AuditOutcome
+	From    time.Time
+	To      time.Time
+}
+
+type AuditQuery interface {
+	Create(entry datastruct.AuditEntry) error
+	Search(filter AuditFilter, offset, limit int) ([]datastruct.AuditEntry, int64, error)
+	Export(filter AuditFilter, fn func(datastruct.AuditEntry) error) error
+	ExportAbout(actorID uint, targets []string, fn func(datastruct.AuditEntry) error) error
+}
+
+type auditQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewAuditQuery() AuditQuery {
+	return &auditQuery{d.db}
+}
+
+// Create appends a new audit entry
+func (q *auditQuery) Create(entry datastruct.AuditEntry) error {
+	return q.db.Create(&entry).Error
+}
+
+// Search a page of the entries matching the filter, newest first, along with their total count
+func (q *auditQuery) Search(filter AuditFilter, offset, limit int) ([]datastruct.AuditEntry, int64, error) {
+	var entries []datastruct.AuditEntry
+	var total int64
+
+	err := q.filter(filter).Model(&datastruct.AuditEntry{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = q.filter(filter).Order("id DESC").Offset(offset).Limit(limit).Find(&entries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// Export calls fn on all the entries matching the filter, oldest first
+func (q *auditQuery) Export(filter AuditFilter, fn func(datastruct.AuditEntry) error) error {
+	var entries []datastruct.AuditEntry
+
+	return q.filter(filter).Order("id").FindInBatches(&entries, auditExportBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// ExportAbout calls fn on all the entries performed by the actor or targeting one of the targets, oldest first
+func (q *auditQuery) ExportAbout(actorID uint, targets []string, fn func(datastruct.AuditEntry) error) error {
+	var entries []datastruct.AuditEntry
+
+	tx := q.db.Where("actor_id = ?", actorID)
+	if len(targets) > 0 {
+		tx = q.db.Where("actor_id = ? OR target IN ?", actorID, targets)
+	}
+	return tx.Order("id").FindInBatches(&entries, auditExportBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func (q *auditQuery) filter(filter AuditFilter) *gorm.DB {
+	tx := q.db
+	if filter.Action != "" {
+		tx = tx.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != 0 {
+		tx = tx.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Target != "" {
+		tx = tx.Where("target = ?", filter.Target)
+	}
+	if filter.Outcome != "" {
+		tx = tx.Where("outcome = ?", filter.Outcome)
+	}
+	if !filter.From.IsZero() {
+		tx = tx.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		tx = tx.Where("created_at < ?", filter.To)
+	}
+	return tx
+}
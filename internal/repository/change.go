@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"path"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Namespace of the advisory locks serializing the changes of each user.
+const changeLockSpace = 0x636867
+
+type ChangeQuery interface {
+	List(userID uint, afterID uint, limit int) ([]datastruct.Change, error)
+	Last(userID uint) (datastruct.Change, error)
+	DeleteBefore(before time.Time, limit int) (int64, error)
+}
+
+type changeQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewChangeQuery() ChangeQuery {
+	return &changeQuery{d.db}
+}
+
+// List the changes of a user, by ascending ID after the given one
+func (q *changeQuery) List(userID uint, afterID uint, limit int) ([]datastruct.Change, error) {
+	var changes []datastruct.Change
+	err := q.db.Where("user_id = ? AND id > ?", userID, afterID).Order("id").Limit(limit).Find(&changes).Error
+	return changes, err
+}
+
+// Get the last change of a user
+func (q *changeQuery) Last(userID uint) (datastruct.Change, error) {
+	var change datastruct.Change
+	err := q.db.Where("user_id = ?", userID).Order("id DESC").First(&change).Error
+	return change, err
+}
+
+// DeleteBefore permanently removes up to limit changes recorded before the given time
+func (q *changeQuery) DeleteBefore(before time.Time, limit int) (int64, error) {
+	res := q.db.Where("id IN (?)", q.db.Model(&datastruct.Change{}).Select("id").
+		Where("created_at < ?", before).Order("id").Limit(limit)).
+		Delete(&datastruct.Change{})
+	return res.RowsAffected, res.Error
+}
+
+// recordChanges appends the changes to the journal within the transaction. The journal of each
+// user is locked until the transaction ends, so the IDs of their changes follow the commit order
+// and readers never skip a change committed late.
+func recordChanges(tx *gorm.DB, changes ...datastruct.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	// Locks are taken in the same order by all the transactions, which cannot deadlock
+	var users []int
+	seen := map[uint]bool{}
+	for _, c := range changes {
+		if !seen[c.UserID] {
+			seen[c.UserID] = true
+			users = append(users, int(c.UserID))
+		}
+	}
+	sort.Ints(users)
+	for _, userID := range users {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", changeLockSpace, userID).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Create(&changes).Error
+}
+
+// fileChange returns the change of the given operation on the file.
+func fileChange(file datastruct.File, op datastruct.ChangeOp) datastruct.Change {
+	return datastruct.Change{
+		UserID:   file.UserID,
+		Kind:     datastruct.ChangeFile,
+		Op:       op,
+		FileUUID: file.UUID,
+		Path:     path.Join(file.Folder, file.Name),
+		Size:     file.Size,
+		MD5:      file.MD5,
+	}
+}
+
+// folderChange returns the change of the given operation on the folder of the user.
+func folderChange(userID uint, folderPath string, op datastruct.ChangeOp) datastruct.Change {
+	return datastruct.Change{
+		UserID: userID,
+		Kind:   datastruct.ChangeFolder,
+		Op:     op,
+		Path:   folderPath,
+	}
+}
@@ -11,6 +11,18 @@ import (
 type DAO interface {
 	NewFileQuery() FileQuery
 	NewUserQuery() UserQuery
+	NewDeletionQuery() DeletionQuery
+	NewAuditQuery() AuditQuery
+	NewWebhookQuery() WebhookQuery
+	NewFolderQuery() FolderQuery
+	NewTokenQuery() TokenQuery
+	NewAccessKeyQuery() AccessKeyQuery
+	NewMultipartQuery() MultipartQuery
+	NewReplicaQuery() ReplicaQuery
+	NewImportQuery() ImportQuery
+	NewChangeQuery() ChangeQuery
+	NewExportQuery() ExportQuery
+	NewSessionQuery() SessionQuery
 }
 
 type dao struct {
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DeletionQuery interface {
+	ListDue(now time.Time, limit int) ([]datastruct.PendingDeletion, error)
+	IsReferenced(volume, filename string) (bool, error)
+	Complete(id uint) error
+	Fail(id uint, reason string, next time.Time) error
+	CountPending() (int64, error)
+	CountFailing() (int64, error)
+}
+
+type deletionQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewDeletionQuery() DeletionQuery {
+	return &deletionQuery{d.db}
+}
+
+// List the pending deletions whose next attempt is due
+func (q *deletionQuery) ListDue(now time.Time, limit int) ([]datastruct.PendingDeletion, error) {
+	var pending []datastruct.PendingDeletion
+	err := q.db.Where("next_attempt_at <= ?", now).Order("next_attempt_at").Limit(limit).Find(&pending).Error
+	return pending, err
+}
+
+// Report whether a file references the blob, which was moved back to its volume since enqueued
+func (q *deletionQuery) IsReferenced(volume, filename string) (bool, error) {
+	var count int64
+	err := q.db.Model(&datastruct.File{}).Where("volume = ? AND filename = ?", volume, filename).Count(&count).Error
+	return count > 0, err
+}
+
+// Complete permanently removes the outbox entry once the blob is gone
+func (q *deletionQuery) Complete(id uint) error {
+	return q.db.Unscoped().Delete(&datastruct.PendingDeletion{}, id).Error
+}
+
+// Fail records a failed attempt and schedules the next one
+func (q *deletionQuery) Fail(id uint, reason string, next time.Time) error {
+	return q.db.Model(&datastruct.PendingDeletion{}).Where("id = ?", id).Updates(map[string]any{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      reason,
+		"next_attempt_at": next,
+	}).Error
+}
+
+// Count all the pending deletions
+func (q *deletionQuery) CountPending() (int64, error) {
+	var count int64
+	err := q.db.Model(&datastruct.PendingDeletion{}).Count(&count).Error
+	return count, err
+}
+
+// Count the pending deletions that failed at least once
+func (q *deletionQuery) CountFailing() (int64, error) {
+	var count int64
+	err := q.db.Model(&datastruct.PendingDeletion{}).Where("attempts > 0").Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ExportQuery interface {
+	Create(job datastruct.ExportJob) (datastruct.ExportJob, error)
+	Get(userID, id uint) (datastruct.ExportJob, error)
+	Update(job datastruct.ExportJob) error
+	ListByUser(userID uint) ([]datastruct.ExportJob, error)
+	CountUnfinished(userID uint) (int64, error)
+	FailUnfinished(reason string) (int64, error)
+	ListExpired(now time.Time, limit int) ([]datastruct.ExportJob, error)
+}
+
+type exportQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewExportQuery() ExportQuery {
+	return &exportQuery{d.db}
+}
+
+func (q *exportQuery) Create(job datastruct.ExportJob) (datastruct.ExportJob, error) {
+	err := q.db.Create(&job).Error
+	return job, err
+}
+
+// Get the export job with the given ID, if it belongs to the user
+func (q *exportQuery) Get(userID, id uint) (datastruct.ExportJob, error) {
+	var job datastruct.ExportJob
+	err := q.db.Where("user_id = ? AND id = ?", userID, id).First(&job).Error
+	return job, err
+}
+
+func (q *exportQuery) Update(job datastruct.ExportJob) error {
+	return q.db.Save(&job).Error
+}
+
+// List the export jobs of a user
+func (q *exportQuery) ListByUser(userID uint) ([]datastruct.ExportJob, error) {
+	var jobs []datastruct.ExportJob
+	err := q.db.Where("user_id = ?", userID).Find(&jobs).Error
+	return jobs, err
+}
+
+// CountUnfinished counts the pending and running export jobs of the user
+func (q *exportQuery) CountUnfinished(userID uint) (int64, error) {
+	var count int64
+	err := q.db.Model(&datastruct.ExportJob{}).
+		Where("user_id = ? AND status IN ?", userID, []datastruct.ExportStatus{datastruct.ExportPending, datastruct.ExportRunning}).
+		Count(&count).Error
+	return count, err
+}
+
+// FailUnfinished marks the pending and running export jobs as failed for the given reason
+func (q *exportQuery) FailUnfinished(reason string) (int64, error) {
+	res := q.db.Model(&datastruct.ExportJob{}).
+		Where("status IN ?", []datastruct.ExportStatus{datastruct.ExportPending, datastruct.ExportRunning}).
+		Updates(map[string]any{"status": datastruct.ExportFailed, "error": reason})
+	return res.RowsAffected, res.Error
+}
+
+// List the done export jobs whose archive expired at the given time
+func (q *exportQuery) ListExpired(now time.Time, limit int) ([]datastruct.ExportJob, error) {
+	var jobs []datastruct.ExportJob
+
+	err := q.db.Where("status = ? AND expires_at <= ?", datastruct.ExportDone, now).Order("id").Limit(limit).Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, err
+}
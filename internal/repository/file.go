@@ -2,16 +2,35 @@ package repository
 
 import (
 	"dryve/internal/datastruct"
+	"path"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FileQuery interface {
-	Create(UUID string, Name string, Size int64, Filename string) (datastruct.File, error)
+	Create(file datastruct.File) (datastruct.File, error)
 	Get(UUID string) (datastruct.File, error)
 	Delete(UUID string) error
-	SearchByDateRange(from, to time.Time) ([]datastruct.File, error)
+	DeleteAndEnqueue(files []datastruct.File) error
+	SearchByDateRange(userID uint, from, to time.Time) ([]datastruct.File, error)
+	ListExpired(now time.Time, limit int) ([]datastruct.File, error)
+	SetLegalHold(UUID string, hold bool) error
+	Update(file datastruct.File) error
+	ListByScanStatus(status datastruct.ScanStatus, limit int) ([]datastruct.File, error)
+	ListByFolder(userID uint, folder string) ([]datastruct.File, error)
+	ListInTree(userID uint, folder string) ([]datastruct.File, error)
+	GetByPath(userID uint, folder, name string) (datastruct.File, error)
+	ListByVolume(volume string, afterID uint, limit int) ([]datastruct.File, error)
+	CountByVolume(volume string) (int64, error)
+	Relocate(file datastruct.File, volume string) (int64, error)
+	Touch(UUID string, at time.Time) error
+	ListIdle(volumes []string, before time.Time, afterID uint, limit int) ([]datastruct.File, error)
+	GetOriginal(UUID string) (datastruct.File, error)
+	ListOriginals(UUIDs []string) ([]datastruct.File, error)
+	CountOrphans() (int64, error)
+	AssignOrphans(userID uint) (int64, error)
 }
 
 type fileQuery struct {
@@ -22,15 +41,17 @@ func (d *dao) NewFileQuery() FileQuery {
 	return &fileQuery{d.db}
 }
 
-// Create a new file
-func (q *fileQuery) Create(UUID string, Name string, Size int64, Filename string) (datastruct.File, error) {
-	file := datastruct.File{
-		UUID:     UUID,
-		Name:     Name,
-		Size:     Size,
-		Filename: Filename,
-	}
-	err := q.db.Create(&file).Error
+// Create a new file, recorded in the change journal unless it is a private original
+func (q *fileQuery) Create(file datastruct.File) (datastruct.File, error) {
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&file).Error; err != nil {
+			return err
+		}
+		if file.OriginalOf != "" {
+			return nil
+		}
+		return recordChanges(tx, fileChange(file, datastruct.ChangeCreate))
+	})
 	return file, err
 }
 
@@ -50,11 +71,82 @@ func (q *fileQuery) Get(UUID string) (datastruct.File, error) {
 	return file, err
 }
 
-// Search all files by date range
-func (q *fileQuery) SearchByDateRange(from, to time.Time) ([]datastruct.File, error) {
+// Search the files of a user by date range
+func (q *fileQuery) SearchByDateRange(userID uint, from, to time.Time) ([]datastruct.File, error) {
+	var files []datastruct.File
+
+	err := q.db.Where("user_id = ? AND created_at BETWEEN ? AND ? AND original_of = ''", userID, from, to).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, err
+}
+
+// List the files expired at the given time, which are neither retained nor held
+func (q *fileQuery) ListExpired(now time.Time, limit int) ([]datastruct.File, error) {
+	var files []datastruct.File
+
+	heldUsers := q.db.Model(&datastruct.User{}).Select("id").Where("legal_hold = ?", true)
+	err := q.db.Where("expires_at <= ?", now).
+		Where("retain_until IS NULL OR retain_until <= ?", now).
+		Where("legal_hold = ?", false).
+		Where("user_id NOT IN (?)", heldUsers).
+		Order("expires_at").Limit(limit).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, err
+}
+
+// Place or release the legal hold of a file by UUID
+func (q *fileQuery) SetLegalHold(UUID string, hold bool) error {
+	return q.db.Model(&datastruct.File{}).Where("uuid = ?", UUID).Update("legal_hold", hold).Error
+}
+
+// Update all the fields of a file but its volume and last access, only changed by Relocate and Touch.
+// The update is recorded in the change journal as a move when the path of the file changes.
+func (q *fileQuery) Update(file datastruct.File) error {
+	return q.db.Transaction(func(tx *gorm.DB) error {
+		var current datastruct.File
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", file.UUID).First(&current).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Omit("volume", "last_accessed_at").Save(&file).Error; err != nil {
+			return err
+		}
+		if file.OriginalOf != "" {
+			return nil
+		}
+
+		change := fileChange(file, datastruct.ChangeUpdate)
+		if oldPath := path.Join(current.Folder, current.Name); oldPath != change.Path {
+			change.Op = datastruct.ChangeMove
+			change.OldPath = oldPath
+		}
+		return recordChanges(tx, change)
+	})
+}
+
+// List the files with the given scan status, oldest first
+func (q *fileQuery) ListByScanStatus(status datastruct.ScanStatus, limit int) ([]datastruct.File, error) {
+	var files []datastruct.File
+
+	err := q.db.Where("scan_status = ?", status).Order("created_at").Limit(limit).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, err
+}
+
+// List the files of a user directly in a folder
+func (q *fileQuery) ListByFolder(userID uint, folder string) ([]datastruct.File, error) {
 	var files []datastruct.File
 
-	err := q.db.Where("created_at BETWEEN ? AND ?", from, to).Find(&files).Error
+	err := q.db.Where("user_id = ? AND folder = ? AND original_of = ''", userID, folder).Order("name").Find(&files).Error
 	if err != nil {
 		return nil, err
 	}
@@ -62,8 +154,165 @@ func (q *fileQuery) SearchByDateRange(from, to time.Time) ([]datastruct.File, er
 	return files, err
 }
 
+// List the files of a user in a folder and all its subfolders
+func (q *fileQuery) ListInTree(userID uint, folder string) ([]datastruct.File, error) {
+	var files []datastruct.File
+
+	err := q.db.Where("user_id = ? AND (folder = ? OR folder LIKE ?) AND original_of = ''", userID, folder, likePrefix(folder)).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, err
+}
+
+// Get the latest file of a user with the given name in a folder
+func (q *fileQuery) GetByPath(userID uint, folder, name string) (datastruct.File, error) {
+	var file datastruct.File
+	err := q.db.Where("user_id = ? AND folder = ? AND name = ? AND original_of = ''", userID, folder, name).Order("id DESC").First(&file).Error
+	return file, err
+}
+
 // Delete a file by UUID
 func (q *fileQuery) Delete(UUID string) error {
 	err := q.db.Where("uuid = ?", UUID).Delete(&datastruct.File{}).Error
 	return err
 }
+
+// DeleteAndEnqueue deletes the given files and records their blobs in the
+// pending deletions outbox and the deletions in the change journal within a single transaction
+func (q *fileQuery) DeleteAndEnqueue(files []datastruct.File) error {
+	return q.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		var changes []datastruct.Change
+		for _, file := range files {
+			// The blob may have been relocated or quarantined since the file was read
+			var current datastruct.File
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", file.UUID).First(&current).Error
+			if err == gorm.ErrRecordNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Where("uuid = ?", file.UUID).Delete(&datastruct.File{}).Error; err != nil {
+				return err
+			}
+			pending := datastruct.PendingDeletion{
+				FileUUID:      file.UUID,
+				Volume:        current.Volume,
+				Filename:      current.Filename,
+				NextAttemptAt: now,
+			}
+			if err := tx.Create(&pending).Error; err != nil {
+				return err
+			}
+			if current.OriginalOf == "" {
+				changes = append(changes, fileChange(current, datastruct.ChangeDelete))
+			}
+		}
+		return recordChanges(tx, changes...)
+	})
+}
+
+// List the files whose blob is on the given volume, by ascending ID after the given one
+func (q *fileQuery) ListByVolume(volume string, afterID uint, limit int) ([]datastruct.File, error) {
+	var files []datastruct.File
+
+	err := q.db.Where("volume = ? AND id > ?", volume, afterID).Order("id").Limit(limit).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, err
+}
+
+// Count the files whose blob is on the given volume
+func (q *fileQuery) CountByVolume(volume string) (int64, error) {
+	var count int64
+	err := q.db.Model(&datastruct.File{}).Where("volume = ?", volume).Count(&count).Error
+	return count, err
+}
+
+// Relocate records that the blob of the file was copied to the given volume and
+// enqueues the removal of the previous copy, within a single transaction.
+// Nothing is updated if the file was deleted or its blob moved meanwhile,
+// the number of updated files is returned.
+func (q *fileQuery) Relocate(file datastruct.File, volume string) (int64, error) {
+	var updated int64
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&datastruct.File{}).
+			Where("uuid = ? AND volume = ? AND filename = ?", file.UUID, file.Volume, file.Filename).
+			Update("volume", volume)
+		if res.Error != nil {
+			return res.Error
+		}
+		updated = res.RowsAffected
+		if updated == 0 {
+			return nil
+		}
+
+		pending := datastruct.PendingDeletion{
+			FileUUID:      file.UUID,
+			Volume:        file.Volume,
+			Filename:      file.Filename,
+			KeepReplicas:  true,
+			NextAttemptAt: time.Now(),
+		}
+		return tx.Create(&pending).Error
+	})
+	return updated, err
+}
+
+// Touch records the last access of a file
+func (q *fileQuery) Touch(UUID string, at time.Time) error {
+	return q.db.Model(&datastruct.File{}).Where("uuid = ?", UUID).Update("last_accessed_at", at).Error
+}
+
+// List the files on the given volumes not accessed since the given time, or created
+// before it if never accessed, by ascending ID after the given one
+func (q *fileQuery) ListIdle(volumes []string, before time.Time, afterID uint, limit int) ([]datastruct.File, error) {
+	var files []datastruct.File
+
+	err := q.db.Where("volume IN ? AND id > ?", volumes, afterID).
+		Where("last_accessed_at < ? OR (last_accessed_at IS NULL AND created_at < ?)", before, before).
+		Order("id").Limit(limit).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, err
+}
+
+// Get the private original of a scrubbed file by UUID
+func (q *fileQuery) GetOriginal(UUID string) (datastruct.File, error) {
+	var file datastruct.File
+	err := q.db.Where("original_of = ?", UUID).First(&file).Error
+	return file, err
+}
+
+// List the private originals of the given scrubbed files
+func (q *fileQuery) ListOriginals(UUIDs []string) ([]datastruct.File, error) {
+	var files []datastruct.File
+
+	err := q.db.Where("original_of IN ?", UUIDs).Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return files, err
+}
+
+// Count the files without owner, uploaded before the files recorded their owner
+func (q *fileQuery) CountOrphans() (int64, error) {
+	var count int64
+	err := q.db.Model(&datastruct.File{}).Where("user_id = 0").Count(&count).Error
+	return count, err
+}
+
+// Assign the files without owner to the given user, returning the number of assigned files
+func (q *fileQuery) AssignOrphans(userID uint) (int64, error) {
+	res := q.db.Model(&datastruct.File{}).Where("user_id = 0").Update("user_id", userID)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type FolderQuery interface {
+	Create(folder datastruct.Folder) (datastruct.Folder, error)
+	Get(userID uint, path string) (datastruct.Folder, error)
+	ListChildren(userID uint, parent string) ([]datastruct.Folder, error)
+	Move(userID uint, oldPath, newPath string) error
+	DeleteTree(userID uint, path string) error
+}
+
+type folderQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewFolderQuery() FolderQuery {
+	return &folderQuery{d.db}
+}
+
+// Create a new folder, recorded in the change journal
+func (q *folderQuery) Create(folder datastruct.Folder) (datastruct.Folder, error) {
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&folder).Error; err != nil {
+			return err
+		}
+		return recordChanges(tx, folderChange(folder.UserID, folder.Path, datastruct.ChangeCreate))
+	})
+	return folder, err
+}
+
+// Get a folder of a user by path
+func (q *folderQuery) Get(userID uint, path string) (datastruct.Folder, error) {
+	var folder datastruct.Folder
+	err := q.db.Where("user_id = ? AND path = ?", userID, path).First(&folder).Error
+	return folder, err
+}
+
+// List the direct subfolders of a folder
+func (q *folderQuery) ListChildren(userID uint, parent string) ([]datastruct.Folder, error) {
+	var folders []datastruct.Folder
+	err := q.db.Where("user_id = ? AND parent = ?", userID, parent).Order("path").Find(&folders).Error
+	return folders, err
+}
+
+// Move a folder along with all its subfolders, and their files, to a new path.
+// Only the move of the folder itself is recorded in the change journal.
+func (q *folderQuery) Move(userID uint, oldPath, newPath string) error {
+	return q.db.Transaction(func(tx *gorm.DB) error {
+		var folders []datastruct.Folder
+		err := tx.Where("user_id = ? AND (path = ? OR path LIKE ?)", userID, oldPath, likePrefix(oldPath)).Find(&folders).Error
+		if err != nil {
+			return err
+		}
+		for _, folder := range folders {
+			folder.Path = rebase(folder.Path, oldPath, newPath)
+			folder.Parent = rebase(folder.Parent, oldPath, newPath)
+			if err := tx.Save(&folder).Error; err != nil {
+				return err
+			}
+		}
+
+		var files []datastruct.File
+		err = tx.Where("user_id = ? AND (folder = ? OR folder LIKE ?)", userID, oldPath, likePrefix(oldPath)).Find(&files).Error
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			err := tx.Model(&datastruct.File{}).Where("id = ?", file.ID).
+				Update("folder", rebase(file.Folder, oldPath, newPath)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		change := folderChange(userID, newPath, datastruct.ChangeMove)
+		change.OldPath = oldPath
+		return recordChanges(tx, change)
+	})
+}
+
+// Delete a folder along with all its subfolders, files must be deleted beforehand.
+// Only the deletion of the folder itself is recorded in the change journal.
+func (q *folderQuery) DeleteTree(userID uint, path string) error {
+	return q.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("user_id = ? AND (path = ? OR path LIKE ?)", userID, path, likePrefix(path)).
+			Delete(&datastruct.Folder{}).Error
+		if err != nil {
+			return err
+		}
+		return recordChanges(tx, folderChange(userID, path, datastruct.ChangeDelete))
+	})
+}
+
+// likePrefix returns the LIKE pattern matching all the paths below the given one.
+func likePrefix(path string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(path)
+	return strings.TrimSuffix(escaped, "/") + "/%"
+}
+
+// rebase replaces the oldPath prefix of path with newPath.
+func rebase(path, oldPath, newPath string) string {
+	if path == oldPath {
+		return newPath
+	}
+	return newPath + strings.TrimPrefix(path, oldPath)
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+
+	"gorm.io/gorm"
+)
+
+type ImportQuery interface {
+	Create(job datastruct.ImportJob) (datastruct.ImportJob, error)
+	Get(userID, id uint) (datastruct.ImportJob, error)
+	Update(job datastruct.ImportJob) error
+	FailUnfinished(reason string) (int64, error)
+}
+
+type importQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewImportQuery() ImportQuery {
+	return &importQuery{d.db}
+}
+
+func (q *importQuery) Create(job datastruct.ImportJob) (datastruct.ImportJob, error) {
+	err := q.db.Create(&job).Error
+	return job, err
+}
+
+// Get the import job with the given ID, if it belongs to the user
+func (q *importQuery) Get(userID, id uint) (datastruct.ImportJob, error) {
+	var job datastruct.ImportJob
+	err := q.db.Where("user_id = ? AND id = ?", userID, id).First(&job).Error
+	return job, err
+}
+
+func (q *importQuery) Update(job datastruct.ImportJob) error {
+	return q.db.Save(&job).Error
+}
+
+// FailUnfinished marks the pending and running import jobs as failed for the given reason
+func (q *importQuery) FailUnfinished(reason string) (int64, error) {
+	res := q.db.Model(&datastruct.ImportJob{}).
+		Where("status IN ?", []datastruct.ImportStatus{datastruct.ImportPending, datastruct.ImportRunning}).
+		Updates(map[string]any{"status": datastruct.ImportFailed, "error": reason})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReplicaQuery interface {
+	Create(replica datastruct.Replica) error
+	ListLagging(name string, afterID uint, limit int) ([]datastruct.File, error)
+	CountLagging(name string) (int64, error)
+	DeleteByFile(fileUUID string) error
+}
+
+type replicaQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewReplicaQuery() ReplicaQuery {
+	return &replicaQuery{d.db}
+}
+
+// Create records a copy of a blob on a replica, if not recorded yet
+func (q *replicaQuery) Create(replica datastruct.Replica) error {
+	return q.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&replica).Error
+}
+
+// lagging selects the clean files without a copy on the given replica
+func (q *replicaQuery) lagging(name string) *gorm.DB {
+	return q.db.Model(&datastruct.File{}).
+		Where("scan_status = ?", datastruct.ScanClean).
+		Where("NOT EXISTS (SELECT 1 FROM replicas WHERE replicas.file_uuid = files.uuid AND replicas.name = ?)", name)
+}
+
+// List the clean files without a copy on the given replica, by ascending ID after the given one
+func (q *replicaQuery) ListLagging(name string, afterID uint, limit int) ([]datastruct.File, error) {
+	var files []datastruct.File
+	err := q.lagging(name).Where("id > ?", afterID).Order("id").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+// Count the clean files without a copy on the given replica
+func (q *replicaQuery) CountLagging(name string) (int64, error) {
+	var count int64
+	err := q.lagging(name).Count(&count).Error
+	return count, err
+}
+
+// DeleteByFile permanently removes the records of the copies of a blob
+func (q *replicaQuery) DeleteByFile(fileUUID string) error {
+	return q.db.Unscoped().Where("file_uuid = ?", fileUUID).Delete(&datastruct.Replica{}).Error
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AccessKeyQuery interface {
+	Create(key datastruct.AccessKey) (datastruct.AccessKey, error)
+	GetByKeyID(keyID string) (datastruct.AccessKey, error)
+	ListByUser(userID uint) ([]datastruct.AccessKey, error)
+	Delete(userID, id uint) (int64, error)
+}
+
+type MultipartQuery interface {
+	Create(upload datastruct.MultipartUpload) (datastruct.MultipartUpload, error)
+	Get(uploadID string) (datastruct.MultipartUpload, error)
+	ListByUser(userID uint) ([]datastruct.MultipartUpload, error)
+	ListBefore(before time.Time, limit int) ([]datastruct.MultipartUpload, error)
+	Delete(uploadID string) error
+}
+
+type accessKeyQuery struct {
+	db *gorm.DB
+}
+
+type multipartQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewAccessKeyQuery() AccessKeyQuery {
+	return &accessKeyQuery{d.db}
+}
+
+func (d *dao) NewMultipartQuery() MultipartQuery {
+	return &multipartQuery{d.db}
+}
+
+// Create a new access key
+func (q *accessKeyQuery) Create(key datastruct.AccessKey) (datastruct.AccessKey, error) {
+	err := q.db.Create(&key).Error
+	return key, err
+}
+
+// Get an access key by its public key ID
+func (q *accessKeyQuery) GetByKeyID(keyID string) (datastruct.AccessKey, error) {
+	var key datastruct.AccessKey
+	err := q.db.Where("key_id = ?", keyID).First(&key).Error
+	return key, err
+}
+
+// List all the access keys of a user
+func (q *accessKeyQuery) ListByUser(userID uint) ([]datastruct.AccessKey, error) {
+	var keys []datastruct.AccessKey
+	err := q.db.Where("user_id = ?", userID).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// Delete an access key of a user, returning the number of deleted keys
+func (q *accessKeyQuery) Delete(userID, id uint) (int64, error) {
+	res := q.db.Unscoped().Where("user_id = ? AND id = ?", userID, id).Delete(&datastruct.AccessKey{})
+	return res.RowsAffected, res.Error
+}
+
+// Create a new multipart upload
+func (q *multipartQuery) Create(upload datastruct.MultipartUpload) (datastruct.MultipartUpload, error) {
+	err := q.db.Create(&upload).Error
+	return upload, err
+}
+
+// Get a multipart upload by its upload ID
+func (q *multipartQuery) Get(uploadID string) (datastruct.MultipartUpload, error) {
+	var upload datastruct.MultipartUpload
+	err := q.db.Where("upload_id = ?", uploadID).First(&upload).Error
+	return upload, err
+}
+
+// List the multipart uploads in progress of a user
+func (q *multipartQuery) ListByUser(userID uint) ([]datastruct.MultipartUpload, error) {
+	var uploads []datastruct.MultipartUpload
+	err := q.db.Where("user_id = ?", userID).Find(&uploads).Error
+	return uploads, err
+}
+
+// List the multipart uploads started before the given time
+func (q *multipartQuery) ListBefore(before time.Time, limit int) ([]datastruct.MultipartUpload, error) {
+	var uploads []datastruct.MultipartUpload
+	err := q.db.Where("created_at < ?", before).Order("created_at").Limit(limit).Find(&uploads).Error
+	return uploads, err
+}
+
+// Delete a completed or aborted multipart upload
+func (q *multipartQuery) Delete(uploadID string) error {
+	return q.db.Unscoped().Where("upload_id = ?", uploadID).Delete(&datastruct.MultipartUpload{}).Error
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionQuery interface {
+	CreateRefresh(token datastruct.RefreshToken) (datastruct.RefreshToken, error)
+	GetRefreshByHash(hash string) (datastruct.RefreshToken, error)
+	GetRefreshByAccessJTI(userID uint, jti string) (datastruct.RefreshToken, error)
+	MarkUsed(id uint, at time.Time) (int64, error)
+	RevokeFamily(familyID string, at time.Time) error
+	RevokeUser(userID uint, at time.Time) error
+	RevokeAccess(token datastruct.RevokedToken) error
+	IsRevoked(jti string) (bool, error)
+	TokensValidAfter(userID uint) (*time.Time, error)
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+type sessionQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewSessionQuery() SessionQuery {
+	return &sessionQuery{d.db}
+}
+
+func (q *sessionQuery) CreateRefresh(token datastruct.RefreshToken) (datastruct.RefreshToken, error) {
+	err := q.db.Create(&token).Error
+	return token, err
+}
+
+// Get a refresh token by hash
+func (q *sessionQuery) GetRefreshByHash(hash string) (datastruct.RefreshToken, error) {
+	var token datastruct.RefreshToken
+	err := q.db.Where("hash = ?", hash).First(&token).Error
+	return token, err
+}
+
+// Get the refresh token of a user issued along with the access token with the given jti
+func (q *sessionQuery) GetRefreshByAccessJTI(userID uint, jti string) (datastruct.RefreshToken, error) {
+	var token datastruct.RefreshToken
+	err := q.db.Where("user_id = ? AND access_jti = ?", userID, jti).First(&token).Error
+	return token, err
+}
+
+// MarkUsed records the exchange of a refresh token, unless it was already used or revoked,
+// returning the number of updated tokens so that concurrent exchanges cannot both succeed
+func (q *sessionQuery) MarkUsed(id uint, at time.Time) (int64, error) {
+	res := q.db.Model(&datastruct.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", at)
+	return res.RowsAffected, res.Error
+}
+
+// RevokeFamily revokes the refresh tokens rotated from the same login, along with their access tokens
+func (q *sessionQuery) RevokeFamily(familyID string, at time.Time) error {
+	return q.revoke(at, "family_id = ?", familyID)
+}
+
+// RevokeUser revokes all the refresh tokens of a user, along with their access tokens. The access
+// tokens issued before, without refresh token, are rejected by the time set as TokensValidAfter,
+// truncated to the second of their issued at claim so that the tokens issued next are still valid.
+func (q *sessionQuery) RevokeUser(userID uint, at time.Time) error {
+	return q.db.Transaction(func(tx *gorm.DB) error {
+		if err := revokeTokens(tx, at, "user_id = ?", userID); err != nil {
+			return err
+		}
+		return tx.Model(&datastruct.User{}).Where("id = ?", userID).
+			Update("tokens_valid_after", at.Truncate(time.Second)).Error
+	})
+}
+
+// revoke revokes the unrevoked refresh tokens matching the condition within a transaction
+func (q *sessionQuery) revoke(at time.Time, query string, args ...any) error {
+	return q.db.Transaction(func(tx *gorm.DB) error {
+		return revokeTokens(tx, at, query, args...)
+	})
+}
+
+// revokeTokens revokes the unrevoked refresh tokens matching the condition, adding the access
+// tokens issued along with them and not expired yet to the revocation list
+func revokeTokens(tx *gorm.DB, at time.Time, query string, args ...any) error {
+	var tokens []datastruct.RefreshToken
+	err := tx.Where(query, args...).Where("revoked_at IS NULL").Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+
+	var revoked []datastruct.RevokedToken
+	for _, t := range tokens {
+		if t.AccessJTI == "" || !t.AccessExpiresAt.After(at) {
+			continue
+		}
+		revoked = append(revoked, datastruct.RevokedToken{JTI: t.AccessJTI, UserID: t.UserID, ExpiresAt: t.AccessExpiresAt})
+	}
+	if len(revoked) > 0 {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&datastruct.RefreshToken{}).Where(query, args...).Where("revoked_at IS NULL").
+		Update("revoked_at", at).Error
+}
+
+// RevokeAccess adds an access token to the revocation list
+func (q *sessionQuery) RevokeAccess(token datastruct.RevokedToken) error {
+	return q.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&token).Error
+}
+
+// IsRevoked reports whether the access token with the given jti is in the revocation list
+func (q *sessionQuery) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := q.db.Model(&datastruct.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// TokensValidAfter returns the time before which the access tokens of a user are rejected, nil if none
+func (q *sessionQuery) TokensValidAfter(userID uint) (*time.Time, error) {
+	var user datastruct.User
+	err := q.db.Select("tokens_valid_after").Where("id = ?", userID).First(&user).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return user.TokensValidAfter, err
+}
+
+// DeleteExpired deletes the refresh tokens and revocations expired at the given time,
+// returning the number of deleted rows
+func (q *sessionQuery) DeleteExpired(now time.Time) (int64, error) {
+	res := q.db.Unscoped().Where("expires_at <= ?", now).Delete(&datastruct.RefreshToken{})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	deleted := res.RowsAffected
+
+	res = q.db.Where("expires_at <= ?", now).Delete(&datastruct.RevokedToken{})
+	return deleted + res.RowsAffected, res.Error
+}
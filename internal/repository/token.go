@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TokenQuery interface {
+	Create(token datastruct.AppToken) (datastruct.AppToken, error)
+	GetByHash(hash string) (datastruct.AppToken, error)
+	ListByUser(userID uint) ([]datastruct.AppToken, error)
+	Touch(id uint, at time.Time) error
+	Delete(userID, id uint) (int64, error)
+}
+
+type tokenQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewTokenQuery() TokenQuery {
+	return &tokenQuery{d.db}
+}
+
+// Create a new app token
+func (q *tokenQuery) Create(token datastruct.AppToken) (datastruct.AppToken, error) {
+	err := q.db.Create(&token).Error
+	return token, err
+}
+
+// Get an app token by hash
+func (q *tokenQuery) GetByHash(hash string) (datastruct.AppToken, error) {
+	var token datastruct.AppToken
+	err := q.db.Where("hash = ?", hash).First(&token).Error
+	return token, err
+}
+
+// List all the app tokens of a user
+func (q *tokenQuery) ListByUser(userID uint) ([]datastruct.AppToken, error) {
+	var tokens []datastruct.AppToken
+	err := q.db.Where("user_id = ?", userID).Order("id").Find(&tokens).Error
+	return tokens, err
+}
+
+// Touch records the last use of an app token
+func (q *tokenQuery) Touch(id uint, at time.Time) error {
+	return q.db.Model(&datastruct.AppToken{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+// Delete an app token of a user, returning the number of deleted tokens
+func (q *tokenQuery) Delete(userID, id uint) (int64, error) {
+	res := q.db.Unscoped().Where("user_id = ? AND id = ?", userID, id).Delete(&datastruct.AppToken{})
+	return res.RowsAffected, res.Error
+}
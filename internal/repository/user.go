@@ -2,7 +2,9 @@ package repository
 
 import (
 	"dryve/internal/datastruct"
-	"dryve/internal/dto"
+	"dryve/pkg/dto"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -12,6 +14,27 @@ type UserQuery interface {
 	GetUserByEmail(email string) (*datastruct.User, error)
 	CreateUser(user dto.RegisterRequest) (*datastruct.User, error)
 	UpdateUser(user *datastruct.User) error
+	ListDeletionDue(now time.Time, limit int) ([]datastruct.User, error)
+	Search(filter UserFilter, offset, limit int) ([]datastruct.User, int64, error)
+	Usage(userIDs []uint) (map[uint]UserUsage, error)
+	Purge(userID uint) error
+}
+
+// UserFilter restricts the users to query, zero values match everything.
+type UserFilter struct {
+	// Matched against the email and the names, case-insensitively
+	Query    string
+	Role     datastruct.Role
+	Verified *bool
+	Disabled *bool
+}
+
+// UserUsage is the storage used by a user.
+type UserUsage struct {
+	// Number of files, without the originals of the scrubbed images
+	Files int64
+	// Total size of the files, with the originals
+	Size int64
 }
 
 type userQuery struct {
@@ -48,3 +71,105 @@ func (u *userQuery) UpdateUser(user *datastruct.User) error {
 	err := u.db.Save(user).Error
 	return err
 }
+
+// List the users whose account deletion is due at the given time
+func (u *userQuery) ListDeletionDue(now time.Time, limit int) ([]datastruct.User, error) {
+	var users []datastruct.User
+
+	err := u.db.Where("delete_at <= ?", now).Order("delete_at").Limit(limit).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return users, err
+}
+
+// Search returns a page of the users matching the filter, by ID, along with the total number of matches
+func (u *userQuery) Search(filter UserFilter, offset, limit int) ([]datastruct.User, int64, error) {
+	var users []datastruct.User
+	var total int64
+
+	err := u.filter(filter).Model(&datastruct.User{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = u.filter(filter).Order("id").Offset(offset).Limit(limit).Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (u *userQuery) filter(filter UserFilter) *gorm.DB {
+	tx := u.db
+	if filter.Query != "" {
+		like := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(filter.Query)) + "%"
+		tx = tx.Where("LOWER(email) LIKE ? OR LOWER(first_name) LIKE ? OR LOWER(last_name) LIKE ?", like, like, like)
+	}
+	if filter.Role != "" {
+		tx = tx.Where("role = ?", filter.Role)
+	}
+	if filter.Verified != nil {
+		tx = tx.Where("verified = ?", *filter.Verified)
+	}
+	if filter.Disabled != nil {
+		tx = tx.Where("disabled = ?", *filter.Disabled)
+	}
+	return tx
+}
+
+// Usage returns the storage used by each of the given users, missing for those without files
+func (u *userQuery) Usage(userIDs []uint) (map[uint]UserUsage, error) {
+	var rows []struct {
+		UserID uint
+		Files  int64
+		Size   int64
+	}
+
+	err := u.db.Model(&datastruct.File{}).
+		Select("user_id, SUM(CASE WHEN original_of = '' THEN 1 ELSE 0 END) AS files, COALESCE(SUM(size), 0) AS size").
+		Where("user_id IN ?", userIDs).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[uint]UserUsage, len(rows))
+	for _, row := range rows {
+		usage[row.UserID] = UserUsage{Files: row.Files, Size: row.Size}
+	}
+	return usage, nil
+}
+
+// Purge permanently removes a user along with their credentials, sessions, webhooks, folders, jobs and change journal,
+// all at once. Files, blobs and multipart parts must be deleted beforehand, the audit log is kept.
+func (u *userQuery) Purge(userID uint) error {
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		webhooks := tx.Unscoped().Model(&datastruct.Webhook{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Unscoped().Where("webhook_id IN (?)", webhooks).Delete(&datastruct.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []any{
+			&datastruct.Webhook{},
+			&datastruct.AppToken{},
+			&datastruct.AccessKey{},
+			&datastruct.MultipartUpload{},
+			&datastruct.Folder{},
+			&datastruct.ImportJob{},
+			&datastruct.ExportJob{},
+			&datastruct.Change{},
+			&datastruct.RefreshToken{},
+			&datastruct.RevokedToken{},
+		} {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Delete(&datastruct.User{}, userID).Error
+	})
+}
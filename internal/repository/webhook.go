@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"dryve/internal/datastruct"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WebhookQuery interface {
+	Create(webhook datastruct.Webhook) (datastruct.Webhook, error)
+	Get(id uint) (datastruct.Webhook, error)
+	ListByUser(userID uint) ([]datastruct.Webhook, error)
+	Delete(id uint) error
+	CreateDelivery(delivery datastruct.WebhookDelivery) (datastruct.WebhookDelivery, error)
+	GetDelivery(id uint) (datastruct.WebhookDelivery, error)
+	ListDeliveries(webhookID uint, limit int) ([]datastruct.WebhookDelivery, error)
+	ListDueDeliveries(now time.Time, limit int) ([]datastruct.WebhookDelivery, error)
+	UpdateDelivery(delivery datastruct.WebhookDelivery) error
+}
+
+type webhookQuery struct {
+	db *gorm.DB
+}
+
+func (d *dao) NewWebhookQuery() WebhookQuery {
+	return &webhookQuery{d.db}
+}
+
+// Create a new webhook
+func (q *webhookQuery) Create(webhook datastruct.Webhook) (datastruct.Webhook, error) {
+	err := q.db.Create(&webhook).Error
+	return webhook, err
+}
+
+// Get a webhook by ID
+func (q *webhookQuery) Get(id uint) (datastruct.Webhook, error) {
+	var webhook datastruct.Webhook
+	err := q.db.First(&webhook, id).Error
+	return webhook, err
+}
+
+// List all the webhooks of a user
+func (q *webhookQuery) ListByUser(userID uint) ([]datastruct.Webhook, error) {
+	var webhooks []datastruct.Webhook
+	err := q.db.Where("user_id = ?", userID).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// Delete a webhook by ID
+func (q *webhookQuery) Delete(id uint) error {
+	return q.db.Delete(&datastruct.Webhook{}, id).Error
+}
+
+// Create a new delivery
+func (q *webhookQuery) CreateDelivery(delivery datastruct.WebhookDelivery) (datastruct.WebhookDelivery, error) {
+	err := q.db.Create(&delivery).Error
+	return delivery, err
+}
+
+// Get a delivery by ID
+func (q *webhookQuery) GetDelivery(id uint) (datastruct.WebhookDelivery, error) {
+	var delivery datastruct.WebhookDelivery
+	err := q.db.First(&delivery, id).Error
+	return delivery, err
+}
+
+// List the latest deliveries of a webhook
+func (q *webhookQuery) ListDeliveries(webhookID uint, limit int) ([]datastruct.WebhookDelivery, error) {
+	var deliveries []datastruct.WebhookDelivery
+	err := q.db.Where("webhook_id = ?", webhookID).Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// List the pending deliveries whose next attempt is due
+func (q *webhookQuery) ListDueDeliveries(now time.Time, limit int) ([]datastruct.WebhookDelivery, error) {
+	var deliveries []datastruct.WebhookDelivery
+	err := q.db.Where("status = ? AND next_attempt_at <= ?", datastruct.DeliveryPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Update all the fields of a delivery
+func (q *webhookQuery) UpdateDelivery(delivery datastruct.WebhookDelivery) error {
+	return q.db.Save(&delivery).Error
+}
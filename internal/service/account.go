@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrAccountImmutable = fmt.Errorf("account under legal hold or holding retained files")
+var ErrAccountInternal = fmt.Errorf("account deletion error")
+
+const (
+	// Max number of accounts deleted per run
+	accountDeletionBatchSize = 10
+	// Number of files deleted at once
+	accountFileBatchSize = 100
+)
+
+type AccountDeletionWorker interface {
+	Run(ctx context.Context)
+	Delete(user datastruct.User) error
+}
+
+// Default accountDeletionWorker implementing AccountDeletionWorker
+type accountDeletionWorker struct {
+	dao       repository.DAO
+	files     FileService
+	multipart MultipartService
+	exports   ExportService
+	interval  time.Duration
+	// Serializes the deletions of the worker and of the admins
+	mu sync.Mutex
+}
+
+// NewAccountDeletionWorker creates a worker deleting the accounts whose grace period is over,
+// along with all their files and data.
+func NewAccountDeletionWorker(dao repository.DAO, files FileService, multipart MultipartService, exports ExportService,
+	interval time.Duration) AccountDeletionWorker {
+	return &accountDeletionWorker{
+		dao:       dao,
+		files:     files,
+		multipart: multipart,
+		exports:   exports,
+		interval:  interval,
+	}
+}
+
+// Run deletes the accounts past their grace period every interval until the context is done.
+func (w *accountDeletionWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.deleteDue()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deleteDue deletes a batch of accounts past their grace period. Those holding
+// immutable files are tried again on the next runs, until their retention ends.
+func (w *accountDeletionWorker) deleteDue() {
+	users, err := w.dao.NewUserQuery().ListDeletionDue(time.Now(), accountDeletionBatchSize)
+	if err != nil {
+		logrus.Errorf("cannot list the accounts to delete: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		if err := w.Delete(user); err != nil {
+			logrus.Errorf("cannot delete account %d: %v", user.ID, err)
+		}
+	}
+}
+
+// Delete permanently deletes the account of the user: their files and their blobs through the file service,
+// their multipart uploads and export archives, then their credentials, webhooks, folders and personal data.
+// Accounts under legal hold, or holding files which cannot be deleted yet, are kept along with those files.
+func (w *accountDeletionWorker) Delete(user datastruct.User) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if user.LegalHold {
+		return ErrAccountImmutable
+	}
+
+	files, err := w.dao.NewFileQuery().ListInTree(user.ID, datastruct.RootFolder)
+	if err != nil {
+		return ErrAccountInternal
+	}
+	var mutable []datastruct.File
+	immutable := 0
+	for _, f := range files {
+		if err := w.files.CheckMutable(f); err != nil {
+			immutable++
+			continue
+		}
+		mutable = append(mutable, f)
+	}
+	for start := 0; start < len(mutable); start += accountFileBatchSize {
+		end := start + accountFileBatchSize
+		if end > len(mutable) {
+			end = len(mutable)
+		}
+		if err := w.files.DeleteMany(mutable[start:end]); err != nil {
+			return err
+		}
+	}
+	if immutable > 0 {
+		logrus.Warnf("account %d holds %d retained files, its deletion is postponed", user.ID, immutable)
+		return ErrAccountImmutable
+	}
+
+	uploads, err := w.dao.NewMultipartQuery().ListByUser(user.ID)
+	if err != nil {
+		return ErrAccountInternal
+	}
+	for _, upload := range uploads {
+		if err := w.multipart.Abort(upload); err != nil {
+			return err
+		}
+	}
+
+	if err := w.exports.RemoveArchives(user.ID); err != nil {
+		return err
+	}
+
+	if err := w.dao.NewUserQuery().Purge(user.ID); err != nil {
+		logrus.Errorf("cannot purge account %d: %v", user.ID, err)
+		return ErrAccountInternal
+	}
+
+	logrus.Infof("account %d deleted along with %d files", user.ID, len(mutable))
+	return nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"fmt"
+)
+
+var ErrAuditInternal = fmt.Errorf("audit processing error")
+
+type AuditService interface {
+	Record(entry datastruct.AuditEntry) error
+	Search(filter repository.AuditFilter, offset, limit int) ([]datastruct.AuditEntry, int64, error)
+	Export(filter repository.AuditFilter, fn func(datastruct.AuditEntry) error) error
+}
+
+type auditService struct {
+	dao repository.DAO
+}
+
+func NewAuditService(dao repository.DAO) AuditService {
+	return &auditService{dao: dao}
+}
+
+// Record appends the entry to the audit log.
+func (s *auditService) Record(entry datastruct.AuditEntry) error {
+	return s.dao.NewAuditQuery().Create(entry)
+}
+
+// Search returns a page of the entries matching the filter, newest first, and their total count.
+func (s *auditService) Search(filter repository.AuditFilter, offset, limit int) ([]datastruct.AuditEntry, int64, error) {
+	entries, total, err := s.dao.NewAuditQuery().Search(filter, offset, limit)
+	if err != nil {
+		return nil, 0, ErrAuditInternal
+	}
+
+	return entries, total, nil
+}
+
+// Export calls fn on all the entries matching the filter, oldest first.
+func (s *auditService) Export(filter repository.AuditFilter, fn func(datastruct.AuditEntry) error) error {
+	return s.dao.NewAuditQuery().Export(filter, fn)
+}
@@ -0,0 +1,15 @@
+package service
+
+import "time"
+
+// backoff returns the exponential delay before the given retry attempt, capped to max.
+func backoff(attempts int, max time.Duration) time.Duration {
+	if attempts > 30 {
+		return max
+	}
+	d := time.Duration(1<<attempts) * time.Second
+	if d > max {
+		return max
+	}
+	return d
+}
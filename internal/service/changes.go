@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrCursorExpired = fmt.Errorf("cursor expired, do a full resync")
+var ErrChangesBadRequest = fmt.Errorf("bad changes request")
+var ErrChangesInternal = fmt.Errorf("changes processing error")
+
+const (
+	// Number of changes removed per batch by the pruner.
+	changePruneBatchSize = 1000
+	// Time the changes are kept past the retention, so those committed while a cursor was
+	// issued are never removed before the cursor expires.
+	changePruneMargin = 24 * time.Hour
+)
+
+// ChangePage is a batch of changes of the change journal.
+type ChangePage struct {
+	Changes []datastruct.Change
+	// Cursor to list the following changes from
+	Cursor string
+	// Whether more changes follow, to list right away
+	HasMore bool
+}
+
+// ChangeJournal lists the changes of the user spaces, recorded along with them by the repository.
+type ChangeJournal interface {
+	List(userID uint, cursor string, limit int) (ChangePage, error)
+	Run(ctx context.Context)
+}
+
+type changeJournal struct {
+	dao       repository.DAO
+	retention time.Duration
+	interval  time.Duration
+}
+
+// NewChangeJournal creates a change journal keeping the changes for the retention,
+// older ones being pruned every interval.
+func NewChangeJournal(dao repository.DAO, retention, interval time.Duration) ChangeJournal {
+	return &changeJournal{
+		dao:       dao,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// List returns up to limit changes of the user following the cursor. Without cursor,
+// no changes are returned but the cursor of the current position, to use once the files
+// are listed. Cursors older than the retention return ErrCursorExpired, as the changes
+// following them may have been pruned.
+func (j *changeJournal) List(userID uint, cursor string, limit int) (ChangePage, error) {
+	now := time.Now()
+	if cursor == "" {
+		last, err := j.dao.NewChangeQuery().Last(userID)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return ChangePage{}, ErrChangesInternal
+		}
+		return ChangePage{Cursor: formatCursor(last.ID, now)}, nil
+	}
+
+	afterID, at, err := parseCursor(cursor)
+	if err != nil {
+		return ChangePage{}, ErrChangesBadRequest
+	}
+	if at.Before(now.Add(-j.retention)) {
+		return ChangePage{}, ErrCursorExpired
+	}
+
+	changes, err := j.dao.NewChangeQuery().List(userID, afterID, limit+1)
+	if err != nil {
+		return ChangePage{}, ErrChangesInternal
+	}
+
+	page := ChangePage{
+		Changes: changes,
+		HasMore: len(changes) > limit,
+	}
+	switch {
+	case page.HasMore:
+		page.Changes = changes[:limit]
+		last := page.Changes[limit-1]
+		page.Cursor = formatCursor(last.ID, last.CreatedAt)
+	case len(changes) > 0:
+		// Caught up, the next changes are recorded from now on
+		page.Cursor = formatCursor(changes[len(changes)-1].ID, now)
+	default:
+		page.Cursor = formatCursor(afterID, now)
+	}
+
+	return page, nil
+}
+
+// Run prunes the changes past the retention every interval until the context is done.
+func (j *changeJournal) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.prune()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *changeJournal) prune() {
+	before := time.Now().Add(-j.retention - changePruneMargin)
+	var pruned int64
+	for {
+		n, err := j.dao.NewChangeQuery().DeleteBefore(before, changePruneBatchSize)
+		if err != nil {
+			logrus.Errorf("cannot prune the change journal: %v", err)
+			break
+		}
+		pruned += n
+		if n < changePruneBatchSize {
+			break
+		}
+	}
+
+	if pruned > 0 {
+		logrus.Infof("pruned %d changes from the change journal", pruned)
+	}
+}
+
+// formatCursor returns the cursor following the change with the given ID, as of the given time.
+// The time tells whether the changes following it may have been pruned.
+func formatCursor(id uint, at time.Time) string {
+	return fmt.Sprintf("%d.%d", id, at.Unix())
+}
+
+func parseCursor(cursor string) (uint, time.Time, error) {
+	rawID, rawTime, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("malformed cursor")
+	}
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	sec, err := strconv.ParseInt(rawTime, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return uint(id), time.Unix(sec, 0), nil
+}
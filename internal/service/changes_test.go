@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCursor(t *testing.T) {
+	at := time.Unix(1697712345, 0)
+	tests := []struct {
+		cursor  string
+		wantID  uint
+		wantErr bool
+	}{
+		{formatCursor(42, at), 42, false},
+		{formatCursor(0, at), 0, false},
+		{"42", 0, true},
+		{"abc.1697712345", 0, true},
+		{"42.abc", 0, true},
+		{"-1.1697712345", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cursor, func(t *testing.T) {
+			id, gotAt, err := parseCursor(tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCursor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (id != tt.wantID || !gotAt.Equal(at)) {
+				t.Errorf("parseCursor() = %d, %v, want %d, %v", id, gotAt, tt.wantID, at)
+			}
+		})
+	}
+}
+
+func TestChangeJournalListRejectedCursors(t *testing.T) {
+	j := NewChangeJournal(nil, 24*time.Hour, time.Hour)
+	tests := []struct {
+		name   string
+		cursor string
+		want   error
+	}{
+		{"expired", formatCursor(42, time.Now().Add(-25*time.Hour)), ErrCursorExpired},
+		{"malformed", "garbage", ErrChangesBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := j.List(1, tt.cursor, 10); err != tt.want {
+				t.Errorf("List() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
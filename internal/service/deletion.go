@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"dryve/internal/repository"
+	"dryve/pkg/dto"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Upper bound for the backoff between two removal attempts of the same blob.
+const maxDeletionBackoff = 1 * time.Hour
+
+type DeletionWorker interface {
+	Run(ctx context.Context)
+	Status() (dto.DeletionStatusResponse, error)
+}
+
+// Default deletionWorker implementing DeletionWorker
+type deletionWorker struct {
+	dao        repository.DAO
+	storage    StoragePool
+	replicator Replicator
+	interval   time.Duration
+	batchSize  int
+
+	mu        sync.Mutex
+	lastRunAt time.Time
+	lastError string
+	removed   int64
+}
+
+// NewDeletionWorker creates a worker removing the blobs from the storage pool,
+// along with their copies on the replicas of the replicator, if any.
+func NewDeletionWorker(dao repository.DAO, storage StoragePool, replicator Replicator,
+	interval time.Duration, batchSize int) DeletionWorker {
+	return &deletionWorker{
+		dao:        dao,
+		storage:    storage,
+		replicator: replicator,
+		interval:   interval,
+		batchSize:  batchSize,
+	}
+}
+
+// Run processes the pending deletions outbox every interval until the context is done.
+func (w *deletionWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.process()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process removes the blobs of a batch of due pending deletions.
+func (w *deletionWorker) process() {
+	now := time.Now()
+	pending, err := w.dao.NewDeletionQuery().ListDue(now, w.batchSize)
+	if err != nil {
+		logrus.Errorf("cannot list pending deletions: %v", err)
+		w.record(now, 0, err.Error())
+		return
+	}
+
+	var removed int64
+	var lastError string
+	for _, p := range pending {
+		// A relocated blob may have moved back to the volume of its removed copy
+		referenced, err := w.dao.NewDeletionQuery().IsReferenced(p.Volume, p.Filename)
+		if err == nil && referenced {
+			if err = w.dao.NewDeletionQuery().Complete(p.ID); err != nil {
+				logrus.Errorf("cannot complete pending deletion %d: %v", p.ID, err)
+			}
+			continue
+		}
+
+		var path string
+		if err == nil {
+			path, err = w.storage.Path(p.Volume, p.Filename)
+		}
+		if err == nil {
+			err = removeBlob(path)
+		}
+		if err == nil && !p.KeepReplicas && w.replicator != nil {
+			err = w.replicator.Remove(p.FileUUID, p.Filename)
+		}
+		if err != nil {
+			lastError = err.Error()
+			logrus.Errorf("cannot remove blob %s (attempt %d): %v", p.Filename, p.Attempts+1, err)
+			err = w.dao.NewDeletionQuery().Fail(p.ID, lastError, now.Add(backoff(p.Attempts+1, maxDeletionBackoff)))
+			if err != nil {
+				logrus.Errorf("cannot reschedule pending deletion %d: %v", p.ID, err)
+			}
+			continue
+		}
+
+		if err = w.dao.NewDeletionQuery().Complete(p.ID); err != nil {
+			// The blob is gone, the next attempt will find nothing to remove.
+			logrus.Errorf("cannot complete pending deletion %d: %v", p.ID, err)
+			continue
+		}
+		removed++
+	}
+
+	w.record(now, removed, lastError)
+}
+
+func (w *deletionWorker) record(at time.Time, removed int64, lastError string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastRunAt = at
+	w.removed += removed
+	if lastError != "" {
+		w.lastError = lastError
+	}
+}
+
+// Status returns the current state of the outbox and of the worker.
+func (w *deletionWorker) Status() (dto.DeletionStatusResponse, error) {
+	var res dto.DeletionStatusResponse
+
+	pending, err := w.dao.NewDeletionQuery().CountPending()
+	if err != nil {
+		return res, ErrFileInternal
+	}
+	failing, err := w.dao.NewDeletionQuery().CountFailing()
+	if err != nil {
+		return res, ErrFileInternal
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res.Pending = pending
+	res.Failing = failing
+	res.Removed = w.removed
+	res.LastError = w.lastError
+	if !w.lastRunAt.IsZero() {
+		res.LastRunAt = w.lastRunAt.Format(time.RFC3339)
+	}
+
+	return res, nil
+}
+
+// removeBlob removes the blob at the given path.
+// A missing blob counts as removed, so removals can be safely retried.
+func removeBlob(path string) error {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
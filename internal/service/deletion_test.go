@@ -0,0 +1,189 @@
+package service
+
+import (
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// deletionDAO only serves the deletion queries.
+type deletionDAO struct {
+	repository.DAO
+	q *fakeDeletionQuery
+}
+
+func (d deletionDAO) NewDeletionQuery() repository.DeletionQuery {
+	return d.q
+}
+
+// fakeDeletionQuery keeps the pending deletions in memory.
+type fakeDeletionQuery struct {
+	repository.DeletionQuery
+	pending    []datastruct.PendingDeletion
+	referenced map[string]bool
+	completed  []uint
+	failed     map[uint]time.Time
+}
+
+func (q *fakeDeletionQuery) ListDue(now time.Time, limit int) ([]datastruct.PendingDeletion, error) {
+	return q.pending, nil
+}
+
+func (q *fakeDeletionQuery) IsReferenced(volume, filename string) (bool, error) {
+	return q.referenced[volume+"/"+filename], nil
+}
+
+func (q *fakeDeletionQuery) Complete(id uint) error {
+	q.completed = append(q.completed, id)
+	return nil
+}
+
+func (q *fakeDeletionQuery) Fail(id uint, reason string, next time.Time) error {
+	q.failed[id] = next
+	return nil
+}
+
+// dirStorage stores the blobs of every volume in a subdirectory.
+type dirStorage struct {
+	StoragePool
+	dir string
+}
+
+func (s dirStorage) Path(volume, filename string) (string, error) {
+	return filepath.Join(s.dir, volume, filename), nil
+}
+
+// removalRecorder records the blobs removed from the replicas.
+type removalRecorder struct {
+	Replicator
+	removed []string
+}
+
+func (r *removalRecorder) Remove(fileUUID, filename string) error {
+	r.removed = append(r.removed, filename)
+	return nil
+}
+
+func TestDeletionWorkerProcess(t *testing.T) {
+	dir := t.TempDir()
+	blobs := map[string]bool{
+		"hot/deleted.bin":   false,
+		"hot/relocated.bin": false,
+		"hot/returned.bin":  false,
+		"hot/busy.bin":      true,
+	}
+	for blob, isDir := range blobs {
+		path := filepath.Join(dir, blob)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if isDir {
+			// A non-empty directory cannot be removed, failing the removal
+			if err := os.MkdirAll(filepath.Join(path, "child"), 0o700); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.WriteFile(path, []byte("blob"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending := func(id uint, filename string, keepReplicas bool, attempts int) datastruct.PendingDeletion {
+		return datastruct.PendingDeletion{
+			Model:        gorm.Model{ID: id},
+			FileUUID:     filename,
+			Volume:       "hot",
+			Filename:     filename,
+			KeepReplicas: keepReplicas,
+			Attempts:     attempts,
+		}
+	}
+	q := &fakeDeletionQuery{
+		pending: []datastruct.PendingDeletion{
+			pending(1, "deleted.bin", false, 0),
+			pending(2, "relocated.bin", true, 0),
+			pending(3, "returned.bin", true, 0),
+			pending(4, "busy.bin", false, 2),
+		},
+		referenced: map[string]bool{"hot/returned.bin": true},
+		failed:     map[uint]time.Time{},
+	}
+	replicas := &removalRecorder{}
+	w := NewDeletionWorker(deletionDAO{q: q}, dirStorage{dir: dir}, replicas, time.Hour, 10).(*deletionWorker)
+
+	before := time.Now()
+	w.process()
+	after := time.Now()
+
+	t.Run("removed blobs", func(t *testing.T) {
+		for _, blob := range []string{"hot/deleted.bin", "hot/relocated.bin"} {
+			if _, err := os.Stat(filepath.Join(dir, blob)); !os.IsNotExist(err) {
+				t.Errorf("blob %s not removed, stat error = %v", blob, err)
+			}
+		}
+	})
+
+	t.Run("referenced blob kept", func(t *testing.T) {
+		if _, err := os.Stat(filepath.Join(dir, "hot/returned.bin")); err != nil {
+			t.Errorf("referenced blob removed, stat error = %v", err)
+		}
+	})
+
+	t.Run("completed deletions", func(t *testing.T) {
+		want := []uint{1, 2, 3}
+		if len(q.completed) != len(want) {
+			t.Fatalf("completed = %v, want %v", q.completed, want)
+		}
+		for i := range want {
+			if q.completed[i] != want[i] {
+				t.Fatalf("completed = %v, want %v", q.completed, want)
+			}
+		}
+	})
+
+	t.Run("replicas only removed for deleted files", func(t *testing.T) {
+		if len(replicas.removed) != 1 || replicas.removed[0] != "deleted.bin" {
+			t.Errorf("removed from replicas = %v, want [deleted.bin]", replicas.removed)
+		}
+	})
+
+	t.Run("failed removal backed off", func(t *testing.T) {
+		next, ok := q.failed[4]
+		if !ok || len(q.failed) != 1 {
+			t.Fatalf("failed = %v, want only deletion 4", q.failed)
+		}
+		// Third attempt failed, the next one waits 2^3 seconds
+		if wait := 8 * time.Second; next.Before(before.Add(wait)) || next.After(after.Add(wait)) {
+			t.Errorf("next attempt at %v, want %v after the run", next, wait)
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		if w.removed != 2 || w.lastError == "" {
+			t.Errorf("removed = %d, last error = %q, want 2 and an error", w.removed, w.lastError)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{12, time.Hour},
+		{64, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts, time.Hour); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
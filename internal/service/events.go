@@ -0,0 +1,82 @@
+package service
+
+import (
+	"dryve/internal/datastruct"
+	"dryve/pkg/dto"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of the published events.
+const (
+	EventFileUploaded   = "file.uploaded"
+	EventFileUpdated    = "file.updated"
+	EventFileDeleted    = "file.deleted"
+	EventFileDownloaded = "file.downloaded"
+	EventUserVerified   = "user.verified"
+)
+
+// EventTypes lists all the types of the published events.
+var EventTypes = []string{
+	EventFileUploaded,
+	EventFileUpdated,
+	EventFileDeleted,
+	EventFileDownloaded,
+	EventUserVerified,
+}
+
+type EventBus interface {
+	Publish(event dto.Event)
+	Subscribe(handler func(dto.Event))
+}
+
+// Default eventBus implementing EventBus in process
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers []func(dto.Event)
+}
+
+func NewEventBus() EventBus {
+	return &eventBus{}
+}
+
+// Publish hands the event to all the subscribers, which must not block.
+func (b *eventBus) Publish(event dto.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+}
+
+// Subscribe registers a handler receiving all the published events.
+func (b *eventBus) Subscribe(handler func(dto.Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+// newEvent creates an event of the given type for the user.
+func newEvent(eventType string, userID uint, data any) dto.Event {
+	return dto.Event{
+		ID:     uuid.New().String(),
+		Type:   eventType,
+		Time:   time.Now().UTC(),
+		UserID: userID,
+		Data:   data,
+	}
+}
+
+// newFileEvent creates an event of the given type about the file.
+func newFileEvent(eventType string, metaFile datastruct.File) dto.Event {
+	return newEvent(eventType, metaFile.UserID, dto.FileEventData{
+		ID:     metaFile.UUID,
+		Name:   metaFile.Name,
+		Folder: metaFile.Folder,
+		Size:   metaFile.Size,
+	})
+}
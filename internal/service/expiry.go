@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"dryve/internal/repository"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Max number of expired files purged by the reaper per run.
+const expiryBatchSize = 100
+
+type ExpiryReaper interface {
+	Run(ctx context.Context)
+}
+
+// Default expiryReaper implementing ExpiryReaper
+type expiryReaper struct {
+	dao         repository.DAO
+	fileService FileService
+	interval    time.Duration
+}
+
+func NewExpiryReaper(dao repository.DAO, fileService FileService, interval time.Duration) ExpiryReaper {
+	return &expiryReaper{
+		dao:         dao,
+		fileService: fileService,
+		interval:    interval,
+	}
+}
+
+// Run purges the expired files every interval until the context is done.
+func (r *expiryReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.purge()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge deletes a batch of expired files through the FileService.
+func (r *expiryReaper) purge() {
+	files, err := r.dao.NewFileQuery().ListExpired(time.Now(), expiryBatchSize)
+	if err != nil {
+		logrus.Errorf("cannot list expired files: %v", err)
+		return
+	}
+
+	for _, file := range files {
+		if err := r.fileService.Delete(file); err != nil {
+			logrus.Errorf("cannot purge expired file %s: %v", file.UUID, err)
+		}
+	}
+}
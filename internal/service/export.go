@@ -0,0 +1,509 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"dryve/internal/config"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"dryve/internal/utils"
+	"dryve/pkg/dto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrExportNotFound = fmt.Errorf("export not found")
+var ErrExportInProgress = fmt.Errorf("export already in progress")
+var ErrExportNotReady = fmt.Errorf("export not ready")
+var ErrExportExpired = fmt.Errorf("export expired")
+var ErrExportInternal = fmt.Errorf("export processing error")
+
+// Reasons of the failed exports.
+var errExportInterrupted = fmt.Errorf("interrupted by a server restart")
+
+// ExportDownloadPath is the path of the presigned download of an export archive, sent by email.
+const ExportDownloadPath = "/presigned/exports/%d/download"
+
+// Audited action of the issue of a presigned URL, listed as a share link of the user.
+const auditPresign = "file.presign"
+
+const (
+	exportManifestName   = "manifest.json"
+	exportFilesDir       = "files"
+	exportOriginalsDir   = "originals"
+	exportPruneBatchSize = 100
+)
+
+type ExportService interface {
+	Request(user datastruct.User) (datastruct.ExportJob, error)
+	Get(userID, id uint) (datastruct.ExportJob, error)
+	Open(job datastruct.ExportJob) (*os.File, error)
+	FailInterrupted() error
+	RemoveArchives(userID uint) error
+	Run(ctx context.Context)
+}
+
+type exportService struct {
+	dao    repository.DAO
+	files  FileService
+	email  EmailService
+	config config.ExportConfig
+	// Sender of the emails
+	from string
+	// Public URL of the server and key signing the download links
+	baseURL    string
+	presignKey []byte
+	// Semaphore bounding the number of archives built at once
+	slots chan struct{}
+}
+
+// NewExportService creates a service building archives of all the data of the users in background,
+// whose time-limited download link is sent by email from the given address once done.
+func NewExportService(dao repository.DAO, files FileService, email EmailService, c config.ExportConfig,
+	from, baseURL string, presignKey []byte) ExportService {
+	return &exportService{
+		dao:        dao,
+		files:      files,
+		email:      email,
+		config:     c,
+		from:       from,
+		baseURL:    baseURL,
+		presignKey: presignKey,
+		slots:      make(chan struct{}, c.MaxConcurrent),
+	}
+}
+
+// Request records an export job of the data of the user and builds its archive in background.
+// A user can only have one export in progress at once.
+func (s *exportService) Request(user datastruct.User) (datastruct.ExportJob, error) {
+	n, err := s.dao.NewExportQuery().CountUnfinished(user.ID)
+	if err != nil {
+		return datastruct.ExportJob{}, ErrExportInternal
+	}
+	if n > 0 {
+		return datastruct.ExportJob{}, ErrExportInProgress
+	}
+
+	job, err := s.dao.NewExportQuery().Create(datastruct.ExportJob{
+		UserID: user.ID,
+		Status: datastruct.ExportPending,
+	})
+	if err != nil {
+		return job, ErrExportInternal
+	}
+
+	go s.run(job, user)
+
+	return job, nil
+}
+
+// Get returns the export job with the given ID, if it belongs to the user.
+func (s *exportService) Get(userID, id uint) (datastruct.ExportJob, error) {
+	job, err := s.dao.NewExportQuery().Get(userID, id)
+	if err == gorm.ErrRecordNotFound {
+		return job, ErrExportNotFound
+	}
+	if err != nil {
+		return job, ErrExportInternal
+	}
+
+	return job, nil
+}
+
+// Open returns the archive of the export, once done and until it expires.
+func (s *exportService) Open(job datastruct.ExportJob) (*os.File, error) {
+	if job.Status == datastruct.ExportExpired || (job.ExpiresAt != nil && !time.Now().Before(*job.ExpiresAt)) {
+		return nil, ErrExportExpired
+	}
+	if job.Status != datastruct.ExportDone {
+		return nil, ErrExportNotReady
+	}
+
+	f, err := os.Open(filepath.Join(s.config.Path, job.Filename))
+	if err != nil {
+		logrus.Errorf("cannot open export %d: %v", job.ID, err)
+		return nil, ErrExportInternal
+	}
+	return f, nil
+}
+
+// FailInterrupted marks as failed the exports left unfinished by a previous run of the server.
+func (s *exportService) FailInterrupted() error {
+	n, err := s.dao.NewExportQuery().FailUnfinished(errExportInterrupted.Error())
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		logrus.Warnf("%d exports interrupted by a server restart marked as failed", n)
+	}
+	return nil
+}
+
+// RemoveArchives removes the archives of all the exports of the user, whose jobs are left to the caller.
+func (s *exportService) RemoveArchives(userID uint) error {
+	jobs, err := s.dao.NewExportQuery().ListByUser(userID)
+	if err != nil {
+		return ErrExportInternal
+	}
+
+	for _, job := range jobs {
+		if job.Filename == "" {
+			continue
+		}
+		err := os.Remove(filepath.Join(s.config.Path, job.Filename))
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Errorf("cannot remove export %d: %v", job.ID, err)
+			return ErrExportInternal
+		}
+	}
+	return nil
+}
+
+// Run removes the expired archives every interval until the context is done.
+func (s *exportService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config.PruneIntervalSecs) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		s.prune()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *exportService) prune() {
+	for {
+		jobs, err := s.dao.NewExportQuery().ListExpired(time.Now(), exportPruneBatchSize)
+		if err != nil {
+			logrus.Errorf("cannot list the expired exports: %v", err)
+			return
+		}
+
+		for _, job := range jobs {
+			err := os.Remove(filepath.Join(s.config.Path, job.Filename))
+			if err != nil && !os.IsNotExist(err) {
+				logrus.Errorf("cannot remove export %d: %v", job.ID, err)
+				return
+			}
+			job.Status = datastruct.ExportExpired
+			if err := s.dao.NewExportQuery().Update(job); err != nil {
+				logrus.Errorf("cannot update export %d: %v", job.ID, err)
+				return
+			}
+		}
+		if len(jobs) < exportPruneBatchSize {
+			return
+		}
+	}
+}
+
+// run builds the archive of the job once a slot is free, recording its outcome and notifying the user.
+func (s *exportService) run(job datastruct.ExportJob, user datastruct.User) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	now := time.Now()
+	job.Status = datastruct.ExportRunning
+	job.StartedAt = &now
+	if err := s.dao.NewExportQuery().Update(job); err != nil {
+		logrus.Errorf("cannot update export %d: %v", job.ID, err)
+	}
+
+	err := s.build(&job, user)
+	now = time.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		logrus.Warnf("export %d failed: %v", job.ID, err)
+		job.Status = datastruct.ExportFailed
+		job.Error = err.Error()
+	} else {
+		expiresAt := now.Add(time.Duration(s.config.LinkTTLHours) * time.Hour)
+		job.Status = datastruct.ExportDone
+		job.ExpiresAt = &expiresAt
+	}
+	if err := s.dao.NewExportQuery().Update(job); err != nil {
+		logrus.Errorf("cannot update export %d: %v", job.ID, err)
+	}
+
+	if err := s.notify(job, user); err != nil {
+		logrus.Errorf("cannot send the email of export %d: %v", job.ID, err)
+	}
+}
+
+// build writes the archive of the data of the user to the export directory.
+func (s *exportService) build(job *datastruct.ExportJob, user datastruct.User) error {
+	if err := os.MkdirAll(s.config.Path, 0o700); err != nil {
+		return fmt.Errorf("cannot create the export directory: %w", err)
+	}
+	f, err := os.CreateTemp(s.config.Path, fmt.Sprintf("export-%d-*.zip", job.ID))
+	if err != nil {
+		return fmt.Errorf("cannot create the archive: %w", err)
+	}
+	done := false
+	defer func() {
+		if !done {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	archive := zip.NewWriter(f)
+	manifest, files, err := s.manifest(user)
+	if err != nil {
+		return err
+	}
+	if err := s.writeFiles(archive, job, files, manifest.Files); err != nil {
+		return err
+	}
+
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: exportManifestName, Method: zip.Deflate, Modified: manifest.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	done = true
+	job.Filename = filepath.Base(f.Name())
+	job.Size = info.Size()
+	return nil
+}
+
+// writeFiles copies the content of the files to the archive, recording in their entry of
+// the manifest their path or the reason they were left out of it.
+func (s *exportService) writeFiles(archive *zip.Writer, job *datastruct.ExportJob, files []datastruct.File, entries []dto.ExportFile) error {
+	used := make(map[string]bool)
+	for i, metaFile := range files {
+		file := &entries[i]
+		// Exports are not downloads, the files are neither touched nor promoted
+		content, err := s.files.OpenFile(metaFile)
+		if err != nil {
+			file.Skipped = err.Error()
+			job.Skipped++
+			continue
+		}
+
+		dir := exportFilesDir
+		if file.OriginalOf != "" {
+			dir = exportOriginalsDir
+		}
+		name := exportPath(path.Join(dir, file.Folder, file.Name), used)
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: file.CreatedAt})
+		if err != nil {
+			content.Close()
+			return err
+		}
+		_, err = io.Copy(w, content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("cannot copy file %s: %w", file.ID, err)
+		}
+
+		file.Path = name
+		job.Files++
+	}
+	return nil
+}
+
+// manifest gathers the data of the user, the content of the files aside, along with
+// the files listed in the manifest in the same order.
+func (s *exportService) manifest(user datastruct.User) (dto.ExportManifest, []datastruct.File, error) {
+	m := dto.ExportManifest{
+		GeneratedAt: time.Now().UTC(),
+		Profile: dto.ExportProfile{
+			ID:          user.ID,
+			FirstName:   user.FirstName,
+			LastName:    user.LastName,
+			Email:       user.Email,
+			PhoneNumber: user.PhoneNumber,
+			Role:        string(user.Role),
+			Verified:    user.Verified,
+			LegalHold:   user.LegalHold,
+			CreatedAt:   user.CreatedAt,
+			Settings: dto.UserSettingsRequest{
+				ScrubImageMetadata: user.ScrubImageMetadata,
+				KeepImageOriginal:  user.KeepImageOriginal,
+			},
+		},
+		Files:      []dto.ExportFile{},
+		ShareLinks: []dto.ExportShareLink{},
+		AppTokens:  []dto.AppTokenResponse{},
+		AccessKeys: []dto.AccessKeyResponse{},
+		Webhooks:   []dto.WebhookResponse{},
+		Audit:      []dto.AuditEntryResponse{},
+	}
+	// Entries targeting the user, their files and credentials
+	targets := []string{user.Email}
+
+	files, err := s.dao.NewFileQuery().ListInTree(user.ID, datastruct.RootFolder)
+	if err != nil {
+		return m, nil, fmt.Errorf("cannot list the files: %w", err)
+	}
+	var exported []datastruct.File
+	now := time.Now()
+	var scrubbed []string
+	for _, f := range files {
+		if f.IsExpired(now) {
+			continue
+		}
+		exported = append(exported, f)
+		m.Files = append(m.Files, exportFile(f))
+		targets = append(targets, f.UUID)
+		if f.Scrubbed {
+			scrubbed = append(scrubbed, f.UUID)
+		}
+	}
+	if len(scrubbed) > 0 {
+		originals, err := s.dao.NewFileQuery().ListOriginals(scrubbed)
+		if err != nil {
+			return m, nil, fmt.Errorf("cannot list the originals: %w", err)
+		}
+		for _, f := range originals {
+			exported = append(exported, f)
+			m.Files = append(m.Files, exportFile(f))
+			targets = append(targets, f.UUID)
+		}
+	}
+
+	tokens, err := s.dao.NewTokenQuery().ListByUser(user.ID)
+	if err != nil {
+		return m, nil, fmt.Errorf("cannot list the app tokens: %w", err)
+	}
+	for _, t := range tokens {
+		m.AppTokens = append(m.AppTokens, dto.AppTokenResponse{ID: t.ID, Name: t.Name, CreatedAt: t.CreatedAt, LastUsedAt: t.LastUsedAt})
+	}
+
+	keys, err := s.dao.NewAccessKeyQuery().ListByUser(user.ID)
+	if err != nil {
+		return m, nil, fmt.Errorf("cannot list the access keys: %w", err)
+	}
+	for _, k := range keys {
+		m.AccessKeys = append(m.AccessKeys, dto.AccessKeyResponse{ID: k.ID, KeyID: k.KeyID, CreatedAt: k.CreatedAt})
+		targets = append(targets, k.KeyID)
+	}
+
+	webhooks, err := s.dao.NewWebhookQuery().ListByUser(user.ID)
+	if err != nil {
+		return m, nil, fmt.Errorf("cannot list the webhooks: %w", err)
+	}
+	for _, w := range webhooks {
+		m.Webhooks = append(m.Webhooks, dto.WebhookResponse{ID: w.ID, URL: w.URL, Events: strings.Split(w.Events, ","), CreatedAt: w.CreatedAt})
+	}
+
+	err = s.dao.NewAuditQuery().ExportAbout(user.ID, targets, func(entry datastruct.AuditEntry) error {
+		// The addresses of the other actors, such as the admins, are not disclosed
+		if entry.ActorID != user.ID {
+			entry.IP = ""
+			entry.RequestID = ""
+		}
+		m.Audit = append(m.Audit, dto.AuditEntryResponse{
+			ID:        entry.ID,
+			Time:      entry.CreatedAt,
+			Action:    entry.Action,
+			ActorID:   entry.ActorID,
+			IP:        entry.IP,
+			RequestID: entry.RequestID,
+			Target:    entry.Target,
+			Outcome:   string(entry.Outcome),
+			Detail:    entry.Detail,
+		})
+
+		if entry.Action == auditPresign && entry.ActorID == user.ID && entry.Outcome == datastruct.AuditSuccess {
+			if method, target, ok := strings.Cut(entry.Target, " "); ok {
+				m.ShareLinks = append(m.ShareLinks, dto.ExportShareLink{Method: method, Path: target, CreatedAt: entry.CreatedAt})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return m, nil, fmt.Errorf("cannot export the audit entries: %w", err)
+	}
+
+	return m, exported, nil
+}
+
+// notify emails the outcome of the export to the user, with the download link of the archive once done.
+func (s *exportService) notify(job datastruct.ExportJob, user datastruct.User) error {
+	email := dto.Email{
+		From: s.from,
+		To:   user.Email,
+	}
+
+	if job.Status != datastruct.ExportDone {
+		email.Subject = "Your data export failed"
+		email.Body = fmt.Sprintf("Hi %s,<br><br>Your data export could not be completed, please request a new one.", user.FirstName)
+		return s.email.SendEmail(email)
+	}
+
+	p := utils.PresignedURL{
+		Method:  http.MethodGet,
+		Path:    fmt.Sprintf(ExportDownloadPath, job.ID),
+		Expires: *job.ExpiresAt,
+		UserID:  user.ID,
+	}
+	link := fmt.Sprintf("%s%s?%s", s.baseURL, p.Path, p.Sign(s.presignKey))
+
+	email.Subject = "Your data export is ready"
+	email.Body = fmt.Sprintf("Hi %s,<br><br>Your data export is ready, you can download it until %s at: <b>%s</b>.",
+		user.FirstName, job.ExpiresAt.UTC().Format(time.RFC1123), link)
+	return s.email.SendEmail(email)
+}
+
+func exportFile(f datastruct.File) dto.ExportFile {
+	file := dto.ExportFile{
+		ID:          f.UUID,
+		Name:        f.Name,
+		Folder:      f.Folder,
+		Size:        f.Size,
+		ContentType: f.ContentType,
+		MD5:         f.MD5,
+		CreatedAt:   f.CreatedAt,
+		ExpiresAt:   f.ExpiresAt,
+		RetainUntil: f.RetainUntil,
+		LegalHold:   f.LegalHold,
+		ScanStatus:  string(f.ScanStatus),
+		OriginalOf:  f.OriginalOf,
+	}
+	if f.ScrubbedMetadata != "" {
+		file.ScrubbedMetadata = strings.Split(f.ScrubbedMetadata, ",")
+	}
+	return file
+}
+
+// exportPath returns the path of a file in the archive, suffixed like "name (2).ext" if used already.
+func exportPath(name string, used map[string]bool) string {
+	unique := name
+	ext := path.Ext(name)
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[unique] = true
+	return unique
+}
@@ -0,0 +1,23 @@
+package service
+
+import "testing"
+
+func TestExportPath(t *testing.T) {
+	used := make(map[string]bool)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"files/report.pdf", "files/report.pdf"},
+		{"files/report.pdf", "files/report (2).pdf"},
+		{"files/report.pdf", "files/report (3).pdf"},
+		{"files/docs/report.pdf", "files/docs/report.pdf"},
+		{"files/README", "files/README"},
+		{"files/README", "files/README (2)"},
+	}
+	for _, tt := range tests {
+		if got := exportPath(tt.name, used); got != tt.want {
+			t.Errorf("exportPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
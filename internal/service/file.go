@@ -1,16 +1,21 @@
 package service
 
 import (
+	"bytes"
+	"crypto/md5"
 	"dryve/internal/datastruct"
 	"dryve/internal/repository"
+	"dryve/internal/utils"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
@@ -18,27 +23,81 @@ var ErrFileNotFound = fmt.Errorf("file not found")
 var ErrFileBadRequest = fmt.Errorf("bad file request")
 var ErrFileProcessing = fmt.Errorf("file processing error")
 var ErrFileInternal = fmt.Errorf("file processing error")
+var ErrFileExpired = fmt.Errorf("file expired")
+var ErrFileImmutable = fmt.Errorf("file is retained or under legal hold")
+var ErrFilePendingScan = fmt.Errorf("file pending malware scan")
+var ErrFileInfected = fmt.Errorf("file infected")
+
+// Subdirectory of the storage volumes holding the infected files.
+const quarantineDir = "quarantine"
 
 type FileService interface {
 	Get(id string) (datastruct.File, error)
-	SearchByDateRange(from, to time.Time) ([]datastruct.File, error)
-	Upload(multipart.File, *multipart.FileHeader) (datastruct.File, error)
+	SearchByDateRange(userID uint, from, to time.Time) ([]datastruct.File, error)
+	Upload(file io.Reader, name string, opts UploadOptions) (datastruct.File, error)
 	Delete(metaFile datastruct.File) error
+	DeleteMany(metaFiles []datastruct.File) error
+	GetOriginal(metaFile datastruct.File) (datastruct.File, error)
 	LoadFile(metaFile datastruct.File) (io.ReadCloser, error)
+	OpenFile(metaFile datastruct.File) (io.ReadCloser, error)
+	CheckMutable(metaFile datastruct.File) error
+	SetLegalHold(metaFile datastruct.File, hold bool) error
+	Scan(metaFile datastruct.File) (datastruct.File, error)
+	GetByPath(userID uint, folder, name string) (datastruct.File, error)
+	Move(metaFile datastruct.File, folder, name string) (datastruct.File, error)
+	GetFolder(userID uint, path string) (datastruct.Folder, error)
+	ListFolder(userID uint, path string) ([]datastruct.Folder, []datastruct.File, error)
+	ListTree(userID uint, path string) ([]datastruct.File, error)
+	CreateFolder(userID uint, path string) (datastruct.Folder, error)
+	CreateFolders(userID uint, path string) error
+	MoveFolder(userID uint, oldPath, newPath string) error
+	DeleteFolder(userID uint, path string) error
+}
+
+// UploadOptions are the optional settings of an uploaded file.
+type UploadOptions struct {
+	// ID of the user owning the file
+	UserID uint
+	// Path of the folder holding the file, the root folder if empty
+	Folder string
+	// Expiration time of the file, nil if it never expires
+	ExpiresAt *time.Time
+	// Time until which the file cannot be deleted or renamed, nil if not retained
+	RetainUntil *time.Time
+	// Whether the EXIF, XMP and GPS metadata of JPEG and PNG images is removed
+	ScrubImageMetadata bool
+	// Whether the original of the scrubbed images is kept as a private version
+	KeepImageOriginal bool
 }
 
 type fileService struct {
-	dao             repository.DAO
-	fileStoragePath string
+	dao        repository.DAO
+	storage    StoragePool
+	replicator Replicator
+	scanner    Scanner
+	scanSync   bool
+	events     EventBus
 }
 
-func NewFileService(dao repository.DAO, path string) FileService {
+// NewFileService creates a file service storing blobs on the volumes of the storage pool,
+// mirrored by the replicator, if any.
+// Uploads are scanned by the scanner, if any, before (sync) or after (async) returning.
+// Lifecycle events of the files are published on the event bus.
+func NewFileService(dao repository.DAO, storage StoragePool, replicator Replicator,
+	scanner Scanner, scanSync bool, events EventBus) FileService {
 	return &fileService{
-		dao:             dao,
-		fileStoragePath: path,
+		dao:        dao,
+		storage:    storage,
+		replicator: replicator,
+		scanner:    scanner,
+		scanSync:   scanSync,
+		events:     events,
 	}
 }
 
+// Get returns the metadata of the file with the given UUID.
+// Expired files not purged yet are returned along with ErrFileExpired.
+// The private originals of the scrubbed images are not found.
 func (s *fileService) Get(id string) (datastruct.File, error) {
 	var metaFile datastruct.File
 
@@ -50,42 +109,66 @@ func (s *fileService) Get(id string) (datastruct.File, error) {
 	if err != nil {
 		return metaFile, ErrFileInternal
 	}
+	if metaFile.OriginalOf != "" {
+		return datastruct.File{}, ErrFileNotFound
+	}
+	if metaFile.IsExpired(time.Now()) {
+		return metaFile, ErrFileExpired
+	}
 
 	return metaFile, nil
 }
 
-func (s *fileService) Upload(file multipart.File, fileHeader *multipart.FileHeader) (datastruct.File, error) {
+// GetOriginal returns the private original kept when the metadata of the image file was removed.
+func (s *fileService) GetOriginal(metaFile datastruct.File) (datastruct.File, error) {
+	original, err := s.dao.NewFileQuery().GetOriginal(metaFile.UUID)
+	if err == gorm.ErrRecordNotFound {
+		return original, ErrFileNotFound
+	}
+	if err != nil {
+		return original, ErrFileInternal
+	}
+
+	return original, nil
+}
+
+// Upload stores the content read from file as a new file with the given name, once normalized.
+// The MIME type of the content is detected from the name or the first bytes.
+// When enabled, the metadata of JPEG and PNG images is removed before they are stored,
+// the original being optionally kept as a private file on the same volume.
+func (s *fileService) Upload(file io.Reader, name string, opts UploadOptions) (datastruct.File, error) {
 	var metaFile datastruct.File
 
+	name = utils.NormalizeFilename(name)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return metaFile, ErrFileProcessing
+	}
+	head = head[:n]
+	file = io.MultiReader(bytes.NewReader(head), file)
+
 	// Generate a UUID for the file
 	// TODO: Validate file name against database to prevent duplicate filenames.
 	//       e.g. Mechanism of write-to-reserve and commit-to-store.
 	id := uuid.New().String()
 
-	buff := make([]byte, 512)
-	_, err := file.Read(buff)
-	if err != nil {
-		return metaFile, ErrFileProcessing
+	// Place the blob on the volume of the first tier with the most headroom
+	// TODO: Implement nested folders based on filename in a separate component
+	//       to support large amounts of files per volume.
+	//       e.g. 1234567890.jpg -> 123/456/7890.jpg
+	volume, err := s.storage.Place("")
+	if err == ErrStorageFull {
+		return metaFile, err
 	}
-
-	// TODO: Validate/Restrict available file type
-	// filetype := http.DetectContentType(buff)
-
-	_, err = file.Seek(0, io.SeekStart)
 	if err != nil {
 		return metaFile, ErrFileProcessing
 	}
-
-	// Creates the uploads directory if it doesn't exist
-	// TODO: Implement nested folders based on filename in a separate component
-	//       to support large amounts of files on multiple locations/servers.
-	//       e.g. 1234567890.jpg -> 123/456/7890.jpg
-	err = os.MkdirAll(s.fileStoragePath, os.ModePerm)
+	storedFilename := fmt.Sprintf("%s%s", id, filepath.Ext(name))
+	filePath, err := s.storage.Path(volume, storedFilename)
 	if err != nil {
 		return metaFile, ErrFileProcessing
 	}
-	storedFilename := fmt.Sprintf("%s%s", id, filepath.Ext(fileHeader.Filename))
-	filePath := filepath.Join(s.fileStoragePath, storedFilename)
 	f, err := os.Create(filePath)
 	if err != nil {
 		return metaFile, ErrFileBadRequest
@@ -93,53 +176,382 @@ func (s *fileService) Upload(file multipart.File, fileHeader *multipart.FileHead
 
 	defer f.Close()
 
-	_, err = io.Copy(f, file)
+	scrub := opts.ScrubImageMetadata && utils.IsScrubbableImage(head)
+	var original *datastruct.File
+	var originalPath string
+	if scrub && opts.KeepImageOriginal {
+		// The original is stored first, then scrubbed from its blob
+		original, originalPath, err = s.storeOriginal(file, volume, name)
+		if err != nil {
+			f.Close()
+			os.Remove(filePath)
+			return metaFile, err
+		}
+		o, err := os.Open(originalPath)
+		if err != nil {
+			f.Close()
+			os.Remove(filePath)
+			os.Remove(originalPath)
+			return metaFile, ErrFileProcessing
+		}
+		defer o.Close()
+		file = o
+	}
+	removeBlobs := func() {
+		f.Close()
+		os.Remove(filePath)
+		if original != nil {
+			os.Remove(originalPath)
+		}
+	}
+
+	hash := md5.New()
+	var fileSize int64
+	var scrubbed []string
+	if scrub {
+		counter := &countingWriter{}
+		scrubbed, err = utils.ScrubImageMetadata(io.MultiWriter(f, hash, counter), file)
+		fileSize = counter.n
+		if err == utils.ErrImageMalformed {
+			removeBlobs()
+			return metaFile, ErrFileBadRequest
+		}
+	} else {
+		fileSize, err = io.Copy(io.MultiWriter(f, hash), file)
+	}
 	if err != nil {
+		removeBlobs()
 		return metaFile, ErrFileProcessing
 	}
 
 	// Create a database entry for the file
-	fileSize := fileHeader.Size
+	scanStatus := datastruct.ScanClean
+	if s.scanner != nil {
+		scanStatus = datastruct.ScanPending
+	}
+
+	folder := opts.Folder
+	if folder == "" {
+		folder = datastruct.RootFolder
+	}
 
-	metaFile, err = s.dao.NewFileQuery().Create(id, fileHeader.Filename, fileSize, storedFilename)
+	metaFile, err = s.dao.NewFileQuery().Create(datastruct.File{
+		UserID:           opts.UserID,
+		UUID:             id,
+		Name:             name,
+		Folder:           folder,
+		Size:             fileSize,
+		MD5:              hex.EncodeToString(hash.Sum(nil)),
+		ContentType:      utils.DetectContentType(name, head),
+		Volume:           volume,
+		Filename:         storedFilename,
+		ExpiresAt:        opts.ExpiresAt,
+		RetainUntil:      opts.RetainUntil,
+		ScanStatus:       scanStatus,
+		Scrubbed:         scrub,
+		ScrubbedMetadata: strings.Join(scrubbed, ","),
+	})
 	if err != nil {
+		removeBlobs()
 		return metaFile, ErrFileProcessing
 	}
 
+	// The original shares the lifecycle of the scrubbed file and is scanned on its own
+	var originals []datastruct.File
+	if original != nil {
+		original.UserID = opts.UserID
+		original.Name = name
+		original.Folder = folder
+		original.ContentType = metaFile.ContentType
+		original.ExpiresAt = opts.ExpiresAt
+		original.RetainUntil = opts.RetainUntil
+		original.ScanStatus = scanStatus
+		original.OriginalOf = id
+
+		created, err := s.dao.NewFileQuery().Create(*original)
+		if err != nil {
+			os.Remove(originalPath)
+			if err := s.dao.NewFileQuery().DeleteAndEnqueue([]datastruct.File{metaFile}); err != nil {
+				logrus.Errorf("cannot delete file %s without original: %v", metaFile.UUID, err)
+			}
+			return metaFile, ErrFileProcessing
+		}
+		originals = append(originals, created)
+		if s.replicator != nil && created.ScanStatus == datastruct.ScanClean {
+			if err := s.replicator.Replicate(created); err != nil {
+				logrus.Errorf("cannot replicate original %s: %v", created.UUID, err)
+			}
+		}
+	}
+
+	// Files not scanned here, or failing the scan, are left pending for the ScanWorker
+	if s.scanner != nil && s.scanSync {
+		scanned, err := s.Scan(metaFile)
+		if err == ErrFileInfected {
+			return scanned, err
+		}
+		if err == nil {
+			metaFile = scanned
+		}
+	}
+
+	// Only clean blobs are replicated, those scanned later by the re-sync
+	if s.replicator != nil && metaFile.ScanStatus == datastruct.ScanClean {
+		if err = s.replicator.Replicate(metaFile); err != nil {
+			// Along with its original, which would be left hidden
+			if err := s.dao.NewFileQuery().DeleteAndEnqueue(append([]datastruct.File{metaFile}, originals...)); err != nil {
+				logrus.Errorf("cannot delete unreplicated file %s: %v", metaFile.UUID, err)
+			}
+			return metaFile, ErrFileProcessing
+		}
+	}
+
+	s.publish(EventFileUploaded, metaFile)
+
 	return metaFile, nil
 }
 
+// storeOriginal writes the content read from file to a new blob on the volume
+// and returns the metadata of the private original, not created yet, and the path of its blob.
+func (s *fileService) storeOriginal(file io.Reader, volume, name string) (*datastruct.File, string, error) {
+	id := uuid.New().String()
+	storedFilename := fmt.Sprintf("%s%s", id, filepath.Ext(name))
+	filePath, err := s.storage.Path(volume, storedFilename)
+	if err != nil {
+		return nil, "", ErrFileProcessing
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return nil, "", ErrFileBadRequest
+	}
+	defer f.Close()
+
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), file)
+	if err != nil {
+		f.Close()
+		os.Remove(filePath)
+		return nil, "", ErrFileProcessing
+	}
+
+	return &datastruct.File{
+		UUID:     id,
+		Size:     size,
+		MD5:      hex.EncodeToString(hash.Sum(nil)),
+		Volume:   volume,
+		Filename: storedFilename,
+	}, filePath, nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Delete removes the file metadata and schedules the blob for removal.
+// The blob itself is removed by the DeletionWorker.
 func (s *fileService) Delete(metaFile datastruct.File) error {
-	filePath := filepath.Join(s.fileStoragePath, metaFile.Filename)
-	err := os.Remove(filePath)
+	return s.DeleteMany([]datastruct.File{metaFile})
+}
+
+// DeleteMany removes the metadata of all the given files at once, so either
+// all of them or none are deleted, and schedules their blobs for removal.
+// The private originals of the scrubbed images are deleted along with them.
+func (s *fileService) DeleteMany(metaFiles []datastruct.File) error {
+	if len(metaFiles) == 0 {
+		return nil
+	}
+
+	for _, metaFile := range metaFiles {
+		if err := s.CheckMutable(metaFile); err != nil {
+			return err
+		}
+	}
+
+	deleted := metaFiles
+	var scrubbed []string
+	for _, metaFile := range metaFiles {
+		if metaFile.Scrubbed {
+			scrubbed = append(scrubbed, metaFile.UUID)
+		}
+	}
+	if len(scrubbed) > 0 {
+		originals, err := s.dao.NewFileQuery().ListOriginals(scrubbed)
+		if err != nil {
+			return ErrFileInternal
+		}
+		deleted = append(append([]datastruct.File{}, metaFiles...), originals...)
+	}
+
+	err := s.dao.NewFileQuery().DeleteAndEnqueue(deleted)
 	if err != nil {
 		return ErrFileInternal
 	}
 
-	// Remove from the database through dto
-	err = s.dao.NewFileQuery().Delete(metaFile.UUID)
+	for _, metaFile := range metaFiles {
+		s.publish(EventFileDeleted, metaFile)
+	}
+
+	return nil
+}
+
+// CheckMutable returns ErrFileImmutable if the file cannot be deleted or renamed,
+// because its retention period is running or it is under legal hold.
+func (s *fileService) CheckMutable(metaFile datastruct.File) error {
+	if metaFile.LegalHold || metaFile.IsRetained(time.Now()) {
+		return ErrFileImmutable
+	}
+
+	if metaFile.UserID == 0 {
+		return nil
+	}
+	user, err := s.dao.NewUserQuery().GetUser(metaFile.UserID)
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
 	if err != nil {
 		return ErrFileInternal
 	}
+	if user.LegalHold {
+		return ErrFileImmutable
+	}
 
 	return nil
 }
 
-func (s *fileService) LoadFile(metaFile datastruct.File) (file io.ReadCloser, err error) {
-	filePath := filepath.Join(s.fileStoragePath, metaFile.Filename)
-	file, err = os.Open(filePath)
+// SetLegalHold places or releases the legal hold of the file.
+func (s *fileService) SetLegalHold(metaFile datastruct.File, hold bool) error {
+	err := s.dao.NewFileQuery().SetLegalHold(metaFile.UUID, hold)
+	if err != nil {
+		return ErrFileInternal
+	}
+
+	return nil
+}
+
+// Scan runs the malware scan of the file and records its verdict.
+// Infected files are moved into quarantine and returned along with ErrFileInfected.
+func (s *fileService) Scan(metaFile datastruct.File) (datastruct.File, error) {
+	filePath, err := s.storage.Path(metaFile.Volume, metaFile.Filename)
+	if err != nil {
+		return metaFile, ErrFileInternal
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return metaFile, ErrFileInternal
+	}
+	res, err := s.scanner.Scan(f)
+	f.Close()
+	if err != nil {
+		return metaFile, err
+	}
+
+	if !res.Infected {
+		metaFile.ScanStatus = datastruct.ScanClean
+		if err = s.dao.NewFileQuery().Update(metaFile); err != nil {
+			return metaFile, ErrFileInternal
+		}
+		s.publish(EventFileUpdated, metaFile)
+		return metaFile, nil
+	}
+
+	// Move the blob into quarantine, out of the way of the clean ones
+	quarantined := filepath.Join(quarantineDir, filepath.Base(metaFile.Filename))
+	quarantinePath, err := s.storage.Path(metaFile.Volume, quarantined)
+	if err != nil {
+		return metaFile, ErrFileInternal
+	}
+	err = os.MkdirAll(filepath.Dir(quarantinePath), os.ModePerm)
+	if err != nil {
+		return metaFile, ErrFileInternal
+	}
+	err = os.Rename(filePath, quarantinePath)
+	if err != nil {
+		return metaFile, ErrFileInternal
+	}
+
+	metaFile.Filename = quarantined
+	metaFile.ScanStatus = datastruct.ScanInfected
+	metaFile.ScanSignature = res.Signature
+	if err = s.dao.NewFileQuery().Update(metaFile); err != nil {
+		return metaFile, ErrFileInternal
+	}
+	s.publish(EventFileUpdated, metaFile)
+
+	return metaFile, ErrFileInfected
+}
+
+// LoadFile opens the blob of the file for a download, like OpenFile.
+// The access is recorded and the blob promoted back to the first tier.
+func (s *fileService) LoadFile(metaFile datastruct.File) (io.ReadCloser, error) {
+	f, err := s.OpenFile(metaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.dao.NewFileQuery().Touch(metaFile.UUID, time.Now()); err != nil {
+		logrus.Errorf("cannot record access of file %s: %v", metaFile.UUID, err)
+	}
+	s.storage.Promote(metaFile)
+
+	s.publish(EventFileDownloaded, metaFile)
+
+	return f, nil
+}
+
+// OpenFile opens the blob of the file, which must have passed the malware scan, without
+// side effects, for internal reads like exports. A missing, truncated or corrupt primary
+// copy is repaired from a replica, which serves the blob meanwhile. Corruption is only
+// detected once read to the end.
+func (s *fileService) OpenFile(metaFile datastruct.File) (io.ReadCloser, error) {
+	switch metaFile.ScanStatus {
+	case datastruct.ScanPending:
+		return nil, ErrFilePendingScan
+	case datastruct.ScanInfected:
+		return nil, ErrFileInfected
+	}
+
+	filePath, err := s.storage.Path(metaFile.Volume, metaFile.Filename)
 	if err != nil {
-		// TODO: Better management of different errors
 		return nil, ErrFileInternal
 	}
+	f, err := openBlob(filePath, metaFile.Size)
+	if err != nil {
+		logrus.Errorf("cannot open blob %s: %v", metaFile.Filename, err)
+		if s.replicator == nil {
+			return nil, ErrFileInternal
+		}
+		s.replicator.Repair(metaFile)
+		if f, err = s.replicator.Open(metaFile); err != nil {
+			return nil, ErrFileInternal
+		}
+	}
 
-	return file, nil
+	return newVerifiedBlob(f, metaFile.MD5, func() {
+		logrus.Errorf("blob %s does not match its checksum", metaFile.Filename)
+		if s.replicator != nil {
+			s.replicator.Repair(metaFile)
+		}
+	}), nil
+}
+
+// publish publishes the event about the file, unless it is the hidden original of a scrubbed image.
+func (s *fileService) publish(eventType string, metaFile datastruct.File) {
+	if metaFile.OriginalOf != "" {
+		return
+	}
+	s.events.Publish(newFileEvent(eventType, metaFile))
 }
 
-func (s *fileService) SearchByDateRange(from, to time.Time) ([]datastruct.File, error) {
+func (s *fileService) SearchByDateRange(userID uint, from, to time.Time) ([]datastruct.File, error) {
 	var files []datastruct.File
 
-	files, err := s.dao.NewFileQuery().SearchByDateRange(from, to)
+	files, err := s.dao.NewFileQuery().SearchByDateRange(userID, from, to)
 	if err != nil {
 		return files, ErrFileInternal
 	}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"dryve/internal/datastruct"
+	"dryve/internal/utils"
+	"fmt"
+	"path"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrFolderNotFound = fmt.Errorf("folder not found")
+var ErrFolderExists = fmt.Errorf("folder already exists")
+var ErrFolderBadRequest = fmt.Errorf("bad folder request")
+
+// GetByPath returns the metadata of the file with the given name in a folder of the user.
+// The name is normalized as on upload.
+func (s *fileService) GetByPath(userID uint, folder, name string) (datastruct.File, error) {
+	name = utils.NormalizeFilename(name)
+	metaFile, err := s.dao.NewFileQuery().GetByPath(userID, folder, name)
+	if err == gorm.ErrRecordNotFound {
+		return metaFile, ErrFileNotFound
+	}
+	if err != nil {
+		return metaFile, ErrFileInternal
+	}
+
+	return metaFile, nil
+}
+
+// Move renames the file and moves it into another folder of its owner.
+// The new name is normalized as on upload.
+func (s *fileService) Move(metaFile datastruct.File, folder, name string) (datastruct.File, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return metaFile, ErrFileBadRequest
+	}
+	name = utils.NormalizeFilename(name)
+	if err := s.CheckMutable(metaFile); err != nil {
+		return metaFile, err
+	}
+	if _, err := s.GetFolder(metaFile.UserID, folder); err != nil {
+		return metaFile, err
+	}
+
+	metaFile.Folder = folder
+	metaFile.Name = name
+	if err := s.dao.NewFileQuery().Update(metaFile); err != nil {
+		return metaFile, ErrFileInternal
+	}
+	s.publish(EventFileUpdated, metaFile)
+
+	return metaFile, nil
+}
+
+// GetFolder returns the folder of the user with the given path, the root folder always exists.
+func (s *fileService) GetFolder(userID uint, path string) (datastruct.Folder, error) {
+	if path == datastruct.RootFolder {
+		return datastruct.Folder{UserID: userID, Path: datastruct.RootFolder}, nil
+	}
+
+	folder, err := s.dao.NewFolderQuery().Get(userID, path)
+	if err == gorm.ErrRecordNotFound {
+		return folder, ErrFolderNotFound
+	}
+	if err != nil {
+		return folder, ErrFileInternal
+	}
+
+	return folder, nil
+}
+
+// ListFolder returns the subfolders and the files directly in a folder of the user.
+func (s *fileService) ListFolder(userID uint, path string) ([]datastruct.Folder, []datastruct.File, error) {
+	if _, err := s.GetFolder(userID, path); err != nil {
+		return nil, nil, err
+	}
+
+	folders, err := s.dao.NewFolderQuery().ListChildren(userID, path)
+	if err != nil {
+		return nil, nil, ErrFileInternal
+	}
+	files, err := s.dao.NewFileQuery().ListByFolder(userID, path)
+	if err != nil {
+		return nil, nil, ErrFileInternal
+	}
+
+	return folders, files, nil
+}
+
+// ListTree returns all the files within a folder of the user and its subfolders.
+func (s *fileService) ListTree(userID uint, path string) ([]datastruct.File, error) {
+	if _, err := s.GetFolder(userID, path); err != nil {
+		return nil, err
+	}
+
+	files, err := s.dao.NewFileQuery().ListInTree(userID, path)
+	if err != nil {
+		return nil, ErrFileInternal
+	}
+
+	return files, nil
+}
+
+// CreateFolder creates a folder of the user, whose parent must exist.
+func (s *fileService) CreateFolder(userID uint, folderPath string) (datastruct.Folder, error) {
+	parent, name := path.Split(folderPath)
+	parent = path.Clean(parent)
+	if folderPath == datastruct.RootFolder || name == "" {
+		return datastruct.Folder{}, ErrFolderExists
+	}
+	if _, err := s.GetFolder(userID, parent); err != nil {
+		return datastruct.Folder{}, err
+	}
+	if err := s.checkFree(userID, folderPath); err != nil {
+		return datastruct.Folder{}, err
+	}
+
+	folder, err := s.dao.NewFolderQuery().Create(datastruct.Folder{
+		UserID: userID,
+		Path:   folderPath,
+		Parent: parent,
+	})
+	if err != nil {
+		return folder, ErrFileInternal
+	}
+
+	return folder, nil
+}
+
+// CreateFolders creates a folder of the user along with its missing parents.
+func (s *fileService) CreateFolders(userID uint, folderPath string) error {
+	if folderPath == datastruct.RootFolder {
+		return nil
+	}
+	if _, err := s.GetFolder(userID, folderPath); err != ErrFolderNotFound {
+		return err
+	}
+	if err := s.CreateFolders(userID, path.Dir(folderPath)); err != nil {
+		return err
+	}
+
+	_, err := s.CreateFolder(userID, folderPath)
+	return err
+}
+
+// MoveFolder moves a folder of the user, along with its content, to a new path.
+// Nothing is moved if any of the files within cannot be renamed.
+func (s *fileService) MoveFolder(userID uint, oldPath, newPath string) error {
+	if oldPath == datastruct.RootFolder || newPath == datastruct.RootFolder ||
+		strings.HasPrefix(newPath, strings.TrimSuffix(oldPath, "/")+"/") {
+		return ErrFolderBadRequest
+	}
+	if _, err := s.GetFolder(userID, oldPath); err != nil {
+		return err
+	}
+	if _, err := s.GetFolder(userID, path.Dir(newPath)); err != nil {
+		return err
+	}
+	if err := s.checkFree(userID, newPath); err != nil {
+		return err
+	}
+
+	files, err := s.dao.NewFileQuery().ListInTree(userID, oldPath)
+	if err != nil {
+		return ErrFileInternal
+	}
+	for _, metaFile := range files {
+		if err := s.CheckMutable(metaFile); err != nil {
+			return err
+		}
+	}
+
+	if err := s.dao.NewFolderQuery().Move(userID, oldPath, newPath); err != nil {
+		return ErrFileInternal
+	}
+	for _, metaFile := range files {
+		metaFile.Folder = newPath + strings.TrimPrefix(metaFile.Folder, oldPath)
+		s.publish(EventFileUpdated, metaFile)
+	}
+
+	return nil
+}
+
+// DeleteFolder deletes a folder of the user along with its content.
+// Nothing is deleted if any of the files within cannot be deleted.
+func (s *fileService) DeleteFolder(userID uint, path string) error {
+	if path == datastruct.RootFolder {
+		return ErrFolderBadRequest
+	}
+	if _, err := s.GetFolder(userID, path); err != nil {
+		return err
+	}
+
+	files, err := s.dao.NewFileQuery().ListInTree(userID, path)
+	if err != nil {
+		return ErrFileInternal
+	}
+	if err := s.DeleteMany(files); err != nil {
+		return err
+	}
+
+	if err := s.dao.NewFolderQuery().DeleteTree(userID, path); err != nil {
+		return ErrFileInternal
+	}
+
+	return nil
+}
+
+// checkFree returns ErrFolderExists if a folder or a file of the user already uses the path.
+func (s *fileService) checkFree(userID uint, folderPath string) error {
+	_, err := s.GetFolder(userID, folderPath)
+	if err == nil {
+		return ErrFolderExists
+	}
+	if err != ErrFolderNotFound {
+		return err
+	}
+
+	parent, name := path.Split(folderPath)
+	_, err = s.GetByPath(userID, path.Clean(parent), name)
+	if err == nil {
+		return ErrFolderExists
+	}
+	if err != ErrFileNotFound {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"dryve/internal/utils"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrImportNotFound = fmt.Errorf("import not found")
+var ErrImportBadRequest = fmt.Errorf("bad import request")
+var ErrImportInternal = fmt.Errorf("import processing error")
+
+// Reasons of the failed imports.
+var errImportForbidden = fmt.Errorf("address not allowed")
+var errImportTooManyRedirects = fmt.Errorf("too many redirects")
+var errImportTooLarge = fmt.Errorf("file too large")
+var errImportInterrupted = fmt.Errorf("interrupted by a server restart")
+
+// Name of the imported files whose name cannot be told from the URL or the response.
+const defaultImportName = "download"
+
+type ImportService interface {
+	Import(userID uint, rawURL, name string, opts UploadOptions) (datastruct.ImportJob, error)
+	Get(userID, id uint) (datastruct.ImportJob, error)
+	FailInterrupted() error
+}
+
+type importService struct {
+	dao     repository.DAO
+	files   FileService
+	client  *http.Client
+	maxSize int64
+	// Semaphore bounding the number of fetches running at once
+	slots chan struct{}
+}
+
+// NewImportService creates a service fetching files from remote URLs in background and
+// storing them with the file service. Fetches are limited to maxSize bytes, maxRedirects
+// redirects and the timeout, and cannot reach private, loopback and link-local addresses.
+func NewImportService(dao repository.DAO, files FileService, maxSize int64, maxRedirects int,
+	timeout time.Duration, maxConcurrent int) ImportService {
+	return &importService{
+		dao:     dao,
+		files:   files,
+		client:  newImportClient(maxRedirects, timeout, utils.IsPublicIP),
+		maxSize: maxSize,
+		slots:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+// newImportClient creates an HTTP client only connecting to the allowed addresses.
+// They are checked once resolved, so host names cannot be rebound to forbidden addresses.
+func newImportClient(maxRedirects int, timeout time.Duration, allowed func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !allowed(addr) {
+				return errImportForbidden
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		// No proxy, which would connect on behalf of the client past the checks
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return errImportTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errImportForbidden
+			}
+			return nil
+		},
+	}
+}
+
+// Import records an import job of the file at the URL and fetches it in background.
+// The name of the file is taken from the response when empty.
+func (s *importService) Import(userID uint, rawURL, name string, opts UploadOptions) (datastruct.ImportJob, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return datastruct.ImportJob{}, ErrImportBadRequest
+	}
+	// Forbidden literal addresses are rejected at once, the others once resolved
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !utils.IsPublicIP(addr) {
+		return datastruct.ImportJob{}, ErrImportBadRequest
+	}
+
+	job, err := s.dao.NewImportQuery().Create(datastruct.ImportJob{
+		UserID: userID,
+		URL:    u.String(),
+		Name:   name,
+		Status: datastruct.ImportPending,
+	})
+	if err != nil {
+		return job, ErrImportInternal
+	}
+
+	opts.UserID = userID
+	go s.run(job, opts)
+
+	return job, nil
+}
+
+// Get returns the import job with the given ID, if it belongs to the user.
+func (s *importService) Get(userID, id uint) (datastruct.ImportJob, error) {
+	job, err := s.dao.NewImportQuery().Get(userID, id)
+	if err == gorm.ErrRecordNotFound {
+		return job, ErrImportNotFound
+	}
+	if err != nil {
+		return job, ErrImportInternal
+	}
+
+	return job, nil
+}
+
+// FailInterrupted marks as failed the imports left unfinished by a previous run of the server.
+func (s *importService) FailInterrupted() error {
+	n, err := s.dao.NewImportQuery().FailUnfinished(errImportInterrupted.Error())
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		logrus.Warnf("%d imports interrupted by a server restart marked as failed", n)
+	}
+	return nil
+}
+
+// run fetches and stores the file of the job once a slot is free, recording its outcome.
+func (s *importService) run(job datastruct.ImportJob, opts UploadOptions) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	now := time.Now()
+	job.Status = datastruct.ImportRunning
+	job.StartedAt = &now
+	if err := s.dao.NewImportQuery().Update(job); err != nil {
+		logrus.Errorf("cannot update import %d: %v", job.ID, err)
+	}
+
+	metaFile, err := s.fetch(&job, opts)
+	now = time.Now()
+	job.FinishedAt = &now
+	if err != nil {
+		logrus.Warnf("import %d failed: %v", job.ID, err)
+		job.Status = datastruct.ImportFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = datastruct.ImportDone
+		job.FileUUID = metaFile.UUID
+	}
+	if err := s.dao.NewImportQuery().Update(job); err != nil {
+		logrus.Errorf("cannot update import %d: %v", job.ID, err)
+	}
+}
+
+// fetch downloads the file at the URL of the job and uploads it.
+func (s *importService) fetch(job *datastruct.ImportJob, opts UploadOptions) (datastruct.File, error) {
+	res, err := s.client.Get(job.URL)
+	if errors.Is(err, errImportForbidden) {
+		return datastruct.File{}, errImportForbidden
+	}
+	if errors.Is(err, errImportTooManyRedirects) {
+		return datastruct.File{}, errImportTooManyRedirects
+	}
+	if err != nil {
+		return datastruct.File{}, fmt.Errorf("cannot fetch the file: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return datastruct.File{}, fmt.Errorf("remote server returned %s", res.Status)
+	}
+	if res.ContentLength > s.maxSize {
+		return datastruct.File{}, errImportTooLarge
+	}
+	if job.Name == "" {
+		job.Name = importName(res)
+	}
+
+	body := &limitedReader{r: res.Body, left: s.maxSize}
+	metaFile, err := s.files.Upload(body, job.Name, opts)
+	job.Size = body.read
+	if body.exceeded {
+		return metaFile, errImportTooLarge
+	}
+	return metaFile, err
+}
+
+// importName returns the name of the fetched file, from the Content-Disposition
+// of the response or else the last segment of the final URL.
+func importName(res *http.Response) string {
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	name := path.Base(res.Request.URL.Path)
+	if name == "." || name == "/" {
+		return defaultImportName
+	}
+	return name
+}
+
+// limitedReader reads up to left bytes, failing once the content exceeds them.
+type limitedReader struct {
+	r        io.Reader
+	left     int64
+	read     int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// One more byte tells whether the content exceeds the limit
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	l.left -= int64(n)
+	if l.left < 0 {
+		l.exceeded = true
+		return n, errImportTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportClient(t *testing.T) {
+	// Redirects /n to /n-1 until /0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/%d", n-1), http.StatusFound)
+			return
+		}
+		io.WriteString(w, "imported")
+	}))
+	defer server.Close()
+
+	allowAll := func(netip.Addr) bool { return true }
+	tests := []struct {
+		name    string
+		path    string
+		allowed func(netip.Addr) bool
+		wantErr error
+	}{
+		{"direct", "/0", allowAll, nil},
+		{"redirects within the limit", "/2", allowAll, nil},
+		{"too many redirects", "/3", allowAll, errImportTooManyRedirects},
+		{"forbidden address", "/0", func(netip.Addr) bool { return false }, errImportForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newImportClient(2, 10*time.Second, tt.allowed)
+			res, err := client.Get(server.URL + tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != "imported" {
+				t.Errorf("Get() body = %q, want %q", body, "imported")
+			}
+		})
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		limit        int64
+		wantExceeded bool
+	}{
+		{"below", "hello", 10, false},
+		{"at the limit", "hello", 5, false},
+		{"above", "hello world", 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &limitedReader{r: strings.NewReader(tt.content), left: tt.limit}
+			_, err := io.ReadAll(l)
+			if l.exceeded != tt.wantExceeded {
+				t.Errorf("exceeded = %v, want %v", l.exceeded, tt.wantExceeded)
+			}
+			if tt.wantExceeded && err != errImportTooLarge {
+				t.Errorf("ReadAll() error = %v, want %v", err, errImportTooLarge)
+			}
+			if !tt.wantExceeded && err != nil {
+				t.Errorf("ReadAll() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestImportName(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		disposition string
+		want        string
+	}{
+		{"from the url", "https://example.com/data/set.csv", "", "set.csv"},
+		{"from the disposition", "https://example.com/download?id=1", `attachment; filename="report.pdf"`, "report.pdf"},
+		{"encoded disposition", "https://example.com/d", "attachment; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf", "résumé.pdf"},
+		{"without name", "https://example.com/", "", defaultImportName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			res := &http.Response{
+				Header:  http.Header{"Content-Disposition": {tt.disposition}},
+				Request: &http.Request{URL: u},
+			}
+			if got := importName(res); got != tt.want {
+				t.Errorf("importName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,7 @@ package service
 
 import (
 	"dryve/internal/config"
-	"dryve/internal/dto"
+	"dryve/pkg/dto"
 	"fmt"
 	"strings"
 )
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrUploadNotFound = fmt.Errorf("multipart upload not found")
+var ErrPartInvalid = fmt.Errorf("multipart part invalid")
+var ErrUploadTooLarge = fmt.Errorf("multipart upload too large")
+var ErrUploadInternal = fmt.Errorf("multipart upload processing error")
+
+// Subdirectory of the storage path holding the parts of the multipart uploads.
+const multipartDir = "multipart"
+
+// Max number of parts of a multipart upload, as in S3.
+const MaxParts = 10000
+
+// Max number of abandoned uploads aborted at once.
+const multipartPruneBatchSize = 100
+
+// CompletedPart is a part listed by the client to complete a multipart upload.
+type CompletedPart struct {
+	Number int
+	ETag   string
+}
+
+// MultipartService handles the S3 multipart uploads, whose parts are stored
+// apart from the files until assembled into one.
+type MultipartService interface {
+	Create(userID uint, bucket, key string) (datastruct.MultipartUpload, error)
+	Get(userID uint, uploadID string) (datastruct.MultipartUpload, error)
+	PutPart(upload datastruct.MultipartUpload, number int, part io.Reader) (string, error)
+	Assemble(upload datastruct.MultipartUpload, parts []CompletedPart) (io.ReadCloser, int64, error)
+	Abort(upload datastruct.MultipartUpload) error
+	Run(ctx context.Context)
+}
+
+type multipartService struct {
+	dao      repository.DAO
+	path     string
+	maxSize  int64
+	ttl      time.Duration
+	interval time.Duration
+}
+
+// NewMultipartService creates a multipart service storing the parts under the given storage path,
+// up to maxSize bytes per upload. The uploads older than ttl are aborted every interval.
+func NewMultipartService(dao repository.DAO, path string, maxSize int64, ttl, interval time.Duration) MultipartService {
+	return &multipartService{
+		dao:      dao,
+		path:     filepath.Join(path, multipartDir),
+		maxSize:  maxSize,
+		ttl:      ttl,
+		interval: interval,
+	}
+}
+
+// Create starts a multipart upload of the user.
+func (s *multipartService) Create(userID uint, bucket, key string) (datastruct.MultipartUpload, error) {
+	upload, err := s.dao.NewMultipartQuery().Create(datastruct.MultipartUpload{
+		UploadID: uuid.New().String(),
+		UserID:   userID,
+		Bucket:   bucket,
+		Key:      key,
+	})
+	if err != nil {
+		return upload, ErrUploadInternal
+	}
+
+	return upload, nil
+}
+
+// Get returns the multipart upload with the given ID, only to its owner.
+func (s *multipartService) Get(userID uint, uploadID string) (datastruct.MultipartUpload, error) {
+	upload, err := s.dao.NewMultipartQuery().Get(uploadID)
+	if err == gorm.ErrRecordNotFound || (err == nil && upload.UserID != userID) {
+		return datastruct.MultipartUpload{}, ErrUploadNotFound
+	}
+	if err != nil {
+		return upload, ErrUploadInternal
+	}
+
+	return upload, nil
+}
+
+// PutPart stores a part of the upload, replacing any previous one with the same number.
+// It returns the hex encoded MD5 of the part, its ETag. The parts of an upload cannot
+// exceed the max size altogether, or ErrUploadTooLarge is returned.
+func (s *multipartService) PutPart(upload datastruct.MultipartUpload, number int, part io.Reader) (string, error) {
+	if number < 1 || number > MaxParts {
+		return "", ErrPartInvalid
+	}
+
+	dir := filepath.Join(s.path, upload.UploadID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", ErrUploadInternal
+	}
+	used, err := partsSize(dir, number)
+	if err != nil {
+		return "", ErrUploadInternal
+	}
+	remaining := s.maxSize - used
+
+	// Written aside first, so a failed retry does not clobber the previous part
+	f, err := os.CreateTemp(dir, "part-*")
+	if err != nil {
+		return "", ErrUploadInternal
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(part, remaining+1))
+	if err != nil {
+		return "", ErrUploadInternal
+	}
+	if n > remaining {
+		return "", ErrUploadTooLarge
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, strconv.Itoa(number))); err != nil {
+		return "", ErrUploadInternal
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// partsSize returns the size of the parts stored in the directory of an upload, but the one
+// with the given number which is replaced, counting the parts being written.
+func partsSize(dir string, number int) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, e := range entries {
+		if e.Name() == strconv.Itoa(number) {
+			continue
+		}
+		info, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// Assemble returns the content of the listed parts, in ascending order and
+// matching their ETags, along with its size. The parts are kept until aborted.
+func (s *multipartService) Assemble(upload datastruct.MultipartUpload, parts []CompletedPart) (io.ReadCloser, int64, error) {
+	if len(parts) == 0 {
+		return nil, 0, ErrPartInvalid
+	}
+
+	var files multiReadCloser
+	var size int64
+	for i, part := range parts {
+		if i > 0 && part.Number <= parts[i-1].Number {
+			files.Close()
+			return nil, 0, ErrPartInvalid
+		}
+
+		f, err := os.Open(filepath.Join(s.path, upload.UploadID, strconv.Itoa(part.Number)))
+		if err != nil {
+			files.Close()
+			return nil, 0, ErrPartInvalid
+		}
+		files = append(files, f)
+
+		hash := md5.New()
+		n, err := io.Copy(hash, f)
+		if err != nil {
+			files.Close()
+			return nil, 0, ErrUploadInternal
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != strings.Trim(part.ETag, `"`) {
+			files.Close()
+			return nil, 0, ErrPartInvalid
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			files.Close()
+			return nil, 0, ErrUploadInternal
+		}
+		size += n
+	}
+
+	return &files, size, nil
+}
+
+// Abort removes the parts of the upload, once completed or given up.
+func (s *multipartService) Abort(upload datastruct.MultipartUpload) error {
+	if err := os.RemoveAll(filepath.Join(s.path, upload.UploadID)); err != nil {
+		return ErrUploadInternal
+	}
+	if err := s.dao.NewMultipartQuery().Delete(upload.UploadID); err != nil {
+		return ErrUploadInternal
+	}
+
+	return nil
+}
+
+// Run aborts the uploads older than the TTL every interval until the context is done.
+func (s *multipartService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.prune()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *multipartService) prune() {
+	before := time.Now().Add(-s.ttl)
+	var pruned int
+	for {
+		uploads, err := s.dao.NewMultipartQuery().ListBefore(before, multipartPruneBatchSize)
+		if err != nil {
+			logrus.Errorf("cannot list the abandoned multipart uploads: %v", err)
+			break
+		}
+		for _, upload := range uploads {
+			if err := s.Abort(upload); err != nil {
+				logrus.Errorf("cannot abort the abandoned multipart upload %s: %v", upload.UploadID, err)
+				return
+			}
+		}
+		pruned += len(uploads)
+		if len(uploads) < multipartPruneBatchSize {
+			break
+		}
+	}
+	if pruned > 0 {
+		logrus.Infof("aborted %d abandoned multipart uploads", pruned)
+	}
+}
+
+// multiReadCloser reads the files one after the other.
+type multiReadCloser []*os.File
+
+func (m *multiReadCloser) Read(p []byte) (int, error) {
+	for len(*m) > 0 {
+		n, err := (*m)[0].Read(p)
+		if err == io.EOF {
+			(*m)[0].Close()
+			*m = (*m)[1:]
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+func (m *multiReadCloser) Close() error {
+	for _, f := range *m {
+		f.Close()
+	}
+	*m = nil
+	return nil
+}
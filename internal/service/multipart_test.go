@@ -0,0 +1,107 @@
+package service
+
+import (
+	"dryve/internal/datastruct"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultipartAssemble(t *testing.T) {
+	s := NewMultipartService(nil, t.TempDir(), 1<<20, time.Hour, time.Hour)
+	upload := datastruct.MultipartUpload{UploadID: "upload"}
+
+	etags := map[int]string{}
+	for number, content := range map[int]string{1: "hello ", 2: "multipart ", 3: "world"} {
+		etag, err := s.PutPart(upload, number, strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("PutPart(%d) error = %v", number, err)
+		}
+		etags[number] = etag
+	}
+	if _, err := s.PutPart(upload, MaxParts+1, strings.NewReader("")); err != ErrPartInvalid {
+		t.Errorf("PutPart(%d) error = %v, want %v", MaxParts+1, err, ErrPartInvalid)
+	}
+
+	tests := []struct {
+		name    string
+		parts   []CompletedPart
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "all parts",
+			parts: []CompletedPart{{1, etags[1]}, {2, `"` + etags[2] + `"`}, {3, etags[3]}},
+			want:  "hello multipart world",
+		},
+		{
+			name:  "skipped part",
+			parts: []CompletedPart{{1, etags[1]}, {3, etags[3]}},
+			want:  "hello world",
+		},
+		{
+			name:    "unordered parts",
+			parts:   []CompletedPart{{2, etags[2]}, {1, etags[1]}},
+			wantErr: ErrPartInvalid,
+		},
+		{
+			name:    "wrong etag",
+			parts:   []CompletedPart{{1, etags[2]}},
+			wantErr: ErrPartInvalid,
+		},
+		{
+			name:    "missing part",
+			parts:   []CompletedPart{{1, etags[1]}, {4, etags[1]}},
+			wantErr: ErrPartInvalid,
+		},
+		{
+			name:    "no parts",
+			wantErr: ErrPartInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, size, err := s.Assemble(upload, tt.parts)
+			if err != tt.wantErr {
+				t.Fatalf("Assemble() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer content.Close()
+
+			got, err := io.ReadAll(content)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if string(got) != tt.want || size != int64(len(tt.want)) {
+				t.Errorf("Assemble() = %q (%d bytes), want %q", got, size, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultipartPutPartTooLarge(t *testing.T) {
+	s := NewMultipartService(nil, t.TempDir(), 10, time.Hour, time.Hour)
+	upload := datastruct.MultipartUpload{UploadID: "upload"}
+
+	tests := []struct {
+		number  int
+		content string
+		wantErr error
+	}{
+		{1, "hello", nil},
+		{2, "world!", ErrUploadTooLarge},
+		{2, "world", nil},
+		// Replacing a part only counts its new size
+		{1, "hi", nil},
+		{3, "abc", nil},
+		{4, "x", ErrUploadTooLarge},
+	}
+	for _, tt := range tests {
+		if _, err := s.PutPart(upload, tt.number, strings.NewReader(tt.content)); err != tt.wantErr {
+			t.Errorf("PutPart(%d, %q) error = %v, want %v", tt.number, tt.content, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"dryve/internal/datastruct"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Wildcard granting every permission, or every permission on a resource as a "<resource>:*" suffix
+const permissionWildcard = "*"
+
+// Permissions of the built-in roles, unless replaced in the config
+var defaultRoles = map[datastruct.Role][]string{
+	datastruct.ADMIN: {permissionWildcard},
+	datastruct.USER: {
+		string(datastruct.PermFilesRead),
+		string(datastruct.PermFilesWrite),
+		string(datastruct.PermFilesDelete),
+	},
+}
+
+type Authorizer interface {
+	Can(role datastruct.Role, perm datastruct.Permission) bool
+	Permissions(role datastruct.Role) []datastruct.Permission
+	Roles() []datastruct.Role
+	IsRole(role datastruct.Role) bool
+}
+
+// Default authorizer implementing Authorizer
+type authorizer struct {
+	// Granted permissions by role
+	roles map[datastruct.Role]map[datastruct.Permission]bool
+}
+
+// NewAuthorizer creates an authorizer granting the permissions of the built-in roles and of the given roles,
+// which define custom roles or replace the built-in ones. Unknown permissions are refused.
+func NewAuthorizer(roles map[string][]string) (Authorizer, error) {
+	grants := make(map[datastruct.Role][]string, len(defaultRoles)+len(roles))
+	for role, perms := range defaultRoles {
+		grants[role] = perms
+	}
+	for role, perms := range roles {
+		if role == "" {
+			return nil, fmt.Errorf("empty role name")
+		}
+		grants[datastruct.Role(role)] = perms
+	}
+
+	a := &authorizer{roles: make(map[datastruct.Role]map[datastruct.Permission]bool, len(grants))}
+	for role, perms := range grants {
+		granted := make(map[datastruct.Permission]bool)
+		for _, p := range perms {
+			matched := expandPermission(p)
+			if len(matched) == 0 {
+				return nil, fmt.Errorf("unknown permission %q of role %s", p, role)
+			}
+			for _, m := range matched {
+				granted[m] = true
+			}
+		}
+		a.roles[role] = granted
+	}
+	return a, nil
+}
+
+// expandPermission returns the permissions matched by a granted permission, which may be a wildcard.
+func expandPermission(p string) []datastruct.Permission {
+	var matched []datastruct.Permission
+	for _, perm := range datastruct.Permissions {
+		switch {
+		case p == permissionWildcard, p == string(perm):
+		case strings.HasSuffix(p, ":"+permissionWildcard) && strings.HasPrefix(string(perm), strings.TrimSuffix(p, permissionWildcard)):
+		default:
+			continue
+		}
+		matched = append(matched, perm)
+	}
+	return matched
+}
+
+// Can reports whether the role is granted the permission, never for unknown roles.
+func (a *authorizer) Can(role datastruct.Role, perm datastruct.Permission) bool {
+	return a.roles[role][perm]
+}
+
+// Permissions returns the permissions granted to the role, sorted.
+func (a *authorizer) Permissions(role datastruct.Role) []datastruct.Permission {
+	perms := make([]datastruct.Permission, 0, len(a.roles[role]))
+	for p := range a.roles[role] {
+		perms = append(perms, p)
+	}
+	sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+	return perms
+}
+
+// Roles returns the built-in and custom roles, sorted.
+func (a *authorizer) Roles() []datastruct.Role {
+	roles := make([]datastruct.Role, 0, len(a.roles))
+	for r := range a.roles {
+		roles = append(roles, r)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i] < roles[j] })
+	return roles
+}
+
+// IsRole reports whether the role is a built-in or custom role.
+func (a *authorizer) IsRole(role datastruct.Role) bool {
+	_, ok := a.roles[role]
+	return ok
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"dryve/internal/datastruct"
+	"testing"
+)
+
+func TestAuthorizerCan(t *testing.T) {
+	a, err := NewAuthorizer(map[string][]string{
+		"support": {"users:admin", "audit:read"},
+		"auditor": {"files:*", "audit:read"},
+		"user":    {"files:read", "files:write", "files:delete"},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthorizer() error = %v", err)
+	}
+
+	tests := []struct {
+		role datastruct.Role
+		perm datastruct.Permission
+		want bool
+	}{
+		{datastruct.ADMIN, datastruct.PermStorageAdmin, true},
+		{datastruct.ADMIN, datastruct.PermFilesDeleteRange, true},
+		{datastruct.USER, datastruct.PermFilesDelete, true},
+		// Replaced by the config
+		{datastruct.USER, datastruct.PermFilesDeleteRange, false},
+		{datastruct.USER, datastruct.PermUsersAdmin, false},
+		{"support", datastruct.PermUsersAdmin, true},
+		{"support", datastruct.PermFilesRead, false},
+		{"auditor", datastruct.PermFilesDeleteRange, true},
+		{"auditor", datastruct.PermFilesAdmin, true},
+		{"auditor", datastruct.PermStorageAdmin, false},
+		{"unknown", datastruct.PermFilesRead, false},
+		{"", datastruct.PermFilesRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+"/"+string(tt.perm), func(t *testing.T) {
+			if got := a.Can(tt.role, tt.perm); got != tt.want {
+				t.Errorf("Can(%q, %q) = %v, want %v", tt.role, tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAuthorizerInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles map[string][]string
+	}{
+		{"unknown permission", map[string][]string{"support": {"users:delete"}}},
+		{"unknown resource", map[string][]string{"support": {"billing:*"}}},
+		{"empty role", map[string][]string{"": {"files:read"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAuthorizer(tt.roles); err == nil {
+				t.Errorf("NewAuthorizer(%v) error = nil, want an error", tt.roles)
+			}
+		})
+	}
+}
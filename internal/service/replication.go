@@ -0,0 +1,399 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"dryve/internal/config"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"dryve/pkg/dto"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrReplicationFailed = fmt.Errorf("replication processing error")
+var ErrBlobCorrupt = fmt.Errorf("blob does not match its checksum")
+var ErrReplicaNotFound = fmt.Errorf("no healthy replica of the blob")
+
+// Replicator mirrors the clean blobs to the replica locations, serves them
+// when the primary copy is missing and repairs it from them.
+type Replicator interface {
+	Replicate(metaFile datastruct.File) error
+	Open(metaFile datastruct.File) (*os.File, error)
+	Repair(metaFile datastruct.File)
+	Remove(fileUUID, filename string) error
+	Run(ctx context.Context)
+	Status() ([]dto.ReplicaResponse, error)
+}
+
+// replica is a replica location along with the state of its re-sync.
+type replica struct {
+	config.ReplicaConfig
+	synced    int64
+	lastRunAt time.Time
+	lastError string
+}
+
+type replicator struct {
+	dao       repository.DAO
+	storage   StoragePool
+	replicas  []*replica
+	syncMode  bool
+	interval  time.Duration
+	batchSize int
+
+	mu sync.Mutex
+	// UUIDs of the files whose primary copy is being repaired
+	repairing sync.Map
+}
+
+// NewReplicator creates a replicator to the given replicas. In sync mode, Replicate
+// returns once the blob is on all of them, otherwise the blob is copied in background.
+// The lagging replicas are re-synced every interval.
+func NewReplicator(dao repository.DAO, storage StoragePool, replicas []config.ReplicaConfig, syncMode bool,
+	interval time.Duration, batchSize int) Replicator {
+	r := &replicator{
+		dao:       dao,
+		storage:   storage,
+		syncMode:  syncMode,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+	for _, c := range replicas {
+		r.replicas = append(r.replicas, &replica{ReplicaConfig: c})
+	}
+
+	return r
+}
+
+// Replicate copies the blob of the file to all the replicas.
+// In async mode it returns at once, the re-sync catching up on failures.
+func (r *replicator) Replicate(metaFile datastruct.File) error {
+	if !r.syncMode {
+		go func() {
+			if err := r.replicate(metaFile); err != nil {
+				logrus.Errorf("cannot replicate blob %s: %v", metaFile.Filename, err)
+			}
+		}()
+		return nil
+	}
+
+	if err := r.replicate(metaFile); err != nil {
+		logrus.Errorf("cannot replicate blob %s: %v", metaFile.Filename, err)
+		return ErrReplicationFailed
+	}
+	return nil
+}
+
+func (r *replicator) replicate(metaFile datastruct.File) error {
+	for _, rep := range r.replicas {
+		if err := r.replicateTo(metaFile, rep); err != nil {
+			return fmt.Errorf("replica %s: %w", rep.Name, err)
+		}
+	}
+	return nil
+}
+
+// replicateTo copies the blob of the file to the replica, unless it does not
+// match its checksum, and records the copy.
+func (r *replicator) replicateTo(metaFile datastruct.File, rep *replica) error {
+	src, err := r.storage.Path(metaFile.Volume, metaFile.Filename)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(rep.Path, metaFile.Filename)
+	if err := copyVerifiedBlob(src, dst, metaFile); err != nil {
+		return err
+	}
+
+	err = r.dao.NewReplicaQuery().Create(datastruct.Replica{
+		FileUUID: metaFile.UUID,
+		Name:     rep.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The file may have been deleted during the copy, its replicas being removed before
+	// the copy was done, so the copy is removed and its record too as nothing else would
+	current, err := r.dao.NewFileQuery().Get(metaFile.UUID)
+	if err == nil && current.Filename == metaFile.Filename {
+		return nil
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	logrus.Infof("blob %s deleted while replicated, removing its copy on replica %s", metaFile.Filename, rep.Name)
+	if err := removeBlob(dst); err != nil {
+		return err
+	}
+	return r.dao.NewReplicaQuery().DeleteByFile(metaFile.UUID)
+}
+
+// Open opens the first copy of the blob on the replicas with the size of the file.
+func (r *replicator) Open(metaFile datastruct.File) (*os.File, error) {
+	for _, rep := range r.replicas {
+		f, err := openBlob(filepath.Join(rep.Path, metaFile.Filename), metaFile.Size)
+		if err == nil {
+			return f, nil
+		}
+	}
+	return nil, ErrReplicaNotFound
+}
+
+// Repair restores in background the primary copy of the blob from the first
+// replica matching its checksum.
+func (r *replicator) Repair(metaFile datastruct.File) {
+	if _, running := r.repairing.LoadOrStore(metaFile.UUID, true); running {
+		return
+	}
+
+	go func() {
+		defer r.repairing.Delete(metaFile.UUID)
+
+		if err := r.repair(metaFile); err != nil {
+			logrus.Errorf("cannot repair blob %s: %v", metaFile.Filename, err)
+			return
+		}
+		logrus.Infof("blob %s repaired from a replica", metaFile.Filename)
+	}()
+}
+
+func (r *replicator) repair(metaFile datastruct.File) error {
+	dst, err := r.storage.Path(metaFile.Volume, metaFile.Filename)
+	if err != nil {
+		return err
+	}
+	for _, rep := range r.replicas {
+		err := copyVerifiedBlob(filepath.Join(rep.Path, metaFile.Filename), dst, metaFile)
+		if err == nil {
+			return nil
+		}
+		logrus.Warnf("cannot repair blob %s from replica %s: %v", metaFile.Filename, rep.Name, err)
+	}
+	return ErrReplicaNotFound
+}
+
+// Remove removes the copies of the blob from all the replicas.
+// Missing copies count as removed, so removals can be safely retried.
+func (r *replicator) Remove(fileUUID, filename string) error {
+	for _, rep := range r.replicas {
+		if err := removeBlob(filepath.Join(rep.Path, filename)); err != nil {
+			return err
+		}
+	}
+	return r.dao.NewReplicaQuery().DeleteByFile(fileUUID)
+}
+
+// Run re-syncs the lagging replicas every interval until the context is done.
+func (r *replicator) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, rep := range r.replicas {
+			r.resync(rep)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resync copies to the replica the clean blobs it lacks, by batches.
+// Blobs failing to be copied are retried on the next run.
+func (r *replicator) resync(rep *replica) {
+	now := time.Now()
+	var synced int64
+	var lastError string
+
+	var afterID uint
+	for {
+		files, err := r.dao.NewReplicaQuery().ListLagging(rep.Name, afterID, r.batchSize)
+		if err != nil {
+			logrus.Errorf("cannot list files lagging on replica %s: %v", rep.Name, err)
+			lastError = err.Error()
+			break
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		for _, file := range files {
+			afterID = file.ID
+			if err := r.replicateTo(file, rep); err != nil {
+				logrus.Errorf("cannot re-sync blob %s to replica %s: %v", file.Filename, rep.Name, err)
+				lastError = err.Error()
+				continue
+			}
+			synced++
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rep.lastRunAt = now
+	rep.synced += synced
+	if lastError != "" {
+		rep.lastError = lastError
+	}
+}
+
+// Status returns the replicas with the number of blobs they lack and the state of their re-sync.
+func (r *replicator) Status() ([]dto.ReplicaResponse, error) {
+	res := make([]dto.ReplicaResponse, 0, len(r.replicas))
+	for _, rep := range r.replicas {
+		lagging, err := r.dao.NewReplicaQuery().CountLagging(rep.Name)
+		if err != nil {
+			return nil, ErrReplicationFailed
+		}
+
+		replica := dto.ReplicaResponse{
+			Name:    rep.Name,
+			Path:    rep.Path,
+			Lagging: lagging,
+		}
+
+		r.mu.Lock()
+		replica.Synced = rep.synced
+		replica.LastError = rep.lastError
+		if !rep.lastRunAt.IsZero() {
+			replica.LastRunAt = rep.lastRunAt.Format(time.RFC3339)
+		}
+		r.mu.Unlock()
+
+		res = append(res, replica)
+	}
+
+	return res, nil
+}
+
+// openBlob opens the blob at the path, if it has the expected size.
+func openBlob(path string, size int64) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size() != size {
+		f.Close()
+		return nil, ErrBlobCorrupt
+	}
+
+	return f, nil
+}
+
+// copyVerifiedBlob copies the blob at src to dst, only once fully written and
+// matching the size and checksum of the file. Files without checksum only get their size checked.
+func copyVerifiedBlob(src, dst string, metaFile datastruct.File) error {
+	in, err := openBlob(src, metaFile.Size)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(dst), ".replicate-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), in); err != nil {
+		return err
+	}
+	if metaFile.MD5 != "" && hex.EncodeToString(hash.Sum(nil)) != metaFile.MD5 {
+		return ErrBlobCorrupt
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), dst)
+}
+
+// verifiedBlob is a blob checked against the checksum of its file when read
+// sequentially to the end. Reads past other seeks are not checked.
+// The file is not embedded, so copies cannot bypass Read with its WriteTo.
+type verifiedBlob struct {
+	f         *os.File
+	md5       string
+	hash      hash.Hash
+	offset    int64
+	verifying bool
+	// Called once when the content does not match the checksum
+	corrupt func()
+}
+
+func newVerifiedBlob(f *os.File, md5sum string, corrupt func()) *verifiedBlob {
+	return &verifiedBlob{
+		f:         f,
+		md5:       md5sum,
+		hash:      md5.New(),
+		verifying: md5sum != "",
+		corrupt:   corrupt,
+	}
+}
+
+func (b *verifiedBlob) Read(p []byte) (int, error) {
+	n, err := b.f.Read(p)
+	if !b.verifying {
+		return n, err
+	}
+
+	b.hash.Write(p[:n])
+	b.offset += int64(n)
+	if errors.Is(err, io.EOF) {
+		b.verifying = false
+		if hex.EncodeToString(b.hash.Sum(nil)) != b.md5 {
+			b.corrupt()
+			return n, ErrBlobCorrupt
+		}
+	}
+	return n, err
+}
+
+func (b *verifiedBlob) Seek(offset int64, whence int) (int64, error) {
+	pos, err := b.f.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+
+	// Seeking back to the start, e.g. after reading the size, restarts the check
+	if pos == 0 && b.md5 != "" {
+		b.hash.Reset()
+		b.offset = 0
+		b.verifying = true
+	} else if pos != b.offset {
+		b.verifying = false
+	}
+	return pos, nil
+}
+
+func (b *verifiedBlob) Close() error {
+	return b.f.Close()
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"crypto/md5"
+	"dryve/internal/config"
+	"dryve/internal/datastruct"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifiedBlob(t *testing.T) {
+	content := "hello replicated world"
+	sum := md5.Sum([]byte(content))
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name        string
+		md5         string
+		seek        int64
+		wantErr     error
+		wantCorrupt bool
+	}{
+		{"matching", checksum, 0, nil, false},
+		{"corrupt", "0123456789abcdef0123456789abcdef", 0, ErrBlobCorrupt, true},
+		{"without checksum", "", 0, nil, false},
+		{"not checked past a seek", "0123456789abcdef0123456789abcdef", 6, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "blob")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			corrupt := false
+			b := newVerifiedBlob(f, tt.md5, func() { corrupt = true })
+			defer b.Close()
+
+			// As http.ServeContent, which reads the size first
+			if _, err := b.Seek(0, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.Seek(tt.seek, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := io.ReadAll(b)
+			if err != tt.wantErr {
+				t.Errorf("ReadAll() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != content[tt.seek:] {
+				t.Errorf("ReadAll() = %q, want %q", got, content[tt.seek:])
+			}
+			if corrupt != tt.wantCorrupt {
+				t.Errorf("corrupt = %v, want %v", corrupt, tt.wantCorrupt)
+			}
+		})
+	}
+}
+
+func TestReplicatorRepair(t *testing.T) {
+	content := "hello replicated world"
+	sum := md5.Sum([]byte(content))
+	metaFile := datastruct.File{
+		UUID:     "uuid",
+		Volume:   DefaultVolume,
+		Filename: "uuid.txt",
+		Size:     int64(len(content)),
+		MD5:      hex.EncodeToString(sum[:]),
+	}
+
+	dir := t.TempDir()
+	replicas := []config.ReplicaConfig{
+		{Name: "corrupt", Path: filepath.Join(dir, "corrupt")},
+		{Name: "missing", Path: filepath.Join(dir, "missing")},
+		{Name: "healthy", Path: filepath.Join(dir, "healthy")},
+	}
+	copies := map[string]string{
+		"corrupt": "hello corrupted  world",
+		"healthy": content,
+	}
+	for name, data := range copies {
+		path := filepath.Join(dir, name, metaFile.Filename)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storage := NewStoragePool(nil, config.StorageConfig{Path: filepath.Join(dir, "primary")})
+	r := NewReplicator(nil, storage, replicas, true, 0, 0).(*replicator)
+
+	// The corrupt copy has the right size, only its checksum tells it apart
+	f, err := r.Open(metaFile)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	f.Close()
+
+	if err := r.repair(metaFile); err != nil {
+		t.Fatalf("repair() error = %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "primary", metaFile.Filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("repaired blob = %q, want %q", got, content)
+	}
+
+	metaFile.MD5 = "0123456789abcdef0123456789abcdef"
+	if err := r.repair(metaFile); err != ErrReplicaNotFound {
+		t.Errorf("repair() error = %v, want %v", err, ErrReplicaNotFound)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Max number of pending files scanned by the worker per run.
+const scanBatchSize = 20
+
+type ScanWorker interface {
+	Run(ctx context.Context)
+}
+
+// Default scanWorker implementing ScanWorker
+type scanWorker struct {
+	dao         repository.DAO
+	fileService FileService
+	interval    time.Duration
+}
+
+func NewScanWorker(dao repository.DAO, fileService FileService, interval time.Duration) ScanWorker {
+	return &scanWorker{
+		dao:         dao,
+		fileService: fileService,
+		interval:    interval,
+	}
+}
+
+// Run scans the pending files every interval until the context is done.
+func (w *scanWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.scan()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scan runs the malware scan of a batch of pending files.
+func (w *scanWorker) scan() {
+	files, err := w.dao.NewFileQuery().ListByScanStatus(datastruct.ScanPending, scanBatchSize)
+	if err != nil {
+		logrus.Errorf("cannot list files pending scan: %v", err)
+		return
+	}
+
+	for _, file := range files {
+		scanned, err := w.fileService.Scan(file)
+		if err == ErrFileInfected {
+			logrus.Warnf("file %s quarantined, found %s", file.UUID, scanned.ScanSignature)
+			continue
+		}
+		if err != nil {
+			logrus.Errorf("cannot scan file %s: %v", file.UUID, err)
+			// Stop on the first failure, the scanner is likely unavailable
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Size of the chunks streamed to clamd.
+const clamdChunkSize = 32 * 1024
+
+var ErrScanFailed = fmt.Errorf("malware scan failed")
+
+// ScanResult is the verdict of a malware scan.
+type ScanResult struct {
+	Infected  bool
+	Signature string
+}
+
+type Scanner interface {
+	Scan(r io.Reader) (ScanResult, error)
+}
+
+// clamdScanner implementing Scanner through the clamd INSTREAM protocol
+type clamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner creates a scanner talking to a clamd daemon listening
+// on the given network ("tcp" or "unix") and address.
+func NewClamdScanner(network, address string, timeout time.Duration) Scanner {
+	return &clamdScanner{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+// Scan streams the content to clamd in length-prefixed chunks and parses its verdict.
+func (s *clamdScanner) Scan(r io.Reader) (ScanResult, error) {
+	var res ScanResult
+
+	conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+	if err != nil {
+		return res, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return res, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	if _, err = conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return res, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	buff := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buff)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return res, fmt.Errorf("%w: %v", ErrScanFailed, err)
+			}
+			if _, err := conn.Write(buff[:n]); err != nil {
+				return res, fmt.Errorf("%w: %v", ErrScanFailed, err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("%w: %v", ErrScanFailed, err)
+		}
+	}
+
+	// A zero length chunk terminates the stream
+	if _, err = conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return res, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return res, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply parses replies like "stream: OK" or "stream: Eicar-Signature FOUND".
+func parseClamdReply(reply string) (ScanResult, error) {
+	var res ScanResult
+
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return res, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		res.Infected = true
+		res.Signature = strings.TrimSuffix(reply, " FOUND")
+		return res, nil
+	default:
+		return res, fmt.Errorf("%w: %s", ErrScanFailed, reply)
+	}
+}
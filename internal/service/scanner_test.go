@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd serves a single INSTREAM session, replying with the verdict
+// for the received content.
+func fakeClamd(t *testing.T, verdict func(content []byte) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		cmd, err := r.ReadString(0)
+		if err != nil || cmd != "zINSTREAM\x00" {
+			conn.Write([]byte("UNKNOWN COMMAND\x00"))
+			return
+		}
+
+		var content bytes.Buffer
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(r, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err := io.CopyN(&content, r, int64(n)); err != nil {
+				return
+			}
+		}
+
+		conn.Write([]byte(verdict(content.Bytes()) + "\x00"))
+	}()
+
+	return l.Addr().String()
+}
+
+func TestClamdScanner(t *testing.T) {
+	verdict := func(content []byte) string {
+		if bytes.Contains(content, []byte("EICAR")) {
+			return "stream: Eicar-Signature FOUND"
+		}
+		if len(content) == 0 {
+			return "INSTREAM size limit exceeded. ERROR"
+		}
+		return "stream: OK"
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    ScanResult
+		wantErr bool
+	}{
+		{
+			name:    "Clean file",
+			content: "hello world",
+			want:    ScanResult{},
+		},
+		{
+			name:    "Clean file larger than a chunk",
+			content: strings.Repeat("a", 3*clamdChunkSize+1),
+			want:    ScanResult{},
+		},
+		{
+			name:    "Infected file",
+			content: "X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR",
+			want:    ScanResult{Infected: true, Signature: "Eicar-Signature"},
+		},
+		{
+			name:    "Daemon error",
+			content: "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := fakeClamd(t, verdict)
+			s := NewClamdScanner("tcp", addr, 5*time.Second)
+
+			got, err := s.Scan(strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrScanFailed) {
+				t.Errorf("Scan() error = %v, want ErrScanFailed", err)
+			}
+			if got != tt.want {
+				t.Errorf("Scan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = NewClamdScanner("tcp", addr, time.Second).Scan(strings.NewReader("hello"))
+	if !errors.Is(err, ErrScanFailed) {
+		t.Errorf("Scan() error = %v, want ErrScanFailed", err)
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"dryve/internal/config"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"dryve/internal/utils"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrSessionInvalid = fmt.Errorf("invalid or expired refresh token")
+var ErrSessionReused = fmt.Errorf("refresh token reused, session revoked")
+var ErrSessionInternal = fmt.Errorf("session error")
+
+// Number of random bytes of the refresh tokens
+const refreshTokenBytes = 32
+
+// Session holds the tokens issued at login and at each refresh
+type Session struct {
+	UserID           uint
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+type SessionService interface {
+	Create(user datastruct.User) (Session, error)
+	Refresh(refreshToken string) (Session, error)
+	Logout(userID uint, jti string, expiresAt time.Time, all bool) error
+	RevokeAll(userID uint) error
+	IsRevoked(userID uint, jti string, issuedAt time.Time) (bool, error)
+	Run(ctx context.Context)
+}
+
+// Default sessionService implementing SessionService
+type sessionService struct {
+	dao        repository.DAO
+	config     config.JWTConfig
+	refreshTTL time.Duration
+	interval   time.Duration
+}
+
+// NewSessionService creates a service issuing short-lived access tokens along with
+// rotating refresh tokens, and revoking them.
+func NewSessionService(dao repository.DAO, c config.JWTConfig) SessionService {
+	return &sessionService{
+		dao:        dao,
+		config:     c,
+		refreshTTL: time.Duration(c.RefreshTTLHours) * time.Hour,
+		interval:   time.Duration(c.PruneIntervalSecs) * time.Second,
+	}
+}
+
+// Create starts a new session of the user, with a new family of refresh tokens.
+func (s *sessionService) Create(user datastruct.User) (Session, error) {
+	return s.issue(user, uuid.New().String())
+}
+
+// Refresh exchanges a refresh token for a new session of the same family. Refresh tokens can only be used
+// once: a used token presented again was stolen, or the session was, so the whole family is revoked along
+// with its access tokens and ErrSessionReused returned, with the UserID of the session set to audit it.
+func (s *sessionService) Refresh(refreshToken string) (Session, error) {
+	now := time.Now()
+
+	token, err := s.dao.NewSessionQuery().GetRefreshByHash(utils.HashToken(refreshToken))
+	if err == gorm.ErrRecordNotFound {
+		return Session{}, ErrSessionInvalid
+	}
+	if err != nil {
+		return Session{}, ErrSessionInternal
+	}
+	if token.RevokedAt != nil || !token.ExpiresAt.After(now) {
+		return Session{UserID: token.UserID}, ErrSessionInvalid
+	}
+	if token.UsedAt != nil {
+		return s.revokeReused(token)
+	}
+
+	// Another exchange of the same token may have won the race since it was loaded
+	n, err := s.dao.NewSessionQuery().MarkUsed(token.ID, now)
+	if err != nil {
+		return Session{}, ErrSessionInternal
+	}
+	if n == 0 {
+		return s.revokeReused(token)
+	}
+
+	user, err := s.dao.NewUserQuery().GetUser(token.UserID)
+	if err == gorm.ErrRecordNotFound {
+		return Session{UserID: token.UserID}, ErrSessionInvalid
+	}
+	if err != nil {
+		return Session{}, ErrSessionInternal
+	}
+	if user.Disabled {
+		return Session{UserID: token.UserID}, ErrSessionInvalid
+	}
+
+	return s.issue(*user, token.FamilyID)
+}
+
+// revokeReused revokes the family of a reused refresh token.
+func (s *sessionService) revokeReused(token datastruct.RefreshToken) (Session, error) {
+	logrus.Warnf("refresh token %d of user %d reused, revoking its family", token.ID, token.UserID)
+
+	if err := s.dao.NewSessionQuery().RevokeFamily(token.FamilyID, time.Now()); err != nil {
+		logrus.Errorf("cannot revoke the session family %s: %v", token.FamilyID, err)
+		return Session{}, ErrSessionInternal
+	}
+	return Session{UserID: token.UserID}, ErrSessionReused
+}
+
+// issue generates an access token and a refresh token of the given family for the user.
+func (s *sessionService) issue(user datastruct.User, familyID string) (Session, error) {
+	access, claims, err := utils.GenerateJWT(s.config, user)
+	if err != nil {
+		logrus.Errorf("cannot create jwt with error '%v'", err)
+		return Session{}, ErrSessionInternal
+	}
+
+	refresh := utils.RandToken(refreshTokenBytes)
+	token, err := s.dao.NewSessionQuery().CreateRefresh(datastruct.RefreshToken{
+		UserID:          user.ID,
+		Hash:            utils.HashToken(refresh),
+		FamilyID:        familyID,
+		AccessJTI:       claims.ID,
+		AccessExpiresAt: claims.ExpiresAt.Time,
+		ExpiresAt:       time.Now().Add(s.refreshTTL),
+	})
+	if err != nil {
+		logrus.Errorf("cannot create the refresh token of user %d: %v", user.ID, err)
+		return Session{}, ErrSessionInternal
+	}
+
+	return Session{
+		UserID:           user.ID,
+		AccessToken:      access,
+		AccessExpiresAt:  claims.ExpiresAt.Time,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: token.ExpiresAt,
+	}, nil
+}
+
+// Logout revokes the access token with the given jti and expiration, and the family of refresh
+// tokens it was issued with. With all, every session of the user is revoked.
+func (s *sessionService) Logout(userID uint, jti string, expiresAt time.Time, all bool) error {
+	now := time.Now()
+
+	if jti != "" && expiresAt.After(now) {
+		err := s.dao.NewSessionQuery().RevokeAccess(datastruct.RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt})
+		if err != nil {
+			logrus.Errorf("cannot revoke the access token %s: %v", jti, err)
+			return ErrSessionInternal
+		}
+	}
+
+	if all {
+		return s.RevokeAll(userID)
+	}
+
+	token, err := s.dao.NewSessionQuery().GetRefreshByAccessJTI(userID, jti)
+	if err == gorm.ErrRecordNotFound {
+		// Access tokens issued before the refresh tokens have no family
+		return nil
+	}
+	if err == nil {
+		err = s.dao.NewSessionQuery().RevokeFamily(token.FamilyID, now)
+	}
+	if err != nil {
+		logrus.Errorf("cannot revoke the session of access token %s: %v", jti, err)
+		return ErrSessionInternal
+	}
+	return nil
+}
+
+// RevokeAll revokes every session of the user, and the access tokens issued with them.
+func (s *sessionService) RevokeAll(userID uint) error {
+	if err := s.dao.NewSessionQuery().RevokeUser(userID, time.Now()); err != nil {
+		logrus.Errorf("cannot revoke the sessions of user %d: %v", userID, err)
+		return ErrSessionInternal
+	}
+	return nil
+}
+
+// IsRevoked reports whether the access token of the user with the given jti and issue time was revoked,
+// on its own or as issued before all the sessions of the user were revoked.
+func (s *sessionService) IsRevoked(userID uint, jti string, issuedAt time.Time) (bool, error) {
+	validAfter, err := s.dao.NewSessionQuery().TokensValidAfter(userID)
+	if err != nil {
+		return false, err
+	}
+	if validAfter != nil && issuedAt.Before(*validAfter) {
+		return true, nil
+	}
+	if jti == "" {
+		return false, nil
+	}
+	return s.dao.NewSessionQuery().IsRevoked(jti)
+}
+
+// Run prunes the expired refresh tokens and revocations every interval until the context is done.
+func (s *sessionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.dao.NewSessionQuery().DeleteExpired(time.Now())
+		if err != nil {
+			logrus.Errorf("cannot prune the expired sessions: %v", err)
+		} else if n > 0 {
+			logrus.Infof("pruned %d expired refresh tokens and revocations", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"dryve/internal/config"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"dryve/pkg/dto"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrVolumeNotFound = fmt.Errorf("storage volume not found")
+var ErrVolumeDraining = fmt.Errorf("storage volume already draining")
+var ErrStorageFull = fmt.Errorf("no storage volume with free space")
+var ErrStorageInternal = fmt.Errorf("storage processing error")
+
+// Name of the volume at the storage path, holding the blobs stored before
+// volumes were configured unless a volume of that name is configured.
+const DefaultVolume = "default"
+
+// Number of files relocated per batch when draining a volume.
+const drainBatchSize = 100
+
+// StoragePool spreads the blobs over the storage volumes, grouped in tiers.
+type StoragePool interface {
+	Place(tier string) (string, error)
+	Path(volume, filename string) (string, error)
+	Tier(volume string) string
+	Tiers() []config.TierConfig
+	TierVolumes(tier string) []string
+	Move(file datastruct.File, tier string) error
+	Promote(file datastruct.File)
+	Volumes() ([]dto.VolumeResponse, error)
+	Drain(name string) error
+}
+
+// volume is a storage volume along with the state of its drain.
+type volume struct {
+	config.VolumeConfig
+	// Whether the volume gets no new blobs, and its blobs are being relocated if running
+	draining  bool
+	running   bool
+	relocated int64
+	failed    int64
+	lastError string
+}
+
+type storagePool struct {
+	dao     repository.DAO
+	volumes []*volume
+	tiers   []config.TierConfig
+	// Returns the free and total bytes of the filesystem at the path
+	diskUsage func(path string) (int64, int64, error)
+
+	mu sync.Mutex
+	// UUIDs of the files being promoted
+	promoting sync.Map
+}
+
+// NewStoragePool creates a pool of the configured volumes. The storage path is
+// the default volume, which only gets new blobs when no volume is configured.
+// Volumes without tier are in the first one.
+func NewStoragePool(dao repository.DAO, c config.StorageConfig) StoragePool {
+	p := &storagePool{
+		dao:       dao,
+		tiers:     c.Tiers,
+		diskUsage: diskUsage,
+	}
+
+	hasDefault := false
+	for _, v := range c.Volumes {
+		hasDefault = hasDefault || v.Name == DefaultVolume
+		if v.Tier == "" {
+			v.Tier = p.hottest()
+		}
+		p.volumes = append(p.volumes, &volume{VolumeConfig: v})
+	}
+	if !hasDefault {
+		weight := 0
+		if len(c.Volumes) == 0 {
+			weight = 1
+		}
+		p.volumes = append(p.volumes, &volume{VolumeConfig: config.VolumeConfig{
+			Name:   DefaultVolume,
+			Path:   c.Path,
+			Weight: weight,
+			Tier:   p.hottest(),
+		}})
+	}
+
+	return p
+}
+
+// hottest returns the name of the first tier, empty without tiers.
+func (p *storagePool) hottest() string {
+	if len(p.tiers) == 0 {
+		return ""
+	}
+	return p.tiers[0].Name
+}
+
+// Place returns the name of the volume of the tier, the first one if empty, a new blob
+// should be stored on: the one with the most free space past its reserve, weighted.
+// Draining volumes get no new blobs.
+func (p *storagePool) Place(tier string) (string, error) {
+	if tier == "" {
+		tier = p.hottest()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best string
+	var bestScore float64
+	for _, v := range p.volumes {
+		if v.Tier != tier || v.Weight <= 0 || v.draining {
+			continue
+		}
+		if err := os.MkdirAll(v.Path, os.ModePerm); err != nil {
+			logrus.Errorf("cannot create storage volume %s: %v", v.Name, err)
+			continue
+		}
+		free, _, err := p.diskUsage(v.Path)
+		if err != nil {
+			logrus.Errorf("cannot read free space of storage volume %s: %v", v.Name, err)
+			continue
+		}
+
+		headroom := free - v.ReservedBytes
+		if headroom <= 0 {
+			continue
+		}
+		if score := float64(headroom) * float64(v.Weight); score > bestScore {
+			best, bestScore = v.Name, score
+		}
+	}
+
+	if best == "" {
+		return "", ErrStorageFull
+	}
+	return best, nil
+}
+
+// Path returns the path of a blob stored on the given volume.
+// Blobs without a volume are on the default one.
+func (p *storagePool) Path(name, filename string) (string, error) {
+	v, err := p.volume(name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(v.Path, filename), nil
+}
+
+// Tier returns the name of the tier of the volume, empty if unknown or without tiers.
+func (p *storagePool) Tier(name string) string {
+	v, err := p.volume(name)
+	if err != nil {
+		return ""
+	}
+	return v.Tier
+}
+
+// Tiers returns the tiers from the fastest to the slowest.
+func (p *storagePool) Tiers() []config.TierConfig {
+	return p.tiers
+}
+
+// TierVolumes returns the names of the volumes of the tier.
+func (p *storagePool) TierVolumes(tier string) []string {
+	var names []string
+	for _, v := range p.volumes {
+		if v.Tier == tier {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+func (p *storagePool) volume(name string) (*volume, error) {
+	if name == "" {
+		name = DefaultVolume
+	}
+	for _, v := range p.volumes {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return nil, ErrVolumeNotFound
+}
+
+// Volumes returns the volumes with their usage and the state of their drain.
+func (p *storagePool) Volumes() ([]dto.VolumeResponse, error) {
+	res := make([]dto.VolumeResponse, 0, len(p.volumes))
+	for _, v := range p.volumes {
+		files, err := p.dao.NewFileQuery().CountByVolume(v.Name)
+		if err != nil {
+			return nil, ErrStorageInternal
+		}
+
+		volume := dto.VolumeResponse{
+			Name:          v.Name,
+			Path:          v.Path,
+			Weight:        v.Weight,
+			ReservedBytes: v.ReservedBytes,
+			Tier:          v.Tier,
+			Files:         files,
+		}
+		if free, total, err := p.diskUsage(v.Path); err == nil {
+			volume.FreeBytes = free
+			volume.TotalBytes = total
+		}
+
+		p.mu.Lock()
+		volume.Draining = v.draining
+		volume.Running = v.running
+		volume.Relocated = v.relocated
+		volume.Failed = v.failed
+		volume.LastError = v.lastError
+		p.mu.Unlock()
+
+		res = append(res, volume)
+	}
+
+	return res, nil
+}
+
+// Drain stops placing new blobs on the volume and starts relocating its blobs
+// to the other volumes of its tier in background. The volume keeps serving the blobs not
+// relocated yet, and gets new blobs again once the server restarts. Draining
+// it again retries the blobs that failed to be relocated.
+func (p *storagePool) Drain(name string) error {
+	v, err := p.volume(name)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v.running {
+		return ErrVolumeDraining
+	}
+	v.draining = true
+	v.running = true
+	v.relocated = 0
+	v.failed = 0
+	v.lastError = ""
+
+	go p.drain(v)
+
+	return nil
+}
+
+// drain relocates the blobs of the volume by batches, those failing are left in place.
+func (p *storagePool) drain(v *volume) {
+	defer func() {
+		p.mu.Lock()
+		v.running = false
+		p.mu.Unlock()
+	}()
+
+	var afterID uint
+	for {
+		files, err := p.dao.NewFileQuery().ListByVolume(v.Name, afterID, drainBatchSize)
+		if err != nil {
+			logrus.Errorf("cannot list files of storage volume %s: %v", v.Name, err)
+			p.recordDrain(v, false, err.Error())
+			return
+		}
+		if len(files) == 0 {
+			logrus.Infof("storage volume %s drained", v.Name)
+			return
+		}
+
+		for _, file := range files {
+			afterID = file.ID
+			// The scan may still quarantine the blob, it is relocated by the next drain
+			if file.ScanStatus == datastruct.ScanPending {
+				p.recordDrain(v, false, ErrFilePendingScan.Error())
+				continue
+			}
+			if err := p.relocate(file, v.Tier); err != nil {
+				logrus.Errorf("cannot relocate blob %s from storage volume %s: %v", file.Filename, v.Name, err)
+				p.recordDrain(v, false, err.Error())
+				continue
+			}
+			p.recordDrain(v, true, "")
+		}
+	}
+}
+
+func (p *storagePool) recordDrain(v *volume, relocated bool, lastError string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if relocated {
+		v.relocated++
+		return
+	}
+	v.failed++
+	v.lastError = lastError
+}
+
+// Move relocates the blob of the file to a volume of the tier, unless already there.
+func (p *storagePool) Move(file datastruct.File, tier string) error {
+	if p.Tier(file.Volume) == tier {
+		return nil
+	}
+	return p.relocate(file, tier)
+}
+
+// Promote moves in background the blob of the file to the first tier, if not there.
+func (p *storagePool) Promote(file datastruct.File) {
+	tier := p.hottest()
+	if p.Tier(file.Volume) == tier || file.ScanStatus == datastruct.ScanPending {
+		return
+	}
+	if _, running := p.promoting.LoadOrStore(file.UUID, true); running {
+		return
+	}
+
+	go func() {
+		defer p.promoting.Delete(file.UUID)
+
+		if err := p.relocate(file, tier); err != nil {
+			logrus.Errorf("cannot promote blob %s to tier %s: %v", file.Filename, tier, err)
+		}
+	}()
+}
+
+// relocate copies the blob of the file to a volume of the tier and records it there.
+// The previous copy is removed by the DeletionWorker.
+func (p *storagePool) relocate(file datastruct.File, tier string) error {
+	target, err := p.Place(tier)
+	if err != nil {
+		return err
+	}
+	src, err := p.Path(file.Volume, file.Filename)
+	if err != nil {
+		return err
+	}
+	dst, err := p.Path(target, file.Filename)
+	if err != nil {
+		return err
+	}
+
+	if err := copyBlob(src, dst); err != nil {
+		return err
+	}
+
+	updated, err := p.dao.NewFileQuery().Relocate(file, target)
+	if err != nil || updated == 0 {
+		// Deleted or moved meanwhile, the copy is of no use
+		os.Remove(dst)
+	}
+	return err
+}
+
+// copyBlob copies the blob at src to dst, which only appears once fully written.
+func copyBlob(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(dst), ".relocate-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), dst)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package service
+
+import "errors"
+
+// diskUsage is only supported on unix systems, volumes get no new blobs elsewhere.
+func diskUsage(path string) (int64, int64, error) {
+	return 0, 0, errors.New("disk usage not supported on this system")
+}
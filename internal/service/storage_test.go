@@ -0,0 +1,160 @@
+package service
+
+import (
+	"dryve/internal/config"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoragePoolPlace(t *testing.T) {
+	dir := t.TempDir()
+	free := map[string]int64{}
+	volume := func(name string, weight int, reserved int64, available int64) config.VolumeConfig {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d", name, len(free)))
+		free[path] = available
+		return config.VolumeConfig{Name: name, Path: path, Weight: weight, ReservedBytes: reserved}
+	}
+	tiered := func(v config.VolumeConfig, tier string) config.VolumeConfig {
+		v.Tier = tier
+		return v
+	}
+	tiers := []config.TierConfig{{Name: "hot", DemoteAfterDays: 30}, {Name: "cold"}}
+
+	tests := []struct {
+		name     string
+		volumes  []config.VolumeConfig
+		tiers    []config.TierConfig
+		tier     string
+		draining string
+		want     string
+		wantErr  error
+	}{
+		{
+			name: "default volume",
+			want: DefaultVolume,
+		},
+		{
+			name:    "most free space",
+			volumes: []config.VolumeConfig{volume("a", 1, 0, 100), volume("b", 1, 0, 300)},
+			want:    "b",
+		},
+		{
+			name:    "reserved space",
+			volumes: []config.VolumeConfig{volume("a", 1, 0, 100), volume("b", 1, 250, 300)},
+			want:    "a",
+		},
+		{
+			name:    "weighted",
+			volumes: []config.VolumeConfig{volume("a", 4, 0, 100), volume("b", 1, 0, 300)},
+			want:    "a",
+		},
+		{
+			name:    "no weight",
+			volumes: []config.VolumeConfig{volume("a", 0, 0, 300), volume("b", 1, 0, 100)},
+			want:    "b",
+		},
+		{
+			name:     "draining",
+			volumes:  []config.VolumeConfig{volume("a", 1, 0, 300), volume("b", 1, 0, 100)},
+			draining: "a",
+			want:     "b",
+		},
+		{
+			name:    "full",
+			volumes: []config.VolumeConfig{volume("a", 1, 100, 100), volume("b", 1, 0, 0)},
+			wantErr: ErrStorageFull,
+		},
+		{
+			name:    "first tier",
+			volumes: []config.VolumeConfig{tiered(volume("ssd", 1, 0, 100), "hot"), tiered(volume("hdd", 1, 0, 300), "cold")},
+			tiers:   tiers,
+			want:    "ssd",
+		},
+		{
+			name:    "given tier",
+			volumes: []config.VolumeConfig{tiered(volume("ssd", 1, 0, 300), "hot"), tiered(volume("hdd", 1, 0, 100), "cold")},
+			tiers:   tiers,
+			tier:    "cold",
+			want:    "hdd",
+		},
+		{
+			name:    "volume without tier in the first one",
+			volumes: []config.VolumeConfig{volume("ssd", 1, 0, 100), tiered(volume("hdd", 1, 0, 300), "cold")},
+			tiers:   tiers,
+			want:    "ssd",
+		},
+		{
+			name:    "full tier",
+			volumes: []config.VolumeConfig{tiered(volume("ssd", 1, 100, 100), "hot"), tiered(volume("hdd", 1, 0, 300), "cold")},
+			tiers:   tiers,
+			wantErr: ErrStorageFull,
+		},
+		{
+			name:    "unknown free space",
+			volumes: []config.VolumeConfig{volume("a", 1, 0, -1)},
+			wantErr: ErrStorageFull,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewStoragePool(nil, config.StorageConfig{
+				Path:    filepath.Join(dir, DefaultVolume),
+				Volumes: tt.volumes,
+				Tiers:   tt.tiers,
+			}).(*storagePool)
+			p.diskUsage = func(path string) (int64, int64, error) {
+				available, ok := free[path]
+				if !ok {
+					available = 1 << 30
+				}
+				if available < 0 {
+					return 0, 0, errors.New("statfs failed")
+				}
+				return available, 1 << 40, nil
+			}
+			if tt.draining != "" {
+				v, _ := p.volume(tt.draining)
+				v.draining = true
+			}
+
+			got, err := p.Place(tt.tier)
+			if err != tt.wantErr {
+				t.Fatalf("Place() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Place() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoragePoolPath(t *testing.T) {
+	p := NewStoragePool(nil, config.StorageConfig{
+		Path:    "/data/legacy",
+		Volumes: []config.VolumeConfig{{Name: "disk1", Path: "/mnt/disk1", Weight: 1}},
+	})
+
+	tests := []struct {
+		volume  string
+		want    string
+		wantErr error
+	}{
+		{"disk1", "/mnt/disk1/blob.txt", nil},
+		{DefaultVolume, "/data/legacy/blob.txt", nil},
+		{"", "/data/legacy/blob.txt", nil},
+		{"disk2", "", ErrVolumeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.volume, func(t *testing.T) {
+			got, err := p.Path(tt.volume, "blob.txt")
+			if err != tt.wantErr {
+				t.Fatalf("Path() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Path() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package service
+
+import "syscall"
+
+// diskUsage returns the free bytes available to the server and the total
+// bytes of the filesystem at the path.
+func diskUsage(path string) (int64, int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), int64(stat.Blocks) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"dryve/internal/utils"
+	"dryve/pkg/dto"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type of the signal telling a stream client that it missed events, and must list its files again.
+const StreamResync = "resync"
+
+// Types of the events pushed to the stream clients.
+var streamedEvents = map[string]bool{
+	EventFileUploaded: true,
+	EventFileUpdated:  true,
+	EventFileDeleted:  true,
+}
+
+// StreamEvent is an event along with its position in the stream.
+type StreamEvent struct {
+	// ID of the event in the stream, which clients resume from
+	ID    string
+	Event dto.Event
+}
+
+// Subscription receives the stream events of a user.
+type Subscription struct {
+	// Events missed since the last event ID given on subscription
+	Backlog []StreamEvent
+	// Whether events were missed past the history, or the last event ID is unknown
+	Resync bool
+	// Live events, closed once the subscription is closed or the client falls behind
+	C <-chan StreamEvent
+
+	close func()
+}
+
+// Close stops the delivery of the events to the subscription.
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// EventStream pushes the file events to the connected clients of their users.
+// The latest events are kept, so reconnecting clients resume where they left off.
+type EventStream interface {
+	Handle(event dto.Event)
+	Subscribe(userID uint, lastEventID string) *Subscription
+}
+
+// Default eventStream implementing EventStream in process
+type eventStream struct {
+	mu sync.Mutex
+	// Random prefix of the event IDs, telling apart those of a previous run of the server
+	epoch string
+	// Sequence number of the last event
+	seq uint64
+	// Ring of the latest events, the event with sequence number n at index (n-1) % size
+	history    []StreamEvent
+	bufferSize int
+	clients    map[uint]map[chan StreamEvent]struct{}
+}
+
+// NewEventStream creates an event stream keeping the latest historySize events, and
+// queuing bufferSize events per client. Clients falling behind are disconnected.
+func NewEventStream(historySize, bufferSize int) EventStream {
+	return &eventStream{
+		epoch:      utils.RandToken(4),
+		history:    make([]StreamEvent, 0, historySize),
+		bufferSize: bufferSize,
+		clients:    make(map[uint]map[chan StreamEvent]struct{}),
+	}
+}
+
+// Handle records the file event and pushes it to the clients of its user, without blocking.
+func (s *eventStream) Handle(event dto.Event) {
+	if !streamedEvents[event.Type] {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	e := StreamEvent{
+		ID:    fmt.Sprintf("%s-%d", s.epoch, s.seq),
+		Event: event,
+	}
+	if len(s.history) < cap(s.history) {
+		s.history = append(s.history, e)
+	} else if cap(s.history) > 0 {
+		s.history[(s.seq-1)%uint64(cap(s.history))] = e
+	}
+
+	for ch := range s.clients[event.UserID] {
+		select {
+		case ch <- e:
+		default:
+			// The client resumes from its last event once reconnected
+			s.remove(event.UserID, ch)
+		}
+	}
+}
+
+// Subscribe registers a client of the user, returning the events of the user
+// following the given last event ID, if any.
+func (s *eventStream) Subscribe(userID uint, lastEventID string) *Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := &Subscription{}
+	if lastEventID != "" {
+		sub.Backlog, sub.Resync = s.since(userID, lastEventID)
+	}
+
+	ch := make(chan StreamEvent, s.bufferSize)
+	if s.clients[userID] == nil {
+		s.clients[userID] = make(map[chan StreamEvent]struct{})
+	}
+	s.clients[userID][ch] = struct{}{}
+	sub.C = ch
+	sub.close = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.remove(userID, ch)
+	}
+
+	return sub
+}
+
+// since returns the events of the user following the given event ID,
+// or whether they cannot be told apart any more.
+func (s *eventStream) since(userID uint, lastEventID string) ([]StreamEvent, bool) {
+	epoch, rawSeq, ok := strings.Cut(lastEventID, "-")
+	if !ok || epoch != s.epoch {
+		return nil, true
+	}
+	last, err := strconv.ParseUint(rawSeq, 10, 64)
+	if err != nil || last > s.seq {
+		return nil, true
+	}
+
+	size := uint64(cap(s.history))
+	if s.seq-last > size {
+		return nil, true
+	}
+
+	var events []StreamEvent
+	for n := last + 1; n <= s.seq; n++ {
+		e := s.history[(n-1)%size]
+		if e.Event.UserID == userID {
+			events = append(events, e)
+		}
+	}
+	return events, false
+}
+
+// remove unregisters and closes the channel of a client, if not done yet. It must be called with the lock held.
+func (s *eventStream) remove(userID uint, ch chan StreamEvent) {
+	if _, ok := s.clients[userID][ch]; !ok {
+		return
+	}
+	delete(s.clients[userID], ch)
+	if len(s.clients[userID]) == 0 {
+		delete(s.clients, userID)
+	}
+	close(ch)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"dryve/pkg/dto"
+	"fmt"
+	"testing"
+)
+
+func TestEventStreamResume(t *testing.T) {
+	s := NewEventStream(4, 8).(*eventStream)
+	// Events 1 to 6 alternate between the users 1 and 2, only 3 to 6 are kept
+	for i := 1; i <= 6; i++ {
+		s.Handle(dto.Event{ID: fmt.Sprint(i), Type: EventFileUploaded, UserID: uint(2 - i%2)})
+	}
+	s.Handle(dto.Event{Type: EventFileDownloaded, UserID: 1})
+
+	id := func(seq int) string { return fmt.Sprintf("%s-%d", s.epoch, seq) }
+	tests := []struct {
+		name        string
+		lastEventID string
+		wantBacklog []string
+		wantResync  bool
+	}{
+		{"new client", "", nil, false},
+		{"up to date", id(6), nil, false},
+		{"within the history", id(3), []string{"5"}, false},
+		{"just before the history", id(2), []string{"3", "5"}, false},
+		{"past the history", id(1), nil, true},
+		{"previous run", "0000-5", nil, true},
+		{"malformed", "garbage", nil, true},
+		{"from the future", id(9), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := s.Subscribe(1, tt.lastEventID)
+			defer sub.Close()
+
+			var backlog []string
+			for _, e := range sub.Backlog {
+				backlog = append(backlog, e.Event.ID)
+			}
+			if fmt.Sprint(backlog) != fmt.Sprint(tt.wantBacklog) {
+				t.Errorf("Backlog = %v, want %v", backlog, tt.wantBacklog)
+			}
+			if sub.Resync != tt.wantResync {
+				t.Errorf("Resync = %v, want %v", sub.Resync, tt.wantResync)
+			}
+		})
+	}
+}
+
+func TestEventStreamDelivery(t *testing.T) {
+	s := NewEventStream(16, 2)
+	sub := s.Subscribe(1, "")
+	other := s.Subscribe(2, "")
+	defer other.Close()
+
+	s.Handle(dto.Event{ID: "a", Type: EventFileUpdated, UserID: 1})
+	if e := <-sub.C; e.Event.ID != "a" {
+		t.Errorf("received event %q, want %q", e.Event.ID, "a")
+	}
+	if len(other.C) != 0 {
+		t.Errorf("event delivered to another user")
+	}
+
+	// A client falling behind is disconnected, resuming from its last event
+	for i := 0; i < 3; i++ {
+		s.Handle(dto.Event{Type: EventFileDeleted, UserID: 1})
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("received %d events before the disconnection, want 2", n)
+	}
+	sub.Close()
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Number of idle files listed per batch by the tiering mover.
+const tieringBatchSize = 100
+
+type TieringWorker interface {
+	Run(ctx context.Context)
+}
+
+// Default tieringWorker implementing TieringWorker
+type tieringWorker struct {
+	dao      repository.DAO
+	storage  StoragePool
+	interval time.Duration
+}
+
+// NewTieringWorker creates a worker demoting the idle files to the slower tiers of the
+// storage pool. Files are promoted back to the first tier on access by the FileService.
+func NewTieringWorker(dao repository.DAO, storage StoragePool, interval time.Duration) TieringWorker {
+	return &tieringWorker{
+		dao:      dao,
+		storage:  storage,
+		interval: interval,
+	}
+}
+
+// Run demotes the idle files every interval until the context is done.
+func (w *tieringWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.demote()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// demote moves the files of each tier not accessed for its number of days to the next tier.
+// Files failing to be moved are retried on the next run.
+func (w *tieringWorker) demote() {
+	tiers := w.storage.Tiers()
+	for i := 0; i < len(tiers)-1; i++ {
+		if tiers[i].DemoteAfterDays <= 0 {
+			continue
+		}
+		volumes := w.storage.TierVolumes(tiers[i].Name)
+		if len(volumes) == 0 {
+			continue
+		}
+		before := time.Now().AddDate(0, 0, -tiers[i].DemoteAfterDays)
+
+		var demoted int
+		var afterID uint
+	batches:
+		for {
+			files, err := w.dao.NewFileQuery().ListIdle(volumes, before, afterID, tieringBatchSize)
+			if err != nil {
+				logrus.Errorf("cannot list idle files of tier %s: %v", tiers[i].Name, err)
+				break
+			}
+			if len(files) == 0 {
+				break
+			}
+
+			for _, file := range files {
+				afterID = file.ID
+				// The scan may still quarantine the blob
+				if file.ScanStatus == datastruct.ScanPending {
+					continue
+				}
+				err := w.storage.Move(file, tiers[i+1].Name)
+				if err == ErrStorageFull {
+					logrus.Errorf("cannot demote files to tier %s: %v", tiers[i+1].Name, err)
+					break batches
+				}
+				if err != nil {
+					logrus.Errorf("cannot demote blob %s to tier %s: %v", file.Filename, tiers[i+1].Name, err)
+					continue
+				}
+				demoted++
+			}
+		}
+
+		if demoted > 0 {
+			logrus.Infof("demoted %d files from tier %s to %s", demoted, tiers[i].Name, tiers[i+1].Name)
+		}
+	}
+}
@@ -2,25 +2,54 @@ package service
 
 import (
 	"dryve/internal/datastruct"
-	"dryve/internal/dto"
 	"dryve/internal/repository"
 	"dryve/internal/utils"
+	"dryve/pkg/dto"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
+var ErrTokenNotFound = fmt.Errorf("token not found")
+var ErrAccessKeyNotFound = fmt.Errorf("access key not found")
+
+// Number of random bytes of the temporary passwords set by admins
+const tempPasswordBytes = 8
+
 type UserService interface {
 	GetUser(id uint) (*datastruct.User, error)
 	GetUserByEmail(email string) (*datastruct.User, error)
 	CreateUser(dto.RegisterRequest) (*datastruct.User, error)
 	SetEmailConfirmationCode(userId uint) (string, error)
 	VerifyUser(userId uint) error
+	SetLegalHold(userId uint, hold bool) error
+	SetDeletion(userId uint, deleteAt *time.Time) (*datastruct.User, error)
+	SetDisabled(userId uint, disabled bool) (*datastruct.User, error)
+	SetRole(userId uint, role datastruct.Role) (*datastruct.User, error)
+	ResetPassword(userId uint) (*datastruct.User, string, error)
+	SearchUsers(filter repository.UserFilter, offset, limit int) ([]datastruct.User, int64, error)
+	GetUsage(userIds []uint) (map[uint]repository.UserUsage, error)
+	SetImagePrivacy(userId uint, scrub, keepOriginal *bool) (*datastruct.User, error)
+	CreateAppToken(userId uint, name string) (datastruct.AppToken, string, error)
+	ListAppTokens(userId uint) ([]datastruct.AppToken, error)
+	DeleteAppToken(userId uint, id uint) error
+	VerifyAppToken(userId uint, token string) bool
+	CreateAccessKey(userId uint) (datastruct.AccessKey, error)
+	ListAccessKeys(userId uint) ([]datastruct.AccessKey, error)
+	DeleteAccessKey(userId uint, id uint) error
+	GetAccessKey(keyID string) (datastruct.AccessKey, error)
 }
 
 type userService struct {
-	dao repository.DAO
+	dao    repository.DAO
+	events EventBus
 }
 
-func NewUserService(dao repository.DAO) UserService {
-	return &userService{dao: dao}
+func NewUserService(dao repository.DAO, events EventBus) UserService {
+	return &userService{dao: dao, events: events}
 }
 
 func (s *userService) GetUser(id uint) (*datastruct.User, error) {
@@ -53,5 +82,166 @@ func (s *userService) VerifyUser(userId uint) error {
 	}
 	user.Verified = true
 	err = s.dao.NewUserQuery().UpdateUser(user)
+	if err != nil {
+		return err
+	}
+
+	s.events.Publish(newEvent(EventUserVerified, user.ID, dto.UserEventData{
+		ID:    user.ID,
+		Email: user.Email,
+	}))
+	return nil
+}
+
+func (s *userService) SetLegalHold(userId uint, hold bool) error {
+	user, err := s.dao.NewUserQuery().GetUser(userId)
+	if err != nil {
+		return err
+	}
+	user.LegalHold = hold
+	err = s.dao.NewUserQuery().UpdateUser(user)
 	return err
 }
+
+// SetDeletion schedules the deletion of the account of the user at the given time, or cancels it if nil.
+func (s *userService) SetDeletion(userId uint, deleteAt *time.Time) (*datastruct.User, error) {
+	user, err := s.dao.NewUserQuery().GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	user.DeleteAt = deleteAt
+	err = s.dao.NewUserQuery().UpdateUser(user)
+	return user, err
+}
+
+func (s *userService) SetDisabled(userId uint, disabled bool) (*datastruct.User, error) {
+	user, err := s.dao.NewUserQuery().GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	user.Disabled = disabled
+	err = s.dao.NewUserQuery().UpdateUser(user)
+	return user, err
+}
+
+func (s *userService) SetRole(userId uint, role datastruct.Role) (*datastruct.User, error) {
+	user, err := s.dao.NewUserQuery().GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	user.Role = role
+	err = s.dao.NewUserQuery().UpdateUser(user)
+	return user, err
+}
+
+// ResetPassword replaces the password of the user with a random temporary one, returned to be sent to the user.
+func (s *userService) ResetPassword(userId uint) (*datastruct.User, string, error) {
+	user, err := s.dao.NewUserQuery().GetUser(userId)
+	if err != nil {
+		return nil, "", err
+	}
+	password := utils.RandToken(tempPasswordBytes)
+	user.Password = utils.HashAndSaltPassword(password)
+	err = s.dao.NewUserQuery().UpdateUser(user)
+	return user, password, err
+}
+
+func (s *userService) SearchUsers(filter repository.UserFilter, offset, limit int) ([]datastruct.User, int64, error) {
+	return s.dao.NewUserQuery().Search(filter, offset, limit)
+}
+
+// GetUsage returns the storage used by each of the given users, zero for those without files.
+func (s *userService) GetUsage(userIds []uint) (map[uint]repository.UserUsage, error) {
+	if len(userIds) == 0 {
+		return map[uint]repository.UserUsage{}, nil
+	}
+	return s.dao.NewUserQuery().Usage(userIds)
+}
+
+// SetImagePrivacy sets whether the metadata of the images uploaded by the user is removed
+// and their original kept. Nil settings fall back to the server defaults.
+func (s *userService) SetImagePrivacy(userId uint, scrub, keepOriginal *bool) (*datastruct.User, error) {
+	user, err := s.dao.NewUserQuery().GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	user.ScrubImageMetadata = scrub
+	user.KeepImageOriginal = keepOriginal
+	err = s.dao.NewUserQuery().UpdateUser(user)
+	return user, err
+}
+
+// CreateAppToken creates an app token for the user, returning its value which is never stored.
+func (s *userService) CreateAppToken(userId uint, name string) (datastruct.AppToken, string, error) {
+	token := utils.RandToken(32)
+	appToken, err := s.dao.NewTokenQuery().Create(datastruct.AppToken{
+		UserID: userId,
+		Name:   name,
+		Hash:   utils.HashToken(token),
+	})
+	return appToken, token, err
+}
+
+func (s *userService) ListAppTokens(userId uint) ([]datastruct.AppToken, error) {
+	return s.dao.NewTokenQuery().ListByUser(userId)
+}
+
+func (s *userService) DeleteAppToken(userId uint, id uint) error {
+	deleted, err := s.dao.NewTokenQuery().Delete(userId, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// VerifyAppToken reports whether the token is an app token of the user, recording its use.
+func (s *userService) VerifyAppToken(userId uint, token string) bool {
+	appToken, err := s.dao.NewTokenQuery().GetByHash(utils.HashToken(token))
+	if err != nil || appToken.UserID != userId {
+		if err != nil && err != gorm.ErrRecordNotFound {
+			logrus.Errorf("cannot get app token: %v", err)
+		}
+		return false
+	}
+
+	if err := s.dao.NewTokenQuery().Touch(appToken.ID, time.Now()); err != nil {
+		logrus.Errorf("cannot record use of app token %d: %v", appToken.ID, err)
+	}
+	return true
+}
+
+// CreateAccessKey creates an S3 access key for the user.
+func (s *userService) CreateAccessKey(userId uint) (datastruct.AccessKey, error) {
+	return s.dao.NewAccessKeyQuery().Create(datastruct.AccessKey{
+		UserID: userId,
+		KeyID:  "DK" + strings.ToUpper(utils.RandToken(9)),
+		Secret: utils.RandToken(20),
+	})
+}
+
+func (s *userService) ListAccessKeys(userId uint) ([]datastruct.AccessKey, error) {
+	return s.dao.NewAccessKeyQuery().ListByUser(userId)
+}
+
+func (s *userService) DeleteAccessKey(userId uint, id uint) error {
+	deleted, err := s.dao.NewAccessKeyQuery().Delete(userId, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrAccessKeyNotFound
+	}
+	return nil
+}
+
+// GetAccessKey returns the access key with the given public key ID.
+func (s *userService) GetAccessKey(keyID string) (datastruct.AccessKey, error) {
+	key, err := s.dao.NewAccessKeyQuery().GetByKeyID(keyID)
+	if err == gorm.ErrRecordNotFound {
+		return key, ErrAccessKeyNotFound
+	}
+	return key, err
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"dryve/internal/datastruct"
+	"dryve/internal/repository"
+	"dryve/internal/utils"
+	"dryve/pkg/dto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrWebhookNotFound = fmt.Errorf("webhook not found")
+var ErrWebhookBadRequest = fmt.Errorf("bad webhook request")
+var ErrWebhookInternal = fmt.Errorf("webhook processing error")
+
+const (
+	// Upper bound for the backoff between two delivery attempts.
+	maxDeliveryBackoff = 1 * time.Hour
+	// Max number of deliveries sent by the worker per run.
+	deliveryBatchSize = 50
+	// Max number of deliveries listed in the delivery log.
+	deliveryLogSize = 100
+)
+
+type WebhookService interface {
+	Create(userID uint, rawURL string, events []string) (datastruct.Webhook, error)
+	Get(id uint) (datastruct.Webhook, error)
+	List(userID uint) ([]datastruct.Webhook, error)
+	Delete(webhook datastruct.Webhook) error
+	ListDeliveries(webhook datastruct.Webhook) ([]datastruct.WebhookDelivery, error)
+	Redeliver(webhook datastruct.Webhook, deliveryID uint) (datastruct.WebhookDelivery, error)
+	Handle(event dto.Event)
+	Run(ctx context.Context)
+}
+
+type webhookService struct {
+	dao         repository.DAO
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+}
+
+// NewWebhookService creates a webhook service delivering events every interval,
+// giving up on a delivery after maxAttempts failed attempts.
+// Like imports, deliveries only connect to public addresses.
+func NewWebhookService(dao repository.DAO, timeout, interval time.Duration, maxAttempts int) WebhookService {
+	client := newImportClient(0, timeout, utils.IsPublicIP)
+	// Redirects are not followed, the deliveries failing with the redirect status
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &webhookService{
+		dao:         dao,
+		client:      client,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Create registers a webhook for the user with a newly generated signing secret.
+func (s *webhookService) Create(userID uint, rawURL string, events []string) (datastruct.Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return datastruct.Webhook{}, ErrWebhookBadRequest
+	}
+	// Forbidden literal addresses are rejected at once, the others once resolved
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !utils.IsPublicIP(addr) {
+		return datastruct.Webhook{}, ErrWebhookBadRequest
+	}
+	if len(events) == 0 {
+		return datastruct.Webhook{}, ErrWebhookBadRequest
+	}
+	for _, e := range events {
+		if !isEventType(e) {
+			return datastruct.Webhook{}, ErrWebhookBadRequest
+		}
+	}
+
+	webhook, err := s.dao.NewWebhookQuery().Create(datastruct.Webhook{
+		UserID: userID,
+		URL:    u.String(),
+		Secret: utils.RandToken(32),
+		Events: strings.Join(events, ","),
+	})
+	if err != nil {
+		return webhook, ErrWebhookInternal
+	}
+
+	return webhook, nil
+}
+
+func (s *webhookService) Get(id uint) (datastruct.Webhook, error) {
+	webhook, err := s.dao.NewWebhookQuery().Get(id)
+	if err == gorm.ErrRecordNotFound {
+		return webhook, ErrWebhookNotFound
+	}
+	if err != nil {
+		return webhook, ErrWebhookInternal
+	}
+
+	return webhook, nil
+}
+
+func (s *webhookService) List(userID uint) ([]datastruct.Webhook, error) {
+	webhooks, err := s.dao.NewWebhookQuery().ListByUser(userID)
+	if err != nil {
+		return nil, ErrWebhookInternal
+	}
+
+	return webhooks, nil
+}
+
+func (s *webhookService) Delete(webhook datastruct.Webhook) error {
+	if err := s.dao.NewWebhookQuery().Delete(webhook.ID); err != nil {
+		return ErrWebhookInternal
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the latest deliveries of the webhook, newest first.
+func (s *webhookService) ListDeliveries(webhook datastruct.Webhook) ([]datastruct.WebhookDelivery, error) {
+	deliveries, err := s.dao.NewWebhookQuery().ListDeliveries(webhook.ID, deliveryLogSize)
+	if err != nil {
+		return nil, ErrWebhookInternal
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver schedules a new delivery of the same payload of a past one.
+func (s *webhookService) Redeliver(webhook datastruct.Webhook, deliveryID uint) (datastruct.WebhookDelivery, error) {
+	past, err := s.dao.NewWebhookQuery().GetDelivery(deliveryID)
+	if err == gorm.ErrRecordNotFound || (err == nil && past.WebhookID != webhook.ID) {
+		return past, ErrWebhookNotFound
+	}
+	if err != nil {
+		return past, ErrWebhookInternal
+	}
+
+	delivery, err := s.dao.NewWebhookQuery().CreateDelivery(datastruct.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		EventID:       past.EventID,
+		Event:         past.Event,
+		Payload:       past.Payload,
+		Status:        datastruct.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	})
+	if err != nil {
+		return delivery, ErrWebhookInternal
+	}
+
+	return delivery, nil
+}
+
+// Handle schedules the delivery of the event to the subscribed webhooks of its user.
+func (s *webhookService) Handle(event dto.Event) {
+	if event.UserID == 0 {
+		return
+	}
+
+	webhooks, err := s.dao.NewWebhookQuery().ListByUser(event.UserID)
+	if err != nil {
+		logrus.Errorf("cannot list webhooks of user %d: %v", event.UserID, err)
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logrus.Errorf("cannot encode event %s: %v", event.ID, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event.Type) {
+			continue
+		}
+		_, err := s.dao.NewWebhookQuery().CreateDelivery(datastruct.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			Event:         event.Type,
+			Payload:       string(payload),
+			Status:        datastruct.DeliveryPending,
+			NextAttemptAt: event.Time,
+		})
+		if err != nil {
+			logrus.Errorf("cannot schedule delivery of event %s to webhook %d: %v", event.ID, webhook.ID, err)
+		}
+	}
+}
+
+// Run sends the due deliveries every interval until the context is done.
+func (s *webhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.deliver(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends a batch of due deliveries, rescheduling the failed ones.
+func (s *webhookService) deliver(ctx context.Context) {
+	now := time.Now()
+	deliveries, err := s.dao.NewWebhookQuery().ListDueDeliveries(now, deliveryBatchSize)
+	if err != nil {
+		logrus.Errorf("cannot list due webhook deliveries: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		webhook, err := s.dao.NewWebhookQuery().Get(delivery.WebhookID)
+		if err == nil {
+			delivery.ResponseStatus, err = s.send(ctx, webhook, delivery)
+		}
+
+		if err == nil {
+			delivered := time.Now()
+			delivery.Status = datastruct.DeliveryDelivered
+			delivery.DeliveredAt = &delivered
+			delivery.LastError = ""
+		} else {
+			delivery.Attempts++
+			delivery.LastError = err.Error()
+			delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts, maxDeliveryBackoff))
+			// Deliveries to deleted webhooks are not retried
+			if delivery.Attempts >= s.maxAttempts || err == gorm.ErrRecordNotFound {
+				delivery.Status = datastruct.DeliveryFailed
+			}
+		}
+
+		if err := s.dao.NewWebhookQuery().UpdateDelivery(delivery); err != nil {
+			logrus.Errorf("cannot update webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+}
+
+// send posts the signed payload to the webhook, any non 2xx response is a failure.
+func (s *webhookService) send(ctx context.Context, webhook datastruct.Webhook, delivery datastruct.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dryve-webhooks")
+	req.Header.Set("X-Dryve-Event", delivery.Event)
+	req.Header.Set("X-Dryve-Delivery", delivery.EventID)
+	req.Header.Set("X-Dryve-Signature", "sha256="+utils.SignHMAC([]byte(webhook.Secret), []byte(delivery.Payload)))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+func isEventType(eventType string) bool {
+	for _, e := range EventTypes {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -22,7 +22,8 @@ type JWTClaims struct {
 
 // generateJWT generates a signed JWT using the given key and
 // sets the claims for this server and the given user.
-func GenerateJWT(config config.JWTConfig, user datastruct.User) (string, error) {
+// The claims are returned along with it, their ID (jti) allows revoking the token.
+func GenerateJWT(config config.JWTConfig, user datastruct.User) (string, *JWTClaims, error) {
 
 	claims := &JWTClaims{
 		user.ID,
@@ -39,7 +40,12 @@ func GenerateJWT(config config.JWTConfig, user datastruct.User) (string, error)
 	// SigningMethodHS256 is a specific instance of SigningMethodHMAC
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString([]byte(config.Key))
+	signed, err := token.SignedString([]byte(config.Key))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, claims, nil
 }
 
 // extractJWT tries to retreive the token string from the
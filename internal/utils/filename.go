@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Max length in bytes of a file name, as on most filesystems.
+const MaxFilenameLength = 255
+
+// Name of the files whose name is empty once normalized.
+const defaultFilename = "unnamed"
+
+// NormalizeFilename returns the name in Unicode NFC, without control or formatting
+// characters (e.g. the right-to-left override), path separators replaced, surrounding
+// spaces trimmed and truncated to MaxFilenameLength bytes, keeping the extension.
+func NormalizeFilename(name string) string {
+	name = norm.NFC.String(strings.ToValidUTF8(name, ""))
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '_'
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	if len(name) > MaxFilenameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > MaxFilenameLength/4 {
+			ext = ""
+		}
+		name = truncateUTF8(strings.TrimSuffix(name, ext), MaxFilenameLength-len(ext)) + ext
+	}
+
+	if name == "" || name == "." || name == ".." {
+		return defaultFilename
+	}
+	return name
+}
+
+// truncateUTF8 truncates the string to at most n bytes, without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// DetectContentType returns the MIME type of a file from the extension of its name,
+// or from the first 512 bytes of its content when the extension is unknown.
+func DetectContentType(name string, head []byte) string {
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); t != "" {
+		return t
+	}
+	if len(head) == 0 {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(head)
+}
+
+// IsInlineSafe reports whether content of the MIME type can be displayed by browsers
+// without running scripts, unlike HTML or SVG. Other content is only downloaded.
+func IsInlineSafe(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "application/pdf", "text/plain",
+		"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif", "image/bmp":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/")
+}
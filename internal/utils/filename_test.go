@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeFilename(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	longUnicode := strings.Repeat("é", 200)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain name", "report.pdf", "report.pdf"},
+		{"spaces kept", "my report.pdf", "my report.pdf"},
+		{"decomposed to NFC", "cafe\u0301.txt", "caf\u00e9.txt"},
+		{"control characters", "evil\r\nSet-Cookie: a=b.txt", "evilSet-Cookie: a=b.txt"},
+		{"right-to-left override", "invoice\u202efdp.exe", "invoicefdp.exe"},
+		{"path separators", "../../etc/passwd", ".._.._etc_passwd"},
+		{"windows separators", "..\\boot.ini", ".._boot.ini"},
+		{"surrounding spaces", "  notes.txt \t", "notes.txt"},
+		{"invalid UTF-8", "bad\xffname.txt", "badname.txt"},
+		{"empty", "", "unnamed"},
+		{"only controls", "\x00\x01", "unnamed"},
+		{"dot dot", "..", "unnamed"},
+		{"too long", long + ".txt", long[:MaxFilenameLength-4] + ".txt"},
+		{"too long without splitting characters", longUnicode + ".txt", strings.Repeat("é", 125) + ".txt"},
+		{"too long extension", "a." + long, ("a." + long)[:MaxFilenameLength]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeFilename(tt.in); got != tt.want {
+				t.Errorf("NormalizeFilename(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		head     []byte
+		want     string
+	}{
+		{"by extension", "photo.JPG", nil, "image/jpeg"},
+		{"pdf", "doc.pdf", nil, "application/pdf"},
+		{"extension wins over content", "page.png", []byte("<html><script>"), "image/png"},
+		{"sniffed without extension", "photo", []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+		{"unknown", "data", []byte{0, 1, 2}, "application/octet-stream"},
+		{"no content", "data", nil, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectContentType(tt.filename, tt.head); got != tt.want {
+				t.Errorf("DetectContentType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsInlineSafe(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/pdf", true},
+		{"image/png", true},
+		{"text/plain; charset=utf-8", true},
+		{"video/mp4", true},
+		{"text/html; charset=utf-8", false},
+		{"image/svg+xml", false},
+		{"application/xhtml+xml", false},
+		{"application/octet-stream", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := IsInlineSafe(tt.contentType); got != tt.want {
+				t.Errorf("IsInlineSafe(%q) = %v, want %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// Kinds of metadata removed from the images.
+const (
+	MetadataEXIF = "exif"
+	MetadataGPS  = "gps"
+	MetadataXMP  = "xmp"
+	MetadataIPTC = "iptc"
+)
+
+var ErrImageMalformed = errors.New("malformed image")
+var ErrImageUnsupported = errors.New("unsupported image format")
+
+var jpegMagic = []byte{0xFF, 0xD8, 0xFF}
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+// JPEG markers.
+const (
+	jpegSOI   = 0xD8
+	jpegEOI   = 0xD9
+	jpegSOS   = 0xDA
+	jpegAPP1  = 0xE1
+	jpegAPP13 = 0xED
+)
+
+var (
+	exifSignature      = []byte("Exif\x00\x00")
+	xmpSignature       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtSignature    = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	photoshopSignature = []byte("Photoshop 3.0\x00")
+)
+
+// Max size of the PNG eXIf chunks inspected for GPS tags.
+const maxPNGChunkInspected = 1 << 20
+
+// TIFF tags of the EXIF IFD0.
+const (
+	tiffOrientation = 0x0112
+	tiffGPSInfo     = 0x8825
+)
+
+// IsScrubbableImage reports whether the content starting with head is a JPEG or PNG image.
+func IsScrubbableImage(head []byte) bool {
+	return bytes.HasPrefix(head, jpegMagic) || bytes.HasPrefix(head, pngMagic)
+}
+
+// ScrubImageMetadata copies the JPEG or PNG image read from src to dst without its
+// EXIF (including GPS), XMP and IPTC metadata, and returns the kinds removed.
+// The orientation of JPEG images is kept, as they would be displayed rotated otherwise.
+func ScrubImageMetadata(dst io.Writer, src io.Reader) ([]string, error) {
+	r := bufio.NewReader(src)
+	head, err := r.Peek(len(pngMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	removed := map[string]bool{}
+	switch {
+	case bytes.HasPrefix(head, jpegMagic):
+		err = scrubJPEG(dst, r, removed)
+	case bytes.HasPrefix(head, pngMagic):
+		err = scrubPNG(dst, r, removed)
+	default:
+		err = ErrImageUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := make([]string, 0, len(removed))
+	for kind := range removed {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds, nil
+}
+
+// scrubJPEG drops the metadata segments preceding the image data, which is copied as is.
+func scrubJPEG(dst io.Writer, r *bufio.Reader, removed map[string]bool) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi[1] != jpegSOI {
+		return ErrImageMalformed
+	}
+	if _, err := dst.Write(soi[:]); err != nil {
+		return err
+	}
+
+	for {
+		marker, err := readJPEGMarker(r)
+		if err != nil {
+			return err
+		}
+		if marker == jpegEOI {
+			_, err := dst.Write([]byte{0xFF, marker})
+			return err
+		}
+		// Standalone markers without length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			if _, err := dst.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return ErrImageMalformed
+		}
+		n := int(binary.BigEndian.Uint16(length[:]))
+		if n < 2 {
+			return ErrImageMalformed
+		}
+		payload := make([]byte, n-2)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return ErrImageMalformed
+		}
+
+		keep := true
+		var replacement []byte
+		switch {
+		case marker == jpegAPP1 && bytes.HasPrefix(payload, exifSignature):
+			keep = false
+			removed[MetadataEXIF] = true
+			tiff := payload[len(exifSignature):]
+			if _, ok := tiffTag(tiff, tiffGPSInfo); ok {
+				removed[MetadataGPS] = true
+			}
+			if orientation, ok := tiffTag(tiff, tiffOrientation); ok && orientation > 1 && orientation <= 8 {
+				replacement = orientationEXIF(uint16(orientation))
+			}
+		case marker == jpegAPP1 && (bytes.HasPrefix(payload, xmpSignature) || bytes.HasPrefix(payload, xmpExtSignature)):
+			keep = false
+			removed[MetadataXMP] = true
+		case marker == jpegAPP13 && bytes.HasPrefix(payload, photoshopSignature):
+			keep = false
+			removed[MetadataIPTC] = true
+		}
+
+		if keep {
+			if err := writeJPEGSegment(dst, marker, payload); err != nil {
+				return err
+			}
+		} else if replacement != nil {
+			if err := writeJPEGSegment(dst, jpegAPP1, replacement); err != nil {
+				return err
+			}
+		}
+
+		// The entropy coded data follows the start of scan, metadata comes before it
+		if marker == jpegSOS {
+			_, err := io.Copy(dst, r)
+			return err
+		}
+	}
+}
+
+// readJPEGMarker reads the next marker, skipping the fill bytes.
+func readJPEGMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil || b != 0xFF {
+		return 0, ErrImageMalformed
+	}
+	for {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, ErrImageMalformed
+		}
+		if b != 0xFF {
+			return b, nil
+		}
+	}
+}
+
+func writeJPEGSegment(dst io.Writer, marker byte, payload []byte) error {
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	_, err := dst.Write(payload)
+	return err
+}
+
+// orientationEXIF returns an EXIF payload holding only the orientation tag.
+func orientationEXIF(orientation uint16) []byte {
+	b := append([]byte{}, exifSignature...)
+	b = append(b, 'M', 'M', 0, 42, 0, 0, 0, 8)  // big endian TIFF header, IFD0 at 8
+	b = append(b, 0, 1)                         // one entry
+	b = append(b, 0x01, 0x12, 0, 3, 0, 0, 0, 1) // orientation, SHORT, count 1
+	b = append(b, byte(orientation>>8), byte(orientation), 0, 0)
+	return append(b, 0, 0, 0, 0) // no next IFD
+}
+
+// tiffTag returns the value of the SHORT or LONG tag of the IFD0 of the TIFF data.
+func tiffTag(tiff []byte, tag uint16) (uint32, bool) {
+	if len(tiff) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) != tag {
+			continue
+		}
+		switch order.Uint16(tiff[entry+2:]) {
+		case 3: // SHORT
+			return uint32(order.Uint16(tiff[entry+8:])), true
+		case 4: // LONG
+			return order.Uint32(tiff[entry+8:]), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// scrubPNG drops the eXIf chunk and the text chunks holding metadata profiles, up to the IEND chunk.
+func scrubPNG(dst io.Writer, r *bufio.Reader, removed map[string]bool) error {
+	signature := make([]byte, len(pngMagic))
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return ErrImageMalformed
+	}
+	if _, err := dst.Write(signature); err != nil {
+		return err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return ErrImageMalformed
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:])
+		if length > 1<<31-1 {
+			return ErrImageMalformed
+		}
+
+		kind := ""
+		var inspected []byte
+		switch chunkType {
+		case "eXIf":
+			kind = MetadataEXIF
+			if length <= int64(maxPNGChunkInspected) {
+				inspected = make([]byte, length)
+				if _, err := io.ReadFull(r, inspected); err != nil {
+					return ErrImageMalformed
+				}
+				if _, ok := tiffTag(inspected, tiffGPSInfo); ok {
+					removed[MetadataGPS] = true
+				}
+			}
+		case "tEXt", "zTXt", "iTXt":
+			// The keyword comes first, null terminated and at most 79 bytes long
+			n := length
+			if n > 80 {
+				n = 80
+			}
+			inspected = make([]byte, n)
+			if _, err := io.ReadFull(r, inspected); err != nil {
+				return ErrImageMalformed
+			}
+			keyword, _, _ := bytes.Cut(inspected, []byte{0})
+			kind = pngTextMetadata(string(keyword))
+		}
+
+		rest := length - int64(len(inspected)) + 4 // data left and CRC
+		if kind != "" {
+			removed[kind] = true
+			if _, err := io.CopyN(io.Discard, r, rest); err != nil {
+				return ErrImageMalformed
+			}
+			continue
+		}
+
+		if _, err := dst.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := dst.Write(inspected); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(dst, r, rest); err != nil {
+			return ErrImageMalformed
+		}
+		// Anything after the end of the image is dropped
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
+
+// pngTextMetadata returns the kind of metadata held by a text chunk with the keyword, if any.
+func pngTextMetadata(keyword string) string {
+	switch keyword {
+	case "XML:com.adobe.xmp", "Raw profile type xmp":
+		return MetadataXMP
+	case "Raw profile type exif", "Raw profile type APP1":
+		return MetadataEXIF
+	case "Raw profile type iptc", "Raw profile type 8bim":
+		return MetadataIPTC
+	}
+	return ""
+}
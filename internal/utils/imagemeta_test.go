@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+// exifTIFF returns big endian TIFF data with the given IFD0 SHORT tags.
+func exifTIFF(tags map[uint16]uint16) []byte {
+	b := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, byte(len(tags))}
+	for tag, value := range tags {
+		b = append(b, byte(tag>>8), byte(tag), 0, 3, 0, 0, 0, 1, byte(value>>8), byte(value), 0, 0)
+	}
+	return append(b, 0, 0, 0, 0)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	b := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], uint16(len(payload)+2))
+	return append(b, payload...)
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	b := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(b, uint32(len(data)))
+	b = append(b, chunkType...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+func TestScrubImageMetadataJPEG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := encoded.Bytes()
+
+	withMetadata := func(segments ...[]byte) []byte {
+		b := append([]byte{}, plain[:2]...)
+		for _, segment := range segments {
+			b = append(b, segment...)
+		}
+		return append(b, plain[2:]...)
+	}
+	exif := func(tags map[uint16]uint16) []byte {
+		return jpegSegment(jpegAPP1, append(append([]byte{}, exifSignature...), exifTIFF(tags)...))
+	}
+	xmp := jpegSegment(jpegAPP1, append(append([]byte{}, xmpSignature...), "<x:xmpmeta/>"...))
+	iptc := jpegSegment(jpegAPP13, append(append([]byte{}, photoshopSignature...), "8BIM"...))
+
+	tests := []struct {
+		name        string
+		in          []byte
+		want        []byte
+		wantRemoved []string
+	}{
+		{"no metadata", plain, plain, []string{}},
+		{
+			name:        "exif with gps",
+			in:          withMetadata(exif(map[uint16]uint16{tiffGPSInfo: 26}), xmp, iptc),
+			want:        plain,
+			wantRemoved: []string{MetadataEXIF, MetadataGPS, MetadataIPTC, MetadataXMP},
+		},
+		{
+			name:        "orientation kept",
+			in:          withMetadata(exif(map[uint16]uint16{tiffOrientation: 6})),
+			want:        withMetadata(jpegSegment(jpegAPP1, orientationEXIF(6))),
+			wantRemoved: []string{MetadataEXIF},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			removed, err := ScrubImageMetadata(&out, bytes.NewReader(tt.in))
+			if err != nil {
+				t.Fatalf("ScrubImageMetadata() error = %v", err)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("ScrubImageMetadata() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			if !bytes.Equal(out.Bytes(), tt.want) {
+				t.Errorf("ScrubImageMetadata() output differs from the expected image")
+			}
+			if _, err := jpeg.Decode(&out); err != nil {
+				t.Errorf("scrubbed image does not decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestScrubImageMetadataPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	plain := encoded.Bytes()
+	// The signature and IHDR chunk come first
+	ihdrEnd := len(pngMagic) + 12 + 13
+
+	withChunks := func(chunks ...[]byte) []byte {
+		b := append([]byte{}, plain[:ihdrEnd]...)
+		for _, chunk := range chunks {
+			b = append(b, chunk...)
+		}
+		return append(b, plain[ihdrEnd:]...)
+	}
+	title := pngChunk("tEXt", []byte("Title\x00Holidays"))
+
+	tests := []struct {
+		name        string
+		in          []byte
+		want        []byte
+		wantRemoved []string
+	}{
+		{"no metadata", plain, plain, []string{}},
+		{
+			name: "exif and xmp",
+			in: withChunks(
+				pngChunk("eXIf", exifTIFF(map[uint16]uint16{tiffGPSInfo: 26})),
+				title,
+				pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>")),
+			),
+			want:        withChunks(title),
+			wantRemoved: []string{MetadataEXIF, MetadataGPS, MetadataXMP},
+		},
+		{
+			name:        "raw profile",
+			in:          withChunks(pngChunk("zTXt", []byte("Raw profile type exif\x00\x00compressed"))),
+			want:        plain,
+			wantRemoved: []string{MetadataEXIF},
+		},
+		{
+			name:        "data after the end",
+			in:          append(append([]byte{}, plain...), "trailing"...),
+			want:        plain,
+			wantRemoved: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			removed, err := ScrubImageMetadata(&out, bytes.NewReader(tt.in))
+			if err != nil {
+				t.Fatalf("ScrubImageMetadata() error = %v", err)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("ScrubImageMetadata() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			if !bytes.Equal(out.Bytes(), tt.want) {
+				t.Errorf("ScrubImageMetadata() output differs from the expected image")
+			}
+			if _, err := png.Decode(&out); err != nil {
+				t.Errorf("scrubbed image does not decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestScrubImageMetadataErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want error
+	}{
+		{"unsupported", []byte("GIF89a"), ErrImageUnsupported},
+		{"empty", nil, ErrImageUnsupported},
+		{"truncated jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x10, 0x00, 'E'}, ErrImageMalformed},
+		{"truncated png", append(append([]byte{}, pngMagic...), 0, 0, 0, 13, 'I', 'H'), ErrImageMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if _, err := ScrubImageMetadata(&out, bytes.NewReader(tt.in)); err != tt.want {
+				t.Errorf("ScrubImageMetadata() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+import "net/netip"
+
+// Special purpose ranges not reachable on the internet, besides those known by netip.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // this network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which may embed private IPv4 addresses
+	netip.MustParsePrefix("2002::/16"),     // 6to4, likewise
+}
+
+// IsPublicIP reports whether the address is a public unicast address, excluding the
+// loopback, private, link-local, multicast and other special purpose ranges.
+// IPv4-mapped IPv6 addresses are checked as their IPv4 address.
+func IsPublicIP(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
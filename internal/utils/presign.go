@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters of the presigned URLs.
+const (
+	presignExpires = "expires"
+	presignUser    = "user"
+	presignMaxSize = "max_size"
+	presignFolder  = "folder"
+	presignName    = "name"
+	presignSig     = "sig"
+)
+
+// PresignedURL holds the parameters bound to a presigned URL.
+type PresignedURL struct {
+	Method  string
+	Path    string
+	Expires time.Time
+	UserID  uint
+	// Max size of the uploaded content, zero if unbounded
+	MaxSize int64
+	// Folder and name of the uploaded file, any if empty
+	Folder string
+	Name   string
+}
+
+// Sign returns the query string of the presigned URL, signed with the given key.
+func (p PresignedURL) Sign(key []byte) string {
+	q := url.Values{}
+	q.Set(presignExpires, strconv.FormatInt(p.Expires.Unix(), 10))
+	q.Set(presignUser, strconv.FormatUint(uint64(p.UserID), 10))
+	if p.MaxSize > 0 {
+		q.Set(presignMaxSize, strconv.FormatInt(p.MaxSize, 10))
+	}
+	if p.Folder != "" {
+		q.Set(presignFolder, p.Folder)
+	}
+	if p.Name != "" {
+		q.Set(presignName, p.Name)
+	}
+	q.Set(presignSig, SignHMAC(key, []byte(p.canonical())))
+	return q.Encode()
+}
+
+// canonical returns the string covered by the signature. The upload location is only
+// covered when set, so the URLs signed without it, like the export links, remain valid.
+func (p PresignedURL) canonical() string {
+	parts := []string{
+		p.Method,
+		p.Path,
+		strconv.FormatInt(p.Expires.Unix(), 10),
+		strconv.FormatUint(uint64(p.UserID), 10),
+		strconv.FormatInt(p.MaxSize, 10),
+	}
+	if p.Folder != "" || p.Name != "" {
+		parts = append(parts, p.Folder, p.Name)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// VerifyPresignedURL checks the signature and the expiry of a presigned URL
+// requested with the given method and path, and returns its parameters.
+func VerifyPresignedURL(key []byte, method, path string, query url.Values, now time.Time) (PresignedURL, error) {
+	p := PresignedURL{
+		Method: method,
+		Path:   path,
+	}
+
+	expires, err := strconv.ParseInt(query.Get(presignExpires), 10, 64)
+	if err != nil {
+		return p, fmt.Errorf("invalid expiry")
+	}
+	p.Expires = time.Unix(expires, 0)
+
+	userID, err := strconv.ParseUint(query.Get(presignUser), 10, 32)
+	if err != nil {
+		return p, fmt.Errorf("invalid user")
+	}
+	p.UserID = uint(userID)
+
+	if maxSize := query.Get(presignMaxSize); maxSize != "" {
+		p.MaxSize, err = strconv.ParseInt(maxSize, 10, 64)
+		if err != nil || p.MaxSize <= 0 {
+			return p, fmt.Errorf("invalid max size")
+		}
+	}
+
+	p.Folder = query.Get(presignFolder)
+	p.Name = query.Get(presignName)
+
+	if !VerifyHMAC(key, []byte(p.canonical()), query.Get(presignSig)) {
+		return p, fmt.Errorf("invalid signature")
+	}
+	if !now.Before(p.Expires) {
+		return p, fmt.Errorf("expired")
+	}
+
+	return p, nil
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestVerifyPresignedURL(t *testing.T) {
+	key := []byte("secret")
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	download := PresignedURL{
+		Method:  "GET",
+		Path:    "/presigned/files/44fdac3e/download",
+		Expires: now.Add(time.Hour),
+		UserID:  1,
+	}
+	upload := PresignedURL{
+		Method:  "POST",
+		Path:    "/presigned/files",
+		Expires: now.Add(time.Hour),
+		UserID:  2,
+		MaxSize: 1024,
+		Folder:  "/photos",
+		Name:    "a.jpg",
+	}
+
+	tamper := func(query, param, value string) string {
+		q, _ := url.ParseQuery(query)
+		q.Set(param, value)
+		return q.Encode()
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		query   string
+		now     time.Time
+		want    PresignedURL
+		wantErr bool
+	}{
+		{
+			name:   "Valid download",
+			method: "GET",
+			path:   download.Path,
+			query:  download.Sign(key),
+			now:    now,
+			want:   download,
+		},
+		{
+			name:   "Valid upload",
+			method: "POST",
+			path:   upload.Path,
+			query:  upload.Sign(key),
+			now:    now,
+			want:   upload,
+		},
+		{
+			name:    "Expired",
+			method:  "GET",
+			path:    download.Path,
+			query:   download.Sign(key),
+			now:     now.Add(time.Hour),
+			wantErr: true,
+		},
+		{
+			name:    "Wrong method",
+			method:  "DELETE",
+			path:    download.Path,
+			query:   download.Sign(key),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "Other file",
+			method:  "GET",
+			path:    "/presigned/files/2b0f8f45/download",
+			query:   download.Sign(key),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "Wrong key",
+			method:  "GET",
+			path:    download.Path,
+			query:   download.Sign([]byte("other")),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "Extended expiry",
+			method:  "GET",
+			path:    download.Path,
+			query:   tamper(download.Sign(key), "expires", "9999999999"),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "Raised max size",
+			method:  "POST",
+			path:    upload.Path,
+			query:   tamper(upload.Sign(key), "max_size", "1048576"),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "Changed folder",
+			method:  "POST",
+			path:    upload.Path,
+			query:   tamper(upload.Sign(key), "folder", "/"),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "Changed name",
+			method:  "POST",
+			path:    upload.Path,
+			query:   tamper(upload.Sign(key), "name", "b.jpg"),
+			now:     now,
+			wantErr: true,
+		},
+		{
+			name:    "Missing signature",
+			method:  "GET",
+			path:    download.Path,
+			query:   "expires=9999999999&user=1",
+			now:     now,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := VerifyPresignedURL(key, tt.method, tt.path, query, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyPresignedURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Method != tt.want.Method || got.Path != tt.want.Path ||
+				!got.Expires.Equal(tt.want.Expires) || got.UserID != tt.want.UserID || got.MaxSize != tt.want.MaxSize ||
+				got.Folder != tt.want.Folder || got.Name != tt.want.Name) {
+				t.Errorf("VerifyPresignedURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
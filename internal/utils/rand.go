@@ -1,6 +1,8 @@
 package utils
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
 	"math/rand"
 )
 
@@ -13,3 +15,12 @@ func RandSeq(n int) string {
 	}
 	return string(b)
 }
+
+// RandToken returns a hex encoded cryptographically secure random token of n bytes.
+func RandToken(n int) string {
+	b := make([]byte, n)
+	if _, err := crand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -17,3 +17,19 @@ func TestRandSeq(t *testing.T) {
 		t.Errorf("RandSeq(%d) returned %d unique strings, want %d", 6, len(set), n)
 	}
 }
+
+func TestRandToken(t *testing.T) {
+	n := 100
+	set := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		s := RandToken(16)
+		if len(s) != 32 {
+			t.Errorf("RandToken(%d) returned string of length %d, want %d", 16, len(s), 32)
+		}
+		set[s] = true
+	}
+
+	if len(set) != n {
+		t.Errorf("RandToken(%d) returned %d unique strings, want %d", 16, len(set), n)
+	}
+}
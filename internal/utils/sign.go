@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SignHMAC returns the hex encoded HMAC-SHA256 of the payload with the given key.
+func SignHMAC(key, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashToken returns the hex encoded SHA-256 of a random token, to store it safely.
+// Tokens are random enough to not need a salted slow hash like passwords.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyHMAC reports whether the hex encoded signature is the HMAC-SHA256
+// of the payload with the given key, comparing in constant time.
+func VerifyHMAC(key, payload []byte, signature string) bool {
+	given, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), given)
+}
@@ -0,0 +1,39 @@
+package utils
+
+import "testing"
+
+func TestSignHMAC(t *testing.T) {
+	// RFC 4231 test case 2
+	got := SignHMAC([]byte("Jefe"), []byte("what do ya want for nothing?"))
+	want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("SignHMAC() = %s, want %s", got, want)
+	}
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	key := []byte("secret")
+	payload := []byte(`{"type":"file.uploaded"}`)
+	signature := SignHMAC(key, payload)
+
+	tests := []struct {
+		name      string
+		key       []byte
+		payload   []byte
+		signature string
+		want      bool
+	}{
+		{"Valid signature", key, payload, signature, true},
+		{"Wrong key", []byte("other"), payload, signature, false},
+		{"Tampered payload", key, []byte(`{"type":"file.deleted"}`), signature, false},
+		{"Malformed signature", key, payload, "not-hex", false},
+		{"Empty signature", key, payload, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyHMAC(tt.key, tt.payload, tt.signature); got != tt.want {
+				t.Errorf("VerifyHMAC() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
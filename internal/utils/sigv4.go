@@ -0,0 +1,322 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values of the AWS Signature Version 4, as used by the S3 API.
+const (
+	sigV4Algorithm      = "AWS4-HMAC-SHA256"
+	sigV4ChunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	sigV4DateFormat     = "20060102T150405Z"
+	sigV4Terminator     = "aws4_request"
+	// Max difference between the signing time and the server time
+	sigV4MaxSkew = 15 * time.Minute
+	// Max lifetime of presigned URLs
+	sigV4MaxExpires = 7 * 24 * time.Hour
+	// Max size of a chunk of a streaming payload, to bound the buffering
+	sigV4MaxChunkSize = 16 << 20
+
+	UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+)
+
+// SHA-256 of the empty payload.
+var sigV4EmptyHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+var ErrSigV4Missing = fmt.Errorf("missing signature")
+var ErrSigV4Malformed = fmt.Errorf("malformed signature")
+var ErrSigV4Expired = fmt.Errorf("signature expired or not yet valid")
+var ErrSigV4Mismatch = fmt.Errorf("signature does not match")
+
+// SigV4 is the AWS Signature Version 4 of a request, either from the
+// Authorization header or from the query string of a presigned URL.
+type SigV4 struct {
+	AccessKey string
+	// Signing time, from X-Amz-Date
+	Date time.Time
+	// Credential scope, i.e. date/region/service/aws4_request
+	Scope         string
+	Region        string
+	Service       string
+	SignedHeaders []string
+	Signature     string
+	// Hash of the payload, UnsignedPayload or StreamingPayload
+	PayloadHash string
+	presigned   bool
+}
+
+// ParseSigV4 parses the signature of the request and checks its validity period.
+func ParseSigV4(r *http.Request, now time.Time) (SigV4, error) {
+	var s SigV4
+	var credential, signedHeaders, date string
+
+	query := r.URL.Query()
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		algorithm, fields, _ := strings.Cut(auth, " ")
+		if algorithm != sigV4Algorithm {
+			return s, ErrSigV4Malformed
+		}
+		for _, field := range strings.Split(fields, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch key {
+			case "Credential":
+				credential = value
+			case "SignedHeaders":
+				signedHeaders = value
+			case "Signature":
+				s.Signature = value
+			}
+		}
+		date = r.Header.Get("X-Amz-Date")
+		s.PayloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	} else if query.Get("X-Amz-Algorithm") != "" {
+		if query.Get("X-Amz-Algorithm") != sigV4Algorithm {
+			return s, ErrSigV4Malformed
+		}
+		credential = query.Get("X-Amz-Credential")
+		signedHeaders = query.Get("X-Amz-SignedHeaders")
+		s.Signature = query.Get("X-Amz-Signature")
+		date = query.Get("X-Amz-Date")
+		s.PayloadHash = UnsignedPayload
+		s.presigned = true
+	} else {
+		return s, ErrSigV4Missing
+	}
+
+	scope := strings.Split(credential, "/")
+	if len(scope) != 5 || scope[4] != sigV4Terminator || signedHeaders == "" || s.Signature == "" {
+		return s, ErrSigV4Malformed
+	}
+	s.AccessKey = scope[0]
+	s.Region = scope[2]
+	s.Service = scope[3]
+	s.Scope = strings.Join(scope[1:], "/")
+	s.SignedHeaders = strings.Split(signedHeaders, ";")
+	if s.PayloadHash == "" {
+		return s, ErrSigV4Malformed
+	}
+
+	var err error
+	s.Date, err = time.Parse(sigV4DateFormat, date)
+	if err != nil || s.Date.Format("20060102") != scope[1] {
+		return s, ErrSigV4Malformed
+	}
+
+	if s.presigned {
+		expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || expires <= 0 || time.Duration(expires)*time.Second > sigV4MaxExpires {
+			return s, ErrSigV4Malformed
+		}
+		if now.Before(s.Date.Add(-sigV4MaxSkew)) || now.After(s.Date.Add(time.Duration(expires)*time.Second)) {
+			return s, ErrSigV4Expired
+		}
+	} else if now.Sub(s.Date) > sigV4MaxSkew || s.Date.Sub(now) > sigV4MaxSkew {
+		return s, ErrSigV4Expired
+	}
+
+	return s, nil
+}
+
+// Verify checks the signature of the request against the secret of the access key.
+// The payload itself is only verified while read through Body.
+func (s SigV4) Verify(r *http.Request, secret string) error {
+	expected := SignHMAC(s.key(secret), []byte(s.stringToSign(r)))
+	if !hmac.Equal([]byte(expected), []byte(s.Signature)) {
+		return ErrSigV4Mismatch
+	}
+	return nil
+}
+
+// Body returns the payload of the request, verified while read against its signed hash.
+// Streaming payloads are decoded, checking the signature of every chunk.
+func (s SigV4) Body(r *http.Request, secret string) io.Reader {
+	switch s.PayloadHash {
+	case UnsignedPayload:
+		return r.Body
+	case StreamingPayload:
+		return &sigV4ChunkReader{
+			r:         bufio.NewReader(r.Body),
+			sig:       s,
+			key:       s.key(secret),
+			signature: s.Signature,
+		}
+	}
+	return &sigV4HashReader{r: r.Body, hash: sha256.New(), expected: s.PayloadHash}
+}
+
+// key derives the signing key of the scope from the secret.
+func (s SigV4) key(secret string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range strings.Split(s.Scope, "/") {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return key
+}
+
+// stringToSign returns the string covered by the signature of the request.
+func (s SigV4) stringToSign(r *http.Request) string {
+	canonical := s.canonicalRequest(r)
+	sum := sha256.Sum256([]byte(canonical))
+	return strings.Join([]string{
+		sigV4Algorithm,
+		s.Date.Format(sigV4DateFormat),
+		s.Scope,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+}
+
+// canonicalRequest returns the canonical form of the request, as defined by AWS.
+func (s SigV4) canonicalRequest(r *http.Request) string {
+	// Query parameters sorted by encoded name, then value
+	var params []string
+	for name, values := range r.URL.Query() {
+		if s.presigned && name == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, URIEncode(name, true)+"="+URIEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+
+	var headers strings.Builder
+	for _, name := range s.SignedHeaders {
+		var values []string
+		switch {
+		case name == "host":
+			values = []string{r.Host}
+		case name == "content-length" && r.ContentLength >= 0:
+			// Moved out of the headers by net/http
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		default:
+			for _, value := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(value), " "))
+			}
+		}
+		value := strings.Join(values, ",")
+		headers.WriteString(name + ":" + value + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		URIEncode(r.URL.Path, false),
+		strings.Join(params, "&"),
+		headers.String(),
+		strings.Join(s.SignedHeaders, ";"),
+		s.PayloadHash,
+	}, "\n")
+}
+
+// URIEncode encodes all but the unreserved characters of RFC 3986, as AWS does.
+func URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// sigV4HashReader checks at the end of the payload that its SHA-256 is the expected one.
+type sigV4HashReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (h *sigV4HashReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.hash.Sum(nil)) != h.expected {
+		return n, ErrSigV4Mismatch
+	}
+	return n, err
+}
+
+// sigV4ChunkReader decodes a payload sent in aws-chunked encoding, where every
+// chunk is signed along with the signature of the previous one.
+type sigV4ChunkReader struct {
+	r   *bufio.Reader
+	sig SigV4
+	key []byte
+	// Signature of the previous chunk, the seed signature at first
+	signature string
+	chunk     []byte
+	done      bool
+}
+
+func (c *sigV4ChunkReader) Read(p []byte) (int, error) {
+	for len(c.chunk) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.chunk)
+	c.chunk = c.chunk[n:]
+	return n, nil
+}
+
+// next reads and verifies the next chunk, whose header is "{hex size};chunk-signature={signature}".
+func (c *sigV4ChunkReader) next() error {
+	header, err := c.r.ReadString('\n')
+	if err != nil {
+		return ErrSigV4Malformed
+	}
+	sizeHex, ext, _ := strings.Cut(strings.TrimRight(header, "\r\n"), ";")
+	signature := strings.TrimPrefix(ext, "chunk-signature=")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if signature == ext || err != nil || size < 0 || size > sigV4MaxChunkSize {
+		return ErrSigV4Malformed
+	}
+
+	chunk := make([]byte, size)
+	if _, err := io.ReadFull(c.r, chunk); err != nil {
+		return ErrSigV4Malformed
+	}
+	if crlf, err := c.r.ReadString('\n'); err != nil || crlf != "\r\n" {
+		return ErrSigV4Malformed
+	}
+
+	sum := sha256.Sum256(chunk)
+	stringToSign := strings.Join([]string{
+		sigV4ChunkAlgorithm,
+		c.sig.Date.Format(sigV4DateFormat),
+		c.sig.Scope,
+		c.signature,
+		sigV4EmptyHash,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	if expected := SignHMAC(c.key, []byte(stringToSign)); !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrSigV4Mismatch
+	}
+
+	c.signature = signature
+	c.chunk = chunk
+	c.done = size == 0
+	return nil
+}
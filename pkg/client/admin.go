@@ -0,0 +1,253 @@
+package client
+
+import (
+	"context"
+	"dryve/pkg/dto"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AuditFilter selects the audit entries, the zero fields matching all of them.
+type AuditFilter struct {
+	Action  string
+	Target  string
+	Outcome string
+	ActorID uint
+	// Dates of the first and last days, both inclusive
+	From time.Time
+	To   time.Time
+}
+
+func (f AuditFilter) query() url.Values {
+	query := url.Values{}
+	if f.Action != "" {
+		query.Set("action", f.Action)
+	}
+	if f.Target != "" {
+		query.Set("target", f.Target)
+	}
+	if f.Outcome != "" {
+		query.Set("outcome", f.Outcome)
+	}
+	if f.ActorID != 0 {
+		query.Set("actor", strconv.FormatUint(uint64(f.ActorID), 10))
+	}
+	if !f.From.IsZero() {
+		query.Set("from", f.From.Format(dateFormat))
+	}
+	if !f.To.IsZero() {
+		query.Set("to", f.To.Format(dateFormat))
+	}
+	return query
+}
+
+// UserFilter selects the users, the zero fields matching all of them.
+type UserFilter struct {
+	// Matched against the email and the names, case-insensitively
+	Query    string
+	Role     string
+	Verified *bool
+	Disabled *bool
+}
+
+func (f UserFilter) query() url.Values {
+	query := url.Values{}
+	if f.Query != "" {
+		query.Set("q", f.Query)
+	}
+	if f.Role != "" {
+		query.Set("role", f.Role)
+	}
+	if f.Verified != nil {
+		query.Set("verified", strconv.FormatBool(*f.Verified))
+	}
+	if f.Disabled != nil {
+		query.Set("disabled", strconv.FormatBool(*f.Disabled))
+	}
+	return query
+}
+
+// GetDeletionStatus returns the state of the pending blob deletions. Requires the storage:admin permission.
+func (c *Client) GetDeletionStatus(ctx context.Context) (dto.DeletionStatusResponse, error) {
+	var res dto.DeletionStatusResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/storage/deletions"}, &res)
+	return res, err
+}
+
+// PlaceFileHold places a legal hold on the file, which cannot be deleted until released. Requires the holds:admin permission.
+func (c *Client) PlaceFileHold(ctx context.Context, id string) (dto.LegalHoldResponse, error) {
+	var res dto.LegalHoldResponse
+	err := c.call(ctx, request{method: http.MethodPut, path: pathf("/admin/files/%s/hold", id)}, &res)
+	return res, err
+}
+
+// ReleaseFileHold releases the legal hold of the file. Requires the holds:admin permission.
+func (c *Client) ReleaseFileHold(ctx context.Context, id string) (dto.LegalHoldResponse, error) {
+	var res dto.LegalHoldResponse
+	err := c.call(ctx, request{method: http.MethodDelete, path: pathf("/admin/files/%s/hold", id)}, &res)
+	return res, err
+}
+
+// PlaceUserHold places a legal hold on all the files of the user. Requires the holds:admin permission.
+func (c *Client) PlaceUserHold(ctx context.Context, userID uint) (dto.LegalHoldResponse, error) {
+	var res dto.LegalHoldResponse
+	err := c.call(ctx, request{method: http.MethodPut, path: pathf("/admin/users/%s/hold", userID)}, &res)
+	return res, err
+}
+
+// ReleaseUserHold releases the legal hold of the files of the user. Requires the holds:admin permission.
+func (c *Client) ReleaseUserHold(ctx context.Context, userID uint) (dto.LegalHoldResponse, error) {
+	var res dto.LegalHoldResponse
+	err := c.call(ctx, request{method: http.MethodDelete, path: pathf("/admin/users/%s/hold", userID)}, &res)
+	return res, err
+}
+
+// DeleteUserAccount schedules the deletion of the account of the user after the grace period,
+// or deletes it at once if immediate. Requires the users:admin permission.
+func (c *Client) DeleteUserAccount(ctx context.Context, userID uint, immediate bool) (dto.AccountDeletionResponse, error) {
+	var res dto.AccountDeletionResponse
+	req := request{method: http.MethodPut, path: pathf("/admin/users/%s/deletion", userID)}
+	if immediate {
+		req.query = url.Values{"immediate": {"true"}}
+	}
+	err := c.call(ctx, req, &res)
+	return res, err
+}
+
+// CancelUserAccountDeletion cancels the scheduled deletion of the account of the user. Requires the users:admin permission.
+func (c *Client) CancelUserAccountDeletion(ctx context.Context, userID uint) (dto.AccountDeletionResponse, error) {
+	var res dto.AccountDeletionResponse
+	err := c.call(ctx, request{method: http.MethodDelete, path: pathf("/admin/users/%s/deletion", userID)}, &res)
+	return res, err
+}
+
+// ListUsers returns a page of the users matching the filter, by ID, with their storage usage.
+// The server default applies for a zero limit. Requires the users:admin permission.
+func (c *Client) ListUsers(ctx context.Context, filter UserFilter, offset, limit int) (dto.ListUsersResponse, error) {
+	query := filter.query()
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var res dto.ListUsersResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/admin/users", query: query}, &res)
+	return res, err
+}
+
+// GetUserAccount returns the account of the user with their storage usage. Requires the users:admin permission.
+func (c *Client) GetUserAccount(ctx context.Context, userID uint) (dto.AdminUserResponse, error) {
+	var res dto.AdminUserResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: pathf("/admin/users/%s", userID)}, &res)
+	return res, err
+}
+
+// VerifyUserAccount verifies the email of the user. Requires the users:admin permission.
+func (c *Client) VerifyUserAccount(ctx context.Context, userID uint) (dto.AdminUserResponse, error) {
+	var res dto.AdminUserResponse
+	err := c.call(ctx, request{method: http.MethodPut, path: pathf("/admin/users/%s/verify", userID)}, &res)
+	return res, err
+}
+
+// DisableUser refuses all the requests of the user and revokes their sessions. Requires the users:admin permission.
+func (c *Client) DisableUser(ctx context.Context, userID uint) (dto.AdminUserResponse, error) {
+	var res dto.AdminUserResponse
+	err := c.call(ctx, request{method: http.MethodPut, path: pathf("/admin/users/%s/disabled", userID)}, &res)
+	return res, err
+}
+
+// EnableUser re-enables the disabled user. Requires the users:admin permission.
+func (c *Client) EnableUser(ctx context.Context, userID uint) (dto.AdminUserResponse, error) {
+	var res dto.AdminUserResponse
+	err := c.call(ctx, request{method: http.MethodDelete, path: pathf("/admin/users/%s/disabled", userID)}, &res)
+	return res, err
+}
+
+// ResetUserPassword replaces the password of the user with a temporary one emailed to them, and revokes
+// their sessions. Requires the users:admin permission.
+func (c *Client) ResetUserPassword(ctx context.Context, userID uint) (dto.AdminUserResponse, error) {
+	var res dto.AdminUserResponse
+	err := c.call(ctx, request{method: http.MethodPost, path: pathf("/admin/users/%s/password-reset", userID)}, &res)
+	return res, err
+}
+
+// SetUserRole changes the role of the user. Requires the users:admin permission, and every permission of the role.
+func (c *Client) SetUserRole(ctx context.Context, userID uint, role string) (dto.AdminUserResponse, error) {
+	var res dto.AdminUserResponse
+	err := c.call(ctx, request{
+		method: http.MethodPut,
+		path:   pathf("/admin/users/%s/role", userID),
+		body:   dto.SetRoleRequest{Role: role},
+	}, &res)
+	return res, err
+}
+
+// ListUserFiles returns the subfolders and files of a folder of the user, the root folder if empty.
+// Requires the files:admin permission.
+func (c *Client) ListUserFiles(ctx context.Context, userID uint, folder string) (dto.AdminUserFilesResponse, error) {
+	req := request{method: http.MethodGet, path: pathf("/admin/users/%s/files", userID)}
+	if folder != "" {
+		req.query = url.Values{"folder": {folder}}
+	}
+
+	var res dto.AdminUserFilesResponse
+	err := c.call(ctx, req, &res)
+	return res, err
+}
+
+// DeleteUserFile deletes a file of the user. Requires the files:admin permission.
+func (c *Client) DeleteUserFile(ctx context.Context, userID uint, fileID string) (dto.DeleteFileResponse, error) {
+	var res dto.DeleteFileResponse
+	err := c.call(ctx, request{method: http.MethodDelete, path: pathf("/admin/users/%s/files/%s", userID, fileID)}, &res)
+	return res, err
+}
+
+// SearchAudit returns a page of the audit entries matching the filter, newest first.
+// The server default applies for a zero limit. Requires the audit:read permission.
+func (c *Client) SearchAudit(ctx context.Context, filter AuditFilter, offset, limit int) (dto.SearchAuditResponse, error) {
+	query := filter.query()
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var res dto.SearchAuditResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/admin/audit", query: query}, &res)
+	return res, err
+}
+
+// ExportAudit writes all the audit entries matching the filter to w as JSON lines, oldest first. Requires the audit:read permission.
+func (c *Client) ExportAudit(ctx context.Context, filter AuditFilter, w io.Writer) (int64, error) {
+	res, err := c.send(ctx, request{method: http.MethodGet, path: "/admin/audit/export", query: filter.query()})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	return io.Copy(w, res.Body)
+}
+
+// ListVolumes returns the storage volumes with their usage and the state of their drain. Requires the storage:admin permission.
+func (c *Client) ListVolumes(ctx context.Context) (dto.ListVolumesResponse, error) {
+	var res dto.ListVolumesResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/admin/storage/volumes"}, &res)
+	return res, err
+}
+
+// DrainVolume stops placing new blobs on the volume and relocates its blobs in background. Requires the storage:admin permission.
+func (c *Client) DrainVolume(ctx context.Context, name string) error {
+	return c.call(ctx, request{method: http.MethodPost, path: pathf("/admin/storage/volumes/%s/drain", name)}, nil)
+}
+
+// ListReplicas returns the replicas with the number of blobs they lack. Requires the storage:admin permission.
+func (c *Client) ListReplicas(ctx context.Context) (dto.ListReplicasResponse, error) {
+	var res dto.ListReplicasResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/admin/storage/replicas"}, &res)
+	return res, err
+}
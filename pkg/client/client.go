@@ -0,0 +1,355 @@
+// Package client is the Go client of the Dryve HTTP API.
+//
+// Methods take a context and return the dto types of the API. Contents are
+// streamed from an io.Reader on upload and to an io.Writer on download, and the
+// errors of the server are returned as *Error, matching the Err* sentinels with errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"dryve/pkg/dto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Margin before the expiration of the token at which it is renewed ahead of the requests,
+// so that uploads which cannot be sent again are not rejected
+const renewMargin = 30 * time.Second
+
+// Client calls the Dryve API. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	// Single-use token exchanged for a new token once the token expires
+	refreshToken string
+	// Credentials to log in with once the token is missing or rejected and cannot be refreshed
+	email    string
+	password string
+	// Called with the new tokens after each login and refresh
+	onSession func(dto.LoginResponse)
+
+	// Serializes the renewals, a refresh token used twice revokes the session
+	renewMu sync.Mutex
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client sending the requests, http.DefaultClient otherwise.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithToken sets the token authenticating the requests, as returned by Login.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRefreshToken sets the refresh token exchanged for a new token once the token expires or is missing.
+// Refresh tokens are rotated on each use, see WithSessionHook to persist the new ones.
+func WithRefreshToken(token string) Option {
+	return func(c *Client) {
+		c.refreshToken = token
+	}
+}
+
+// WithSessionHook sets a function called with the new tokens after each login and refresh,
+// e.g. to save the rotated refresh token.
+func WithSessionHook(fn func(dto.LoginResponse)) Option {
+	return func(c *Client) {
+		c.onSession = fn
+	}
+}
+
+// WithCredentials makes the client log in on its first request, and again once its token expires.
+func WithCredentials(email, password string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.password = password
+	}
+}
+
+// New creates a client of the server at baseURL, e.g. http://localhost:8666.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns the current token of the client, empty if not logged in.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// SetToken replaces the token authenticating the requests.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.expiresAt = time.Time{}
+}
+
+// RefreshToken returns the current refresh token of the client, empty if none.
+func (c *Client) RefreshToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refreshToken
+}
+
+// Login logs in with the credentials and authenticates the following requests with the returned token.
+func (c *Client) Login(ctx context.Context, email, password string) (dto.LoginResponse, error) {
+	var res dto.LoginResponse
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   "/auth/login",
+		body:   dto.LoginRequest{Email: email, Password: password},
+		noAuth: true,
+	}, &res)
+	if err != nil {
+		return res, err
+	}
+	c.setSession(res)
+	return res, nil
+}
+
+// Refresh exchanges the refresh token of the client for a new token and a new refresh token.
+func (c *Client) Refresh(ctx context.Context) (dto.LoginResponse, error) {
+	c.renewMu.Lock()
+	defer c.renewMu.Unlock()
+	return c.refresh(ctx)
+}
+
+func (c *Client) refresh(ctx context.Context) (dto.LoginResponse, error) {
+	var res dto.LoginResponse
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   "/auth/refresh",
+		body:   dto.RefreshRequest{RefreshToken: c.RefreshToken()},
+		noAuth: true,
+	}, &res)
+	if err != nil {
+		return res, err
+	}
+	c.setSession(res)
+	return res, nil
+}
+
+// Logout revokes the token of the client and its refresh token, or every session of the user with all,
+// then forgets them.
+func (c *Client) Logout(ctx context.Context, all bool) error {
+	query := url.Values{}
+	if all {
+		query.Set("all", "true")
+	}
+	err := c.call(ctx, request{method: http.MethodPost, path: "/auth/logout", query: query}, nil)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token, c.expiresAt, c.refreshToken = "", time.Time{}, ""
+	return nil
+}
+
+// setSession authenticates the following requests with the new tokens and passes them to the hook.
+func (c *Client) setSession(res dto.LoginResponse) {
+	c.mu.Lock()
+	c.token, c.expiresAt = res.Token, res.ExpiresAt
+	if res.RefreshToken != "" {
+		c.refreshToken = res.RefreshToken
+	}
+	onSession := c.onSession
+	c.mu.Unlock()
+
+	if onSession != nil {
+		onSession(res)
+	}
+}
+
+// request describes a call to the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	// Absolute URL replacing the path, for presigned URLs
+	url string
+	// Value sent as JSON, if any
+	body any
+	// Content sent as is with its content type, which cannot be sent again
+	content     io.Reader
+	contentType string
+	// Whether the request is sent without the token
+	noAuth bool
+}
+
+// call sends the request and decodes the JSON response into out, unless nil.
+func (c *Client) call(ctx context.Context, req request, out any) error {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("dryve: invalid response: %w", err)
+	}
+	return nil
+}
+
+// send sends the request, returning an *Error for the error statuses. The body of the
+// response must be closed by the caller. Requests rejected for an expired token are sent again
+// once refreshed or logged in, if the client can renew its token and the body can be replayed.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	token := ""
+	if !req.noAuth {
+		var err error
+		if token, err = c.ensureToken(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := c.do(ctx, req, body, token)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized && token != "" && req.content == nil && c.canRenew() {
+		res.Body.Close()
+		if token, err = c.renew(ctx, token); err != nil {
+			return nil, err
+		}
+		if res, err = c.do(ctx, req, body, token); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		return nil, newError(res)
+	}
+	return res, nil
+}
+
+func (c *Client) do(ctx context.Context, req request, body []byte, token string) (*http.Response, error) {
+	u := req.url
+	if u == "" {
+		u = c.baseURL + req.path
+		if len(req.query) > 0 {
+			u += "?" + req.query.Encode()
+		}
+	}
+
+	var r io.Reader
+	contentType := req.contentType
+	if body != nil {
+		r = bytes.NewReader(body)
+		contentType = "application/json"
+	} else if req.content != nil {
+		r = req.content
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.http.Do(httpReq)
+}
+
+// ensureToken returns the token of the client, renewing it first if missing or about to expire
+// and the client can renew it.
+func (c *Client) ensureToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, expiresAt := c.token, c.expiresAt
+	c.mu.Unlock()
+	if token != "" && (expiresAt.IsZero() || time.Until(expiresAt) > renewMargin) || !c.canRenew() {
+		return token, nil
+	}
+
+	return c.renew(ctx, token)
+}
+
+func (c *Client) canRenew() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refreshToken != "" || c.email != ""
+}
+
+// renew replaces the stale token with a new one, from the refresh token if any, or else from the
+// credentials, unless another request replaced it already.
+func (c *Client) renew(ctx context.Context, stale string) (string, error) {
+	c.renewMu.Lock()
+	defer c.renewMu.Unlock()
+
+	c.mu.Lock()
+	token, refreshToken, email, password := c.token, c.refreshToken, c.email, c.password
+	c.mu.Unlock()
+	if token != stale && token != "" {
+		return token, nil
+	}
+
+	if refreshToken != "" {
+		res, err := c.refresh(ctx)
+		if err == nil || email == "" || !errors.Is(err, ErrUnauthorized) {
+			return res.Token, err
+		}
+	}
+	res, err := c.Login(ctx, email, password)
+	return res.Token, err
+}
+
+// Healthcheck returns the status of the server.
+func (c *Client) Healthcheck(ctx context.Context) (dto.HealthcheckResponse, error) {
+	var res dto.HealthcheckResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/healthcheck", noAuth: true}, &res)
+	return res, err
+}
+
+// pathf formats the path, escaping the arguments as path segments.
+func pathf(format string, args ...any) string {
+	escaped := make([]any, len(args))
+	for i, arg := range args {
+		escaped[i] = url.PathEscape(fmt.Sprint(arg))
+	}
+	return fmt.Sprintf(format, escaped...)
+}
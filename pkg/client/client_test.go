@@ -0,0 +1,189 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"dryve/pkg/dto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusBadRequest, ErrBadRequest},
+		{http.StatusNotAcceptable, ErrBadRequest},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrForbidden},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusGone, ErrGone},
+		{http.StatusUnprocessableEntity, ErrQuarantined},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusInsufficientStorage, ErrInsufficientStorage},
+		{http.StatusInternalServerError, ErrServer},
+		{http.StatusBadGateway, ErrServer},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.status), func(t *testing.T) {
+			var err error = &Error{StatusCode: tt.status}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := ": keepalive\n\n" +
+		"event: resync\ndata: {}\n\n" +
+		"id: ab-1\nevent: file.uploaded\ndata: {\"id\":\"e1\",\"type\":\"file.uploaded\",\"userId\":1,\"data\":{\"id\":\"f1\",\"name\":\"a.txt\",\"size\":3}}\n\n" +
+		"id: ab-2\r\nevent: user.verified\r\ndata: {\"id\":\"e2\",\"type\":\"user.verified\",\"data\":{\"id\":1}}\r\n\r\n" +
+		"id: ab-3\nevent: file.deleted\ndata: {\"id\":\"e3\""
+
+	var events []StreamEvent
+	err := readSSE(bufio.NewReader(strings.NewReader(stream)), func(e StreamEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != ErrStreamClosed {
+		t.Errorf("readSSE returned %v, want %v", err, ErrStreamClosed)
+	}
+
+	// The last event is truncated, so never dispatched
+	if len(events) != 3 {
+		t.Fatalf("received %d events, want 3", len(events))
+	}
+	if events[0].Type != StreamResync {
+		t.Errorf("first event type = %q, want %q", events[0].Type, StreamResync)
+	}
+	if data, ok := events[1].Event.Data.(dto.FileEventData); events[1].ID != "ab-1" || !ok || data.Name != "a.txt" {
+		t.Errorf("file event = %+v, want ID ab-1 and the data of a.txt", events[1])
+	}
+	if _, ok := events[2].Event.Data.(map[string]any); events[2].ID != "ab-2" || !ok {
+		t.Errorf("user event = %+v, want ID ab-2 and untyped data", events[2])
+	}
+}
+
+func TestClientRelogin(t *testing.T) {
+	var logins int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/auth/login":
+			n := atomic.AddInt32(&logins, 1)
+			json.NewEncoder(w).Encode(dto.LoginResponse{Token: fmt.Sprintf("token-%d", n)})
+		case r.Header.Get("Authorization") != "Bearer token-2":
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case r.URL.Path == "/files/f1":
+			json.NewEncoder(w).Encode(dto.GetFileResponse{ID: "f1"})
+		default:
+			io.Copy(io.Discard, r.Body)
+			http.Error(w, "File not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	// The first token is rejected, the request is sent again with the second one
+	c := New(srv.URL, WithCredentials("foo@bar.com", "secret"))
+	file, err := c.GetFile(context.Background(), "f1")
+	if err != nil || file.ID != "f1" {
+		t.Fatalf("GetFile = %+v, %v, want f1", file, err)
+	}
+	if c.Token() != "token-2" || logins != 2 {
+		t.Errorf("token = %q after %d logins, want token-2 after 2", c.Token(), logins)
+	}
+
+	_, err = c.Upload(context.Background(), "a.txt", strings.NewReader("abc"), nil)
+	var apiErr *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Message != "File not found" {
+		t.Errorf("Upload returned %v, want the not found error of the server", err)
+	}
+
+	// Without credentials, the rejection is returned as is
+	_, err = New(srv.URL, WithToken("stale")).GetFile(context.Background(), "f1")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("GetFile returned %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestClientRefresh(t *testing.T) {
+	var mu sync.Mutex
+	refreshes := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/auth/refresh":
+			var req dto.RefreshRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			// Refresh tokens are single-use
+			if req.RefreshToken != fmt.Sprintf("refresh-%d", refreshes) {
+				http.Error(w, "Refresh token reused, session revoked", http.StatusUnauthorized)
+				return
+			}
+			refreshes++
+			json.NewEncoder(w).Encode(dto.LoginResponse{
+				Token:        fmt.Sprintf("token-%d", refreshes),
+				ExpiresAt:    time.Now().Add(time.Hour),
+				RefreshToken: fmt.Sprintf("refresh-%d", refreshes),
+			})
+		case r.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", refreshes):
+			http.Error(w, "JWT expired", http.StatusUnauthorized)
+		default:
+			json.NewEncoder(w).Encode(dto.GetFileResponse{ID: "f1"})
+		}
+	}))
+	defer srv.Close()
+
+	var saved []string
+	c := New(srv.URL, WithToken("stale"), WithRefreshToken("refresh-0"), WithSessionHook(func(res dto.LoginResponse) {
+		saved = append(saved, res.RefreshToken)
+	}))
+
+	// The requests rejected together are sent again after a single refresh
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetFile(context.Background(), "f1"); err != nil {
+				t.Errorf("GetFile returned %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshes != 1 || c.Token() != "token-1" || c.RefreshToken() != "refresh-1" {
+		t.Errorf("token = %q, refresh token = %q after %d refreshes, want token-1, refresh-1 after 1",
+			c.Token(), c.RefreshToken(), refreshes)
+	}
+	if len(saved) != 1 || saved[0] != "refresh-1" {
+		t.Errorf("saved refresh tokens = %v, want [refresh-1]", saved)
+	}
+
+	// Tokens about to expire are refreshed before the uploads, which cannot be sent again
+	c.setSession(dto.LoginResponse{Token: "token-1", ExpiresAt: time.Now().Add(time.Second)})
+	if _, err := c.Upload(context.Background(), "a.txt", strings.NewReader("abc"), nil); err != nil {
+		t.Errorf("Upload returned %v", err)
+	}
+	if refreshes != 2 {
+		t.Errorf("%d refreshes, want 2", refreshes)
+	}
+
+	// A rejected refresh token is returned as is without credentials
+	_, err := New(srv.URL, WithRefreshToken("refresh-0")).GetFile(context.Background(), "f1")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("GetFile returned %v, want %v", err, ErrUnauthorized)
+	}
+}
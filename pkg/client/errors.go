@@ -0,0 +1,73 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Errors matched with errors.Is by the *Error returned for the HTTP statuses of the server.
+var (
+	ErrBadRequest          = errors.New("dryve: bad request")
+	ErrUnauthorized        = errors.New("dryve: unauthorized")
+	ErrForbidden           = errors.New("dryve: forbidden")
+	ErrNotFound            = errors.New("dryve: not found")
+	ErrConflict            = errors.New("dryve: conflict")
+	ErrGone                = errors.New("dryve: gone")
+	ErrQuarantined         = errors.New("dryve: file quarantined")
+	ErrRateLimited         = errors.New("dryve: rate limited")
+	ErrInsufficientStorage = errors.New("dryve: insufficient storage")
+	ErrServer              = errors.New("dryve: server error")
+)
+
+// Error is an error status returned by the server.
+type Error struct {
+	StatusCode int
+	// Message of the server, sent as plain text
+	Message string
+}
+
+func newError(res *http.Response) *Error {
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return &Error{
+		StatusCode: res.StatusCode,
+		Message:    strings.TrimSpace(string(msg)),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("dryve: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("dryve: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Unwrap returns the sentinel error of the status, nil if it has none.
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusNotAcceptable, http.StatusRequestEntityTooLarge:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusGone:
+		return ErrGone
+	case http.StatusUnprocessableEntity:
+		return ErrQuarantined
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusInsufficientStorage:
+		return ErrInsufficientStorage
+	}
+	if e.StatusCode >= 500 {
+		return ErrServer
+	}
+	return nil
+}
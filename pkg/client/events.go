@@ -0,0 +1,149 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"dryve/pkg/dto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Type of the stream event telling that events were missed, and the files must be listed again.
+const StreamResync = "resync"
+
+// ErrStreamClosed is returned once the server closes the event stream, to resume from the last event ID.
+var ErrStreamClosed = errors.New("dryve: event stream closed")
+
+// StreamEvent is an event of the stream along with its position.
+type StreamEvent struct {
+	// ID of the event in the stream, to resume from
+	ID string
+	// Type of the event, or StreamResync
+	Type string
+	// Event, whose Data is a dto.FileEventData for the file events
+	Event dto.Event
+}
+
+// ListChanges returns the changes of the files and folders following the cursor, along with
+// the cursor to list the next ones from. An empty cursor returns the current position of the journal.
+// The server default applies for a zero limit.
+func (c *Client) ListChanges(ctx context.Context, cursor string, limit int) (dto.ListChangesResponse, error) {
+	query := url.Values{}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var res dto.ListChangesResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/changes", query: query}, &res)
+	return res, err
+}
+
+// StreamEvents calls fn with the file events of the user as they happen, following lastEventID
+// if not empty. It returns the error of fn, or ErrStreamClosed once the server closes the stream,
+// or the error of the context once done.
+func (c *Client) StreamEvents(ctx context.Context, lastEventID string, fn func(StreamEvent) error) error {
+	query := url.Values{}
+	if lastEventID != "" {
+		query.Set("lastEventId", lastEventID)
+	}
+
+	res, err := c.send(ctx, request{method: http.MethodGet, path: "/events", query: query})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	err = readSSE(bufio.NewReader(res.Body), fn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// readSSE reads the Server-Sent Events, skipping the comments and the fields other than id, event and data.
+func readSSE(r *bufio.Reader, fn func(StreamEvent) error) error {
+	var e StreamEvent
+	var data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return ErrStreamClosed
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// A blank line dispatches the event
+		if line == "" {
+			if data.Len() > 0 || e.Type != "" {
+				if err := decodeStreamEvent(&e, data.String()); err != nil {
+					return err
+				}
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+			e = StreamEvent{}
+			data.Reset()
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			e.ID = value
+		case "event":
+			e.Type = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+}
+
+// decodeStreamEvent decodes the data of the event, along with the data of the file events.
+func decodeStreamEvent(e *StreamEvent, raw string) error {
+	if e.Type == StreamResync {
+		return nil
+	}
+
+	var event struct {
+		dto.Event
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(raw), &event); err != nil {
+		return fmt.Errorf("dryve: invalid stream event: %w", err)
+	}
+	e.Event = event.Event
+
+	// Only the data of the file events have a type, the others are decoded as is
+	var data any = &e.Event.Data
+	if strings.HasPrefix(event.Type, "file.") {
+		data = &dto.FileEventData{}
+	}
+	if len(event.Data) > 0 {
+		if err := json.Unmarshal(event.Data, data); err != nil {
+			return fmt.Errorf("dryve: invalid stream event: %w", err)
+		}
+	}
+	if fileData, ok := data.(*dto.FileEventData); ok {
+		e.Event.Data = *fileData
+	}
+	return nil
+}
+
+// Presign creates a time-limited signed URL to download or upload a file, or to open the event stream.
+func (c *Client) Presign(ctx context.Context, req dto.PresignRequest) (dto.PresignResponse, error) {
+	var res dto.PresignResponse
+	err := c.call(ctx, request{method: http.MethodPost, path: "/presign", body: req}, &res)
+	return res, err
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"dryve/pkg/dto"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Format of the dates of the ranges.
+const dateFormat = "2006-01-02"
+
+// UploadOptions are the optional settings of an uploaded file.
+type UploadOptions struct {
+	// Path of the folder holding the file, created if missing, the root folder if empty
+	Folder string
+	// Duration after which the file expires, none if zero
+	ExpiresIn time.Duration
+	// Time at which the file expires, none if zero
+	ExpiresAt time.Time
+}
+
+// Upload streams the content as the file with the given name, without buffering it.
+// Uploads are not sent again once the token expires, call Login first if needed.
+func (c *Client) Upload(ctx context.Context, name string, content io.Reader, opts *UploadOptions) (dto.UploadFileResponse, error) {
+	return c.upload(ctx, request{method: http.MethodPost, path: "/files"}, name, content, opts)
+}
+
+// UploadPresigned uploads the file through a presigned URL, without the token of the client.
+func (c *Client) UploadPresigned(ctx context.Context, presignedURL, name string, content io.Reader) (dto.UploadFileResponse, error) {
+	return c.upload(ctx, request{method: http.MethodPost, url: presignedURL, noAuth: true}, name, content, nil)
+}
+
+func (c *Client) upload(ctx context.Context, req request, name string, content io.Reader, opts *UploadOptions) (dto.UploadFileResponse, error) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeUploadForm(form, name, content, opts))
+	}()
+	// Unblocks the writer if the request ended before reading the whole form
+	defer pr.Close()
+
+	req.content = pr
+	req.contentType = form.FormDataContentType()
+	var res dto.UploadFileResponse
+	err := c.call(ctx, req, &res)
+	return res, err
+}
+
+func writeUploadForm(form *multipart.Writer, name string, content io.Reader, opts *UploadOptions) error {
+	if opts != nil && opts.Folder != "" {
+		if err := form.WriteField("folder", opts.Folder); err != nil {
+			return err
+		}
+	}
+	if opts != nil && opts.ExpiresIn > 0 {
+		if err := form.WriteField("expires_in", strconv.FormatInt(int64(opts.ExpiresIn/time.Second), 10)); err != nil {
+			return err
+		}
+	}
+	if opts != nil && !opts.ExpiresAt.IsZero() {
+		if err := form.WriteField("expires_at", opts.ExpiresAt.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// GetFile returns the metadata of the file.
+func (c *Client) GetFile(ctx context.Context, id string) (dto.GetFileResponse, error) {
+	var res dto.GetFileResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: pathf("/files/%s", id)}, &res)
+	return res, err
+}
+
+// SearchFiles returns the metadata of the files uploaded between the two dates, both inclusive.
+func (c *Client) SearchFiles(ctx context.Context, from, to time.Time) (dto.SearchFilesResponse, error) {
+	var res dto.SearchFilesResponse
+	err := c.call(ctx, request{
+		method: http.MethodGet,
+		path:   pathf("/files/range/%s/%s", from.Format(dateFormat), to.Format(dateFormat)),
+	}, &res)
+	return res, err
+}
+
+// DeleteFile deletes the file.
+func (c *Client) DeleteFile(ctx context.Context, id string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: pathf("/files/%s", id)}, nil)
+}
+
+// DeleteFiles deletes the files uploaded between the two dates, returning the outcome of each deletion.
+// Requires the files:delete_range permission.
+func (c *Client) DeleteFiles(ctx context.Context, from, to time.Time) (dto.DeleteFilesResponse, error) {
+	var res dto.DeleteFilesResponse
+	err := c.call(ctx, request{
+		method: http.MethodDelete,
+		path:   pathf("/files/range/%s/%s", from.Format(dateFormat), to.Format(dateFormat)),
+	}, &res)
+	return res, err
+}
+
+// FileReader is the content of a downloaded file, which must be closed.
+type FileReader struct {
+	io.ReadCloser
+	// Name of the file, empty if unknown
+	Name        string
+	ContentType string
+	// Size of the file in bytes, -1 if unknown
+	Size int64
+}
+
+// OpenFile returns the content of the file, read as it is downloaded.
+func (c *Client) OpenFile(ctx context.Context, id string) (*FileReader, error) {
+	return c.open(ctx, request{method: http.MethodGet, path: pathf("/files/%s/download", id)})
+}
+
+// OpenOriginal returns the original of the scrubbed image, if it was kept.
+func (c *Client) OpenOriginal(ctx context.Context, id string) (*FileReader, error) {
+	return c.open(ctx, request{method: http.MethodGet, path: pathf("/files/%s/original", id)})
+}
+
+// OpenPresigned returns the content of the file downloaded through a presigned URL, without the token of the client.
+func (c *Client) OpenPresigned(ctx context.Context, presignedURL string) (*FileReader, error) {
+	return c.open(ctx, request{method: http.MethodGet, url: presignedURL, noAuth: true})
+}
+
+// Download writes the content of the file to w, returning the number of bytes written.
+func (c *Client) Download(ctx context.Context, id string, w io.Writer) (int64, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: pathf("/files/%s/download", id)}, w)
+}
+
+// DownloadOriginal writes the original of the scrubbed image to w, if it was kept.
+func (c *Client) DownloadOriginal(ctx context.Context, id string, w io.Writer) (int64, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: pathf("/files/%s/original", id)}, w)
+}
+
+// DownloadPresigned writes the content of the file downloaded through a presigned URL to w.
+func (c *Client) DownloadPresigned(ctx context.Context, presignedURL string, w io.Writer) (int64, error) {
+	return c.download(ctx, request{method: http.MethodGet, url: presignedURL, noAuth: true}, w)
+}
+
+func (c *Client) open(ctx context.Context, req request) (*FileReader, error) {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FileReader{
+		ReadCloser:  res.Body,
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        res.ContentLength,
+	}
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil {
+		f.Name = params["filename"]
+	}
+	return f, nil
+}
+
+func (c *Client) download(ctx context.Context, req request, w io.Writer) (int64, error) {
+	f, err := c.open(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// ImportFile starts the import of the file at the URL, fetched by the server in background.
+func (c *Client) ImportFile(ctx context.Context, req dto.ImportFileRequest) (dto.ImportJobResponse, error) {
+	var res dto.ImportJobResponse
+	err := c.call(ctx, request{method: http.MethodPost, path: "/files/import", body: req}, &res)
+	return res, err
+}
+
+// GetImport returns the status of the import.
+func (c *Client) GetImport(ctx context.Context, id uint) (dto.ImportJobResponse, error) {
+	var res dto.ImportJobResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: pathf("/files/import/%s", id)}, &res)
+	return res, err
+}
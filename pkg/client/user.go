@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"dryve/pkg/dto"
+	"io"
+	"net/http"
+)
+
+// Register creates a user, whose email address must be verified next.
+func (c *Client) Register(ctx context.Context, req dto.RegisterRequest) error {
+	return c.call(ctx, request{method: http.MethodPost, path: "/auth/register", body: req, noAuth: true}, nil)
+}
+
+// RequestEmailVerification sends the verification link to the email address of the user.
+func (c *Client) RequestEmailVerification(ctx context.Context) error {
+	return c.call(ctx, request{method: http.MethodGet, path: "/user/verify/1"}, nil)
+}
+
+// VerifyEmail verifies the email address of the user with the code of the verification link.
+func (c *Client) VerifyEmail(ctx context.Context, userID uint, code string) error {
+	return c.call(ctx, request{
+		method: http.MethodGet,
+		path:   pathf("/user/verify/2/email/%s/%s", userID, code),
+		noAuth: true,
+	}, nil)
+}
+
+// GetSettings returns the settings of the user, along with the effective ones.
+func (c *Client) GetSettings(ctx context.Context) (dto.UserSettingsResponse, error) {
+	var res dto.UserSettingsResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/user/settings"}, &res)
+	return res, err
+}
+
+// UpdateSettings replaces the settings of the user, nil for the server defaults.
+func (c *Client) UpdateSettings(ctx context.Context, req dto.UserSettingsRequest) (dto.UserSettingsResponse, error) {
+	var res dto.UserSettingsResponse
+	err := c.call(ctx, request{method: http.MethodPut, path: "/user/settings", body: req}, &res)
+	return res, err
+}
+
+// CreateAppToken creates an app token for WebDAV, returned only once.
+func (c *Client) CreateAppToken(ctx context.Context, name string) (dto.AppTokenResponse, error) {
+	var res dto.AppTokenResponse
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   "/user/tokens",
+		body:   dto.CreateAppTokenRequest{Name: name},
+	}, &res)
+	return res, err
+}
+
+// ListAppTokens returns the app tokens of the user, without the tokens themselves.
+func (c *Client) ListAppTokens(ctx context.Context) (dto.ListAppTokensResponse, error) {
+	var res dto.ListAppTokensResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/user/tokens"}, &res)
+	return res, err
+}
+
+// DeleteAppToken revokes the app token.
+func (c *Client) DeleteAppToken(ctx context.Context, id uint) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: pathf("/user/tokens/%s", id)}, nil)
+}
+
+// CreateAccessKey creates an S3 access key, whose secret is returned only once.
+func (c *Client) CreateAccessKey(ctx context.Context) (dto.AccessKeyResponse, error) {
+	var res dto.AccessKeyResponse
+	err := c.call(ctx, request{method: http.MethodPost, path: "/user/access-keys"}, &res)
+	return res, err
+}
+
+// ListAccessKeys returns the S3 access keys of the user, without their secrets.
+func (c *Client) ListAccessKeys(ctx context.Context) (dto.ListAccessKeysResponse, error) {
+	var res dto.ListAccessKeysResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/user/access-keys"}, &res)
+	return res, err
+}
+
+// DeleteAccessKey revokes the S3 access key.
+func (c *Client) DeleteAccessKey(ctx context.Context, id uint) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: pathf("/user/access-keys/%s", id)}, nil)
+}
+
+// RequestAccountDeletion schedules the deletion of the account after the grace period, confirmed with its password.
+func (c *Client) RequestAccountDeletion(ctx context.Context, password string) (dto.AccountDeletionResponse, error) {
+	var res dto.AccountDeletionResponse
+	err := c.call(ctx, request{
+		method: http.MethodPut,
+		path:   "/user/deletion",
+		body:   dto.DeleteAccountRequest{Password: password},
+	}, &res)
+	return res, err
+}
+
+// GetAccountDeletion returns the time of the scheduled deletion of the account, if any.
+func (c *Client) GetAccountDeletion(ctx context.Context) (dto.AccountDeletionResponse, error) {
+	var res dto.AccountDeletionResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/user/deletion"}, &res)
+	return res, err
+}
+
+// CancelAccountDeletion cancels the scheduled deletion of the account.
+func (c *Client) CancelAccountDeletion(ctx context.Context) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: "/user/deletion"}, nil)
+}
+
+// RequestExport starts the export of all the data of the user, whose download link is sent by email once done.
+func (c *Client) RequestExport(ctx context.Context) (dto.ExportJobResponse, error) {
+	var res dto.ExportJobResponse
+	err := c.call(ctx, request{method: http.MethodPost, path: "/user/exports"}, &res)
+	return res, err
+}
+
+// GetExport returns the status of the export.
+func (c *Client) GetExport(ctx context.Context, id uint) (dto.ExportJobResponse, error) {
+	var res dto.ExportJobResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: pathf("/user/exports/%s", id)}, &res)
+	return res, err
+}
+
+// OpenExport returns the archive of the export once done, read as it is downloaded.
+func (c *Client) OpenExport(ctx context.Context, id uint) (*FileReader, error) {
+	return c.open(ctx, request{method: http.MethodGet, path: pathf("/user/exports/%s/download", id)})
+}
+
+// DownloadExport writes the archive of the export to w once done, returning the number of bytes written.
+func (c *Client) DownloadExport(ctx context.Context, id uint, w io.Writer) (int64, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: pathf("/user/exports/%s/download", id)}, w)
+}
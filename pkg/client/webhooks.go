@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"dryve/pkg/dto"
+	"net/http"
+)
+
+// CreateWebhook registers a webhook, whose signing secret is returned only once.
+func (c *Client) CreateWebhook(ctx context.Context, req dto.CreateWebhookRequest) (dto.WebhookResponse, error) {
+	var res dto.WebhookResponse
+	err := c.call(ctx, request{method: http.MethodPost, path: "/webhooks", body: req}, &res)
+	return res, err
+}
+
+// ListWebhooks returns the webhooks of the user.
+func (c *Client) ListWebhooks(ctx context.Context) (dto.ListWebhooksResponse, error) {
+	var res dto.ListWebhooksResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: "/webhooks"}, &res)
+	return res, err
+}
+
+// DeleteWebhook deletes the webhook, returning it.
+func (c *Client) DeleteWebhook(ctx context.Context, id uint) (dto.WebhookResponse, error) {
+	var res dto.WebhookResponse
+	err := c.call(ctx, request{method: http.MethodDelete, path: pathf("/webhooks/%s", id)}, &res)
+	return res, err
+}
+
+// ListWebhookDeliveries returns the delivery log of the webhook.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, id uint) (dto.ListWebhookDeliveriesResponse, error) {
+	var res dto.ListWebhookDeliveriesResponse
+	err := c.call(ctx, request{method: http.MethodGet, path: pathf("/webhooks/%s/deliveries", id)}, &res)
+	return res, err
+}
+
+// RedeliverWebhook schedules a new delivery of a past delivery of the webhook.
+func (c *Client) RedeliverWebhook(ctx context.Context, id, deliveryID uint) (dto.WebhookDeliveryResponse, error) {
+	var res dto.WebhookDeliveryResponse
+	err := c.call(ctx, request{
+		method: http.MethodPost,
+		path:   pathf("/webhooks/%s/deliveries/%s/redeliver", id, deliveryID),
+	}, &res)
+	return res, err
+}
@@ -0,0 +1,39 @@
+package dto
+
+import "time"
+
+type AdminUserResponse struct {
+	ID        uint       `json:"id"`
+	Email     string     `json:"email"`
+	FirstName string     `json:"firstName"`
+	LastName  string     `json:"lastName"`
+	Role      string     `json:"role"`
+	Verified  bool       `json:"verified"`
+	Disabled  bool       `json:"disabled"`
+	LegalHold bool       `json:"legalHold"`
+	CreatedAt time.Time  `json:"createdAt"`
+	DeleteAt  *time.Time `json:"deleteAt,omitempty"`
+	// Number of files of the user, without the originals of the scrubbed images
+	Files int64 `json:"files"`
+	// Total size of the files of the user, with the originals
+	Size int64 `json:"size"`
+}
+
+type ListUsersResponse struct {
+	Count  int                 `json:"count"`
+	Total  int64               `json:"total"`
+	Offset int                 `json:"offset"`
+	Users  []AdminUserResponse `json:"users"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type AdminUserFilesResponse struct {
+	UserID uint   `json:"userId"`
+	Folder string `json:"folder"`
+	// Paths of the subfolders
+	Folders []string          `json:"folders"`
+	Files   []GetFileResponse `json:"files"`
+}
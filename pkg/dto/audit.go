@@ -0,0 +1,22 @@
+package dto
+
+import "time"
+
+type AuditEntryResponse struct {
+	ID        uint      `json:"id"`
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	ActorID   uint      `json:"actorId,omitempty"`
+	IP        string    `json:"ip"`
+	RequestID string    `json:"requestId"`
+	Target    string    `json:"target"`
+	Outcome   string    `json:"outcome"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+type SearchAuditResponse struct {
+	Count   int                  `json:"count"`
+	Total   int64                `json:"total"`
+	Offset  int                  `json:"offset"`
+	Entries []AuditEntryResponse `json:"entries"`
+}
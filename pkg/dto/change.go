@@ -0,0 +1,29 @@
+package dto
+
+import "time"
+
+type ChangeResponse struct {
+	// Position of the change in the journal
+	ID   uint      `json:"id"`
+	Time time.Time `json:"time"`
+	// Kind of the changed item, file or folder
+	Kind string `json:"kind"`
+	// Operation, create, update, move or delete
+	Op string `json:"op"`
+	// ID of the changed file, omitted for folders
+	FileID string `json:"fileId,omitempty"`
+	// Path of the item after the change, before it for deletions
+	Path string `json:"path"`
+	// Path of the item before a move
+	OldPath string `json:"oldPath,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	MD5     string `json:"md5,omitempty"`
+}
+
+type ListChangesResponse struct {
+	Changes []ChangeResponse `json:"changes"`
+	// Cursor to list the following changes from
+	Cursor string `json:"cursor"`
+	// Whether more changes follow, to list right away
+	HasMore bool `json:"hasMore"`
+}
@@ -0,0 +1,33 @@
+package dto
+
+import "time"
+
+// Event is a file or user lifecycle event, as delivered to subscribers.
+type Event struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	UserID uint      `json:"userId"`
+	Data   any       `json:"data"`
+}
+
+type FileEventData struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Folder string `json:"folder,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+type UserEventData struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
+}
+
+// StreamMessage is a message of the event stream sent over WebSocket.
+type StreamMessage struct {
+	// ID of the event in the stream, to resume from with lastEventId
+	ID string `json:"id,omitempty"`
+	// Type of the event, or resync and keepalive
+	Type  string `json:"type"`
+	Event *Event `json:"event,omitempty"`
+}
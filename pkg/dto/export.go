@@ -0,0 +1,77 @@
+package dto
+
+import "time"
+
+type ExportJobResponse struct {
+	ID     uint   `json:"id"`
+	Status string `json:"status"`
+	// Size of the archive in bytes, once done
+	Size int64 `json:"size"`
+	// Number of files in the archive, and left out of it as quarantined or unreadable
+	Files      int        `json:"files"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Time after which the archive is removed, once done
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ExportManifest describes the data of the user, stored as manifest.json at the root of the export archive.
+type ExportManifest struct {
+	GeneratedAt time.Time     `json:"generatedAt"`
+	Profile     ExportProfile `json:"profile"`
+	Files       []ExportFile  `json:"files"`
+	// Links issued by the user to share files without a token, i.e. the presigned URLs
+	ShareLinks []ExportShareLink   `json:"shareLinks"`
+	AppTokens  []AppTokenResponse  `json:"appTokens"`
+	AccessKeys []AccessKeyResponse `json:"accessKeys"`
+	Webhooks   []WebhookResponse   `json:"webhooks"`
+	// Audit entries of the actions of the user, or targeting their files and credentials
+	Audit []AuditEntryResponse `json:"audit"`
+}
+
+type ExportProfile struct {
+	ID          uint      `json:"id"`
+	FirstName   string    `json:"firstName"`
+	LastName    string    `json:"lastName"`
+	Email       string    `json:"email"`
+	PhoneNumber string    `json:"phoneNumber,omitempty"`
+	Role        string    `json:"role"`
+	Verified    bool      `json:"verified"`
+	LegalHold   bool      `json:"legalHold,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Settings of the user, null for the server defaults
+	Settings UserSettingsRequest `json:"settings"`
+}
+
+type ExportFile struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Folder      string     `json:"folder"`
+	Size        int64      `json:"size"`
+	ContentType string     `json:"contentType"`
+	MD5         string     `json:"md5"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RetainUntil *time.Time `json:"retainUntil,omitempty"`
+	LegalHold   bool       `json:"legalHold,omitempty"`
+	ScanStatus  string     `json:"scanStatus"`
+	// Kinds of image metadata removed on upload, omitted if none
+	ScrubbedMetadata []string `json:"scrubbedMetadata,omitempty"`
+	// ID of the scrubbed file this file is the private original of, if any
+	OriginalOf string `json:"originalOf,omitempty"`
+	// Path of the content in the archive, omitted if skipped
+	Path string `json:"path,omitempty"`
+	// Reason the content was left out of the archive, if any
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// ExportShareLink is a presigned URL issued by the user. Only its target is
+// recorded by the server, the URL itself cannot be rebuilt.
+type ExportShareLink struct {
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"createdAt"`
+}
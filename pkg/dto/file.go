@@ -0,0 +1,52 @@
+package dto
+
+import "time"
+
+type UploadFileResponse struct {
+	ID         string `json:"id"`
+	ScanStatus string `json:"scanStatus"`
+	// Kinds of image metadata removed, omitted if none
+	ScrubbedMetadata []string `json:"scrubbedMetadata,omitempty"`
+	// Whether the original of the scrubbed image was kept as a private version
+	OriginalKept bool `json:"originalKept,omitempty"`
+}
+
+type GetFileResponse struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Size        int64      `json:"size"`
+	ContentType string     `json:"contentType"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RetainUntil *time.Time `json:"retainUntil,omitempty"`
+	LegalHold   bool       `json:"legalHold,omitempty"`
+	ScanStatus  string     `json:"scanStatus"`
+	// Storage tier of the file, omitted without tiering
+	Tier           string     `json:"tier,omitempty"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt,omitempty"`
+	// Kinds of image metadata removed on upload, omitted if none
+	ScrubbedMetadata []string `json:"scrubbedMetadata,omitempty"`
+}
+
+type DeleteFileResponse struct {
+	ID string `json:"id"`
+}
+
+type DeleteFilesResponse struct {
+	Count  int
+	Result []DeleteFilesResponseItem
+}
+
+type DeleteFilesResponseItem struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+type SearchFilesResponse struct {
+	Count int               `json:"count"`
+	Files []GetFileResponse `json:"files"`
+}
+
+type LegalHoldResponse struct {
+	ID        string `json:"id"`
+	LegalHold bool   `json:"legalHold"`
+}
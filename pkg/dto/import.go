@@ -0,0 +1,24 @@
+package dto
+
+import "time"
+
+type ImportFileRequest struct {
+	URL string `json:"url"`
+	// Name of the imported file, taken from the response if empty
+	Name string `json:"name,omitempty"`
+}
+
+type ImportJobResponse struct {
+	ID     uint   `json:"id"`
+	URL    string `json:"url"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	// Number of bytes fetched
+	Size int64 `json:"size"`
+	// ID of the imported file, once done
+	FileID     string     `json:"fileId,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
@@ -0,0 +1,27 @@
+package dto
+
+import "time"
+
+type PresignRequest struct {
+	// Method allowed by the URL, GET to download a file or POST to upload one
+	Method string `json:"method"`
+	// ID of the file to download
+	ID string `json:"id,omitempty"`
+	// Whether the GET URL opens the event stream instead of downloading a file
+	Events bool `json:"events,omitempty"`
+	// Validity of the URL in seconds
+	ExpiresIn int64 `json:"expiresIn"`
+	// Max size in bytes of the uploaded file
+	MaxSize int64 `json:"maxSize,omitempty"`
+	// Folder of the uploaded file, the root folder if empty
+	Folder string `json:"folder,omitempty"`
+	// Name of the uploaded file, the name of the sent file if empty.
+	// A named URL cannot replace an existing file, so it uploads a single file.
+	Name string `json:"name,omitempty"`
+}
+
+type PresignResponse struct {
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
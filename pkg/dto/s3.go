@@ -0,0 +1,116 @@
+package dto
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Namespace of the S3 XML documents.
+const S3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+type AccessKeyResponse struct {
+	ID        uint      `json:"id"`
+	KeyID     string    `json:"keyId"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ListAccessKeysResponse struct {
+	Count int                 `json:"count"`
+	Keys  []AccessKeyResponse `json:"keys"`
+}
+
+type S3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+type S3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type S3Bucket struct {
+	Name         string    `xml:"Name"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+type S3ListBucketsResponse struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Owner   S3Owner    `xml:"Owner"`
+	Buckets []S3Bucket `xml:"Buckets>Bucket"`
+}
+
+type S3LocationResponse struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Region  string   `xml:",chardata"`
+}
+
+type S3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+	StorageClass string    `xml:"StorageClass"`
+}
+
+type S3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// S3ListObjectsResponse is the result of both ListObjects (V1) and ListObjectsV2,
+// whose specific fields are omitted when empty.
+type S3ListObjectsResponse struct {
+	XMLName        xml.Name         `xml:"ListBucketResult"`
+	Xmlns          string           `xml:"xmlns,attr"`
+	Name           string           `xml:"Name"`
+	Prefix         string           `xml:"Prefix"`
+	Delimiter      string           `xml:"Delimiter,omitempty"`
+	MaxKeys        int              `xml:"MaxKeys"`
+	EncodingType   string           `xml:"EncodingType,omitempty"`
+	IsTruncated    bool             `xml:"IsTruncated"`
+	Contents       []S3Object       `xml:"Contents"`
+	CommonPrefixes []S3CommonPrefix `xml:"CommonPrefixes"`
+
+	// V1 only
+	Marker     *string `xml:"Marker"`
+	NextMarker string  `xml:"NextMarker,omitempty"`
+
+	// V2 only
+	KeyCount              *int   `xml:"KeyCount"`
+	ContinuationToken     string `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string `xml:"StartAfter,omitempty"`
+}
+
+type S3InitiateMultipartUploadResponse struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type S3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type S3CompleteMultipartUploadRequest struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []S3CompletedPart `xml:"Part"`
+}
+
+type S3CompleteMultipartUploadResponse struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
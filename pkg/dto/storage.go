@@ -0,0 +1,44 @@
+package dto
+
+type DeletionStatusResponse struct {
+	Pending   int64  `json:"pending"`
+	Failing   int64  `json:"failing"`
+	Removed   int64  `json:"removed"`
+	LastRunAt string `json:"lastRunAt,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+type VolumeResponse struct {
+	Name          string `json:"name"`
+	Path          string `json:"path"`
+	Weight        int    `json:"weight"`
+	ReservedBytes int64  `json:"reservedBytes"`
+	Tier          string `json:"tier,omitempty"`
+	FreeBytes     int64  `json:"freeBytes"`
+	TotalBytes    int64  `json:"totalBytes"`
+	Files         int64  `json:"files"`
+	Draining      bool   `json:"draining"`
+	Running       bool   `json:"drainRunning"`
+	Relocated     int64  `json:"relocated"`
+	Failed        int64  `json:"failed"`
+	LastError     string `json:"lastError,omitempty"`
+}
+
+type ListVolumesResponse struct {
+	Count   int              `json:"count"`
+	Volumes []VolumeResponse `json:"volumes"`
+}
+
+type ReplicaResponse struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Lagging   int64  `json:"lagging"`
+	Synced    int64  `json:"synced"`
+	LastRunAt string `json:"lastRunAt,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+type ListReplicasResponse struct {
+	Count    int               `json:"count"`
+	Replicas []ReplicaResponse `json:"replicas"`
+}
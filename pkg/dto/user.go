@@ -0,0 +1,71 @@
+package dto
+
+import "time"
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RegisterRequest struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+}
+
+type CreateAppTokenRequest struct {
+	Name string `json:"name"`
+}
+
+type AppTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+type ListAppTokensResponse struct {
+	Count  int                `json:"count"`
+	Tokens []AppTokenResponse `json:"tokens"`
+}
+
+// UserSettingsRequest holds the settings of the user, null for the server defaults.
+type UserSettingsRequest struct {
+	ScrubImageMetadata *bool `json:"scrubImageMetadata"`
+	KeepImageOriginal  *bool `json:"keepImageOriginal"`
+}
+
+type UserSettingsResponse struct {
+	// Effective settings, those of the user or else the server defaults
+	ScrubImageMetadata bool `json:"scrubImageMetadata"`
+	KeepImageOriginal  bool `json:"keepImageOriginal"`
+	// Settings of the user, null for the server defaults
+	Overrides UserSettingsRequest `json:"overrides"`
+}
+
+// DeleteAccountRequest confirms the deletion of the account with the password of the user.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type AccountDeletionResponse struct {
+	// ID of the user, for the admin endpoints
+	ID uint `json:"id,omitempty"`
+	// Time after which the account and all its data are deleted, null unless requested
+	DeleteAt *time.Time `json:"deleteAt"`
+	// Whether the account was deleted already
+	Deleted bool `json:"deleted,omitempty"`
+}
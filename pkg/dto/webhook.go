@@ -0,0 +1,38 @@
+package dto
+
+import "time"
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookResponse struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ListWebhooksResponse struct {
+	Count    int               `json:"count"`
+	Webhooks []WebhookResponse `json:"webhooks"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             uint       `json:"id"`
+	EventID        string     `json:"eventId"`
+	Event          string     `json:"event"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Count      int                       `json:"count"`
+	Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+}